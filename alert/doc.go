@@ -0,0 +1,2 @@
+// Package alert provides the alerts raised by analyzers, and sinks which deliver them outside of ctop
+package alert
@@ -0,0 +1,222 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rs/zerolog/log"
+)
+
+// StateStore persists the lifecycle of alerts
+type StateStore interface {
+	GetAlertState(ctx context.Context, analyzer string, network string, subject string) (db.AlertState, error)
+	GetFiringAlertStates(ctx context.Context, analyzer string, network string) ([]db.AlertState, error)
+	StoreAlertState(ctx context.Context, state *db.AlertState) error
+}
+
+// Identities resolves the monikers of validators
+type Identities interface {
+	Moniker(ctx context.Context, network string, address string) string
+}
+
+// Manager deduplicates alerts before sending them to a sink. A condition which keeps being detected results in a
+// single firing notification, followed by a resolved notification once it is no longer detected. Conditions which
+// remain firing are sent again every renotify interval, a zero interval disables renotification. When at least
+// group alerts of an analyzer and network change status at once they are sent as a single notification, a group
+// below 2 disables grouping. Alerts are sent with the moniker of their validator if identities is not nil
+type Manager struct {
+	store      StateStore
+	sink       AlertSink
+	renotify   time.Duration
+	group      int
+	identities Identities
+	now        func() time.Time
+}
+
+func NewManager(
+	store StateStore,
+	sink AlertSink,
+	renotify time.Duration,
+	group int,
+	identities Identities,
+) *Manager {
+	return &Manager{
+		store:      store,
+		sink:       sink,
+		renotify:   renotify,
+		group:      group,
+		identities: identities,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Records the complete set of conditions an analyzer currently detects for a network. Alerts which were not
+// firing are sent as firing, and previously firing alerts which are absent from alerts are sent as resolved
+func (m *Manager) Reconcile(
+	ctx context.Context,
+	analyzer string,
+	network string,
+	alerts []Alert,
+) error {
+	now := m.now()
+	states, err := m.store.GetFiringAlertStates(ctx, analyzer, network)
+	if err != nil {
+		return err
+	}
+	firing := make(map[string]db.AlertState, len(states))
+	for _, state := range states {
+		firing[state.Subject] = state
+	}
+	var (
+		errs     []error
+		notify   []Alert
+		resolved []Alert
+	)
+	for _, alert := range alerts {
+		alert.Analyzer, alert.Network = analyzer, network
+		state, ok := firing[alert.Key()]
+		delete(firing, alert.Key())
+		if !ok {
+			// alerts which are not firing start a new lifecycle, replacing any previously resolved state
+			state = db.AlertState{FirstSeen: now}
+		}
+		send := m.record(&state, alert, now, !ok)
+		if err := m.store.StoreAlertState(ctx, &state); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if send {
+			notify = append(notify, stateToAlert(state, now))
+		}
+	}
+	for _, state := range firing {
+		state.Status = string(StatusResolved)
+		state.ResolvedAt = now
+		state.LastNotified = now
+		if err := m.store.StoreAlertState(ctx, &state); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved = append(resolved, stateToAlert(state, now))
+	}
+	m.sendAll(ctx, analyzer, network, StatusFiring, notify, now)
+	m.sendAll(ctx, analyzer, network, StatusResolved, resolved, now)
+	return errors.Join(errs...)
+}
+
+// Records an alert describing an event which does not persist, such as a double sign. The alert is sent unless an
+// alert with the same key was already sent within the renotify interval, and is immediately recorded as resolved
+func (m *Manager) Notify(ctx context.Context, alert Alert) error {
+	now := m.now()
+	state, err := m.store.GetAlertState(ctx, alert.Analyzer, alert.Network, alert.Key())
+	if errors.Is(err, sql.ErrNoRows) {
+		state = db.AlertState{FirstSeen: now}
+	} else if err != nil {
+		return err
+	}
+	notify := m.record(&state, alert, now, state.LastNotified.IsZero())
+	firing := stateToAlert(state, now)
+	state.Status = string(StatusResolved)
+	state.ResolvedAt = now
+	if err := m.store.StoreAlertState(ctx, &state); err != nil {
+		return err
+	}
+	if notify {
+		m.send(ctx, firing)
+	}
+	return nil
+}
+
+// updates the state with a new occurrence of the alert, returning true if the alert should be sent
+// because notify is set or renotification is due
+func (m *Manager) record(
+	state *db.AlertState,
+	alert Alert,
+	now time.Time,
+	notify bool,
+) bool {
+	state.Analyzer = alert.Analyzer
+	state.Network = alert.Network
+	state.Subject = alert.Key()
+	state.Status = string(StatusFiring)
+	state.Severity = string(alert.Severity)
+	state.Validator = alert.Validator
+	state.Height = alert.Height
+	state.Message = alert.Message
+	state.Occurrences++
+	state.LastSeen = now
+	state.ResolvedAt = time.Time{}
+	if m.renotify > 0 && now.Sub(state.LastNotified) >= m.renotify {
+		notify = true
+	}
+	if notify {
+		state.LastNotified = now
+	}
+	return notify
+}
+
+// sends alerts of an analyzer and network with the same status, as a single group if there are enough of them
+func (m *Manager) sendAll(
+	ctx context.Context,
+	analyzer string,
+	network string,
+	status Status,
+	alerts []Alert,
+	now time.Time,
+) {
+	if m.group < 2 || len(alerts) < m.group {
+		for _, alert := range alerts {
+			m.send(ctx, alert)
+		}
+		return
+	}
+	group := Alert{
+		Network:  network,
+		Analyzer: analyzer,
+		Message:  fmt.Sprintf("%d alerts %s", len(alerts), status),
+		Time:     now,
+		Status:   status,
+		Alerts:   make([]Alert, 0, len(alerts)),
+	}
+	for _, alert := range alerts {
+		if severityRank[alert.Severity] > severityRank[group.Severity] {
+			group.Severity = alert.Severity
+		}
+		group.Alerts = append(group.Alerts, m.withMoniker(ctx, alert))
+	}
+	m.send(ctx, group)
+}
+
+func (m *Manager) send(ctx context.Context, alert Alert) {
+	alert = m.withMoniker(ctx, alert)
+	if err := m.sink.Send(ctx, alert); err != nil {
+		log.Error().Err(err).Str("analyzer", alert.Analyzer).Str("network", alert.Network).Msg("failed to send alert")
+	}
+}
+
+func (m *Manager) withMoniker(ctx context.Context, alert Alert) Alert {
+	if m.identities != nil && alert.Validator != "" {
+		alert.Moniker = m.identities.Moniker(ctx, alert.Network, alert.Validator)
+	}
+	return alert
+}
+
+func stateToAlert(state db.AlertState, now time.Time) Alert {
+	return Alert{
+		Severity:    Severity(state.Severity),
+		Network:     state.Network,
+		Validator:   state.Validator,
+		Height:      state.Height,
+		Analyzer:    state.Analyzer,
+		Message:     state.Message,
+		Time:        now,
+		Subject:     state.Subject,
+		Status:      Status(state.Status),
+		FirstSeen:   state.FirstSeen,
+		Occurrences: state.Occurrences,
+	}
+}
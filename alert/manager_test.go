@@ -0,0 +1,171 @@
+package alert_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/stretchr/testify/require"
+)
+
+// in memory StateStore
+type stateStore map[string]db.AlertState
+
+func (ss stateStore) GetAlertState(ctx context.Context, analyzer string, network string, subject string) (db.AlertState, error) {
+	state, ok := ss[analyzer+network+subject]
+	if !ok {
+		return db.AlertState{}, sql.ErrNoRows
+	}
+	return state, nil
+}
+
+func (ss stateStore) GetFiringAlertStates(ctx context.Context, analyzer string, network string) ([]db.AlertState, error) {
+	var states []db.AlertState
+	for _, state := range ss {
+		if state.Analyzer == analyzer && state.Network == network && state.Status == string(alert.StatusFiring) {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func (ss stateStore) StoreAlertState(ctx context.Context, state *db.AlertState) error {
+	ss[state.Analyzer+state.Network+state.Subject] = *state
+	return nil
+}
+
+// sink recording every alert sent
+type recordingSink struct {
+	alerts []alert.Alert
+}
+
+func (rs *recordingSink) Send(ctx context.Context, a alert.Alert) error {
+	rs.alerts = append(rs.alerts, a)
+	return nil
+}
+
+// Identities resolving monikers from a map of address to moniker
+type monikers map[string]string
+
+func (m monikers) Moniker(ctx context.Context, network string, address string) string {
+	return m[address]
+}
+
+func TestManagerReconcile(t *testing.T) {
+	ctx := context.Background()
+	store := make(stateStore)
+	sink := &recordingSink{}
+	manager := alert.NewManager(store, sink, 100*time.Millisecond, 0, monikers{"A": "alice"})
+
+	missing := []alert.Alert{
+		{Severity: alert.SeverityWarning, Validator: "A", Height: 1, Message: "missing vote"},
+		{Severity: alert.SeverityWarning, Validator: "B", Height: 1, Message: "missing vote"},
+	}
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing))
+	require.Len(t, sink.alerts, 2)
+	require.Equal(t, "alice", sink.alerts[0].Moniker)
+	require.Empty(t, sink.alerts[1].Moniker)
+	for _, a := range sink.alerts {
+		require.Equal(t, alert.StatusFiring, a.Status)
+		require.Equal(t, "missing-votes", a.Analyzer)
+		require.Equal(t, "osmosis", a.Network)
+		require.Equal(t, 1, a.Occurrences)
+	}
+
+	// conditions which keep firing are not sent again
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing))
+	require.Len(t, sink.alerts, 2)
+	require.Equal(t, 2, store["missing-votesosmosisA"].Occurrences)
+
+	// until the renotify interval has elapsed
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing))
+	require.Len(t, sink.alerts, 4)
+	require.Equal(t, 3, sink.alerts[3].Occurrences)
+
+	// conditions which are no longer detected are resolved
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing[:1]))
+	require.Len(t, sink.alerts, 5)
+	require.Equal(t, alert.StatusResolved, sink.alerts[4].Status)
+	require.Equal(t, "B", sink.alerts[4].Validator)
+	require.Equal(t, string(alert.StatusResolved), store["missing-votesosmosisB"].Status)
+
+	// resolved conditions which fire again start a new lifecycle
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing))
+	require.Len(t, sink.alerts, 6)
+	require.Equal(t, alert.StatusFiring, sink.alerts[5].Status)
+	require.Equal(t, "B", sink.alerts[5].Validator)
+	require.Equal(t, 1, sink.alerts[5].Occurrences)
+
+	// alerts of other networks are not affected
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "cosmoshub", nil))
+	require.Len(t, sink.alerts, 6)
+}
+
+func TestManagerReconcileGroup(t *testing.T) {
+	ctx := context.Background()
+	store := make(stateStore)
+	sink := &recordingSink{}
+	manager := alert.NewManager(store, sink, 0, 2, monikers{"A": "alice"})
+
+	missing := []alert.Alert{
+		{Severity: alert.SeverityWarning, Validator: "A", Height: 1, Message: "missing vote"},
+		{Severity: alert.SeverityCritical, Validator: "B", Height: 1, Message: "missing vote"},
+		{Severity: alert.SeverityWarning, Validator: "C", Height: 1, Message: "missing vote"},
+	}
+	// alerts which start firing together are sent as a single notification
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing))
+	require.Len(t, sink.alerts, 1)
+	group := sink.alerts[0]
+	require.Equal(t, alert.StatusFiring, group.Status)
+	require.Equal(t, alert.SeverityCritical, group.Severity)
+	require.Equal(t, "missing-votes", group.Analyzer)
+	require.Equal(t, "osmosis", group.Network)
+	require.Len(t, group.Alerts, 3)
+	require.Equal(t, "alice", group.Alerts[0].Moniker)
+
+	// as are alerts which resolve together
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing[:1]))
+	require.Len(t, sink.alerts, 2)
+	require.Equal(t, alert.StatusResolved, sink.alerts[1].Status)
+	require.Len(t, sink.alerts[1].Alerts, 2)
+
+	// alerts below the group size are sent on their own
+	require.NoError(t, manager.Reconcile(ctx, "missing-votes", "osmosis", missing[:2]))
+	require.Len(t, sink.alerts, 3)
+	require.Equal(t, "B", sink.alerts[2].Validator)
+	require.Empty(t, sink.alerts[2].Alerts)
+}
+
+func TestManagerNotify(t *testing.T) {
+	ctx := context.Background()
+	store := make(stateStore)
+	sink := &recordingSink{}
+	manager := alert.NewManager(store, sink, 0, 0, nil)
+
+	doubleSign := alert.Alert{
+		Severity:  alert.SeverityCritical,
+		Network:   "osmosis",
+		Validator: "A",
+		Height:    10,
+		Analyzer:  "double-sign",
+		Subject:   "A/10/0/SIGNED_MSG_TYPE_PREVOTE",
+		Message:   "double sign detected",
+	}
+	require.NoError(t, manager.Notify(ctx, doubleSign))
+	require.Len(t, sink.alerts, 1)
+	require.Equal(t, alert.StatusFiring, sink.alerts[0].Status)
+	require.Equal(t, string(alert.StatusResolved), store["double-signosmosisA/10/0/SIGNED_MSG_TYPE_PREVOTE"].Status)
+
+	// the same event is only sent once
+	require.NoError(t, manager.Notify(ctx, doubleSign))
+	require.Len(t, sink.alerts, 1)
+	require.Equal(t, 2, store["double-signosmosisA/10/0/SIGNED_MSG_TYPE_PREVOTE"].Occurrences)
+
+	doubleSign.Subject = "A/11/0/SIGNED_MSG_TYPE_PREVOTE"
+	require.NoError(t, manager.Notify(ctx, doubleSign))
+	require.Len(t, sink.alerts, 2)
+}
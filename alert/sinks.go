@@ -0,0 +1,162 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MultiSink sends alerts to every sink it contains
+type MultiSink []AlertSink
+
+func (ms MultiSink) Send(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, sink := range ms {
+		if err := sink.Send(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriterSink writes alerts as JSON lines
+type WriterSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// returns a sink writing alerts to stdout as JSON lines
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (ws *WriterSink) Send(ctx context.Context, alert Alert) error {
+	encoded, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_, err = ws.w.Write(append(encoded, '\n'))
+	return err
+}
+
+// LogSink logs alerts, it is used when no other sink is configured
+type LogSink struct{}
+
+func (ls LogSink) Send(ctx context.Context, alert Alert) error {
+	// grouped alerts are logged individually
+	for _, member := range alert.Alerts {
+		_ = ls.Send(ctx, member)
+	}
+	if len(alert.Alerts) > 0 {
+		return nil
+	}
+	event := log.Warn()
+	switch alert.Severity {
+	case SeverityInfo:
+		event = log.Info()
+	case SeverityCritical:
+		event = log.Error()
+	}
+	if alert.Status == StatusResolved {
+		event = log.Info()
+	}
+	event.
+		Str("analyzer", alert.Analyzer).
+		Str("status", string(alert.Status)).
+		Str("network", alert.Network).
+		Str("validator", alert.Validator).
+		Str("moniker", alert.Moniker).
+		Int64("height", alert.Height).
+		Msg(alert.Message)
+	return nil
+}
+
+// WebhookSink POSTs alerts as JSON to a url
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (ws *WebhookSink) Send(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, ws.client, ws.url, alert)
+}
+
+// SlackSink POSTs alerts to a Slack compatible incoming webhook
+type SlackSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackSink(url string) *SlackSink {
+	return &SlackSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (ss *SlackSink) Send(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, ss.client, ss.url, map[string]string{"text": FormatText(alert)})
+}
+
+// Formats an alert as a single line of text, followed by a line for every alert of a group
+func FormatText(alert Alert) string {
+	var sb strings.Builder
+	if alert.Status == StatusResolved {
+		fmt.Fprintf(&sb, "[RESOLVED] ")
+	}
+	fmt.Fprintf(&sb, "[%s] %s/%s: %s", strings.ToUpper(string(alert.Severity)), alert.Network, alert.Analyzer, alert.Message)
+	if alert.Validator != "" && alert.Moniker != "" {
+		fmt.Fprintf(&sb, " (validator %s %s)", alert.Moniker, alert.Validator)
+	} else if alert.Validator != "" {
+		fmt.Fprintf(&sb, " (validator %s)", alert.Validator)
+	}
+	if alert.Height != 0 {
+		fmt.Fprintf(&sb, " at height %d", alert.Height)
+	}
+	if alert.Occurrences > 1 {
+		fmt.Fprintf(&sb, ", seen %d times since %s", alert.Occurrences, alert.FirstSeen.Format(time.RFC3339))
+	}
+	for _, member := range alert.Alerts {
+		fmt.Fprintf(&sb, "\n  %s", FormatText(member))
+	}
+	return sb.String()
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", url, res.StatusCode)
+	}
+	return nil
+}
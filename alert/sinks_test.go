@@ -0,0 +1,81 @@
+package alert_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	example := alert.Alert{
+		Severity:  alert.SeverityWarning,
+		Network:   "osmosis",
+		Validator: "AAAA",
+		Height:    12345,
+		Analyzer:  "missing-votes",
+		Message:   "validator has not voted at height 12345",
+		Time:      time.Unix(0, 0).UTC(),
+	}
+
+	var webhookAlert alert.Alert
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&webhookAlert))
+	}))
+	defer webhook.Close()
+	require.NoError(t, alert.NewWebhookSink(webhook.URL).Send(ctx, example))
+	require.Equal(t, example, webhookAlert)
+
+	var slackMessage map[string]string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&slackMessage))
+	}))
+	defer slack.Close()
+	require.NoError(t, alert.NewSlackSink(slack.URL).Send(ctx, example))
+	require.Equal(t, "[WARNING] osmosis/missing-votes: validator has not voted at height 12345 (validator AAAA) at height 12345", slackMessage["text"])
+	withMoniker := example
+	withMoniker.Moniker = "range"
+	require.Equal(t, "[WARNING] osmosis/missing-votes: validator has not voted at height 12345 (validator range AAAA) at height 12345", alert.FormatText(withMoniker))
+	group := alert.Alert{
+		Severity: alert.SeverityWarning,
+		Network:  "osmosis",
+		Analyzer: "missing-votes",
+		Message:  "2 alerts firing",
+		Alerts:   []alert.Alert{example, withMoniker},
+	}
+	require.Equal(
+		t,
+		"[WARNING] osmosis/missing-votes: 2 alerts firing\n"+
+			"  [WARNING] osmosis/missing-votes: validator has not voted at height 12345 (validator AAAA) at height 12345\n"+
+			"  [WARNING] osmosis/missing-votes: validator has not voted at height 12345 (validator range AAAA) at height 12345",
+		alert.FormatText(group),
+	)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	require.Error(t, alert.NewWebhookSink(failing.URL).Send(ctx, example))
+
+	var buf bytes.Buffer
+	require.NoError(t, alert.NewWriterSink(&buf).Send(ctx, example))
+	var written alert.Alert
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &written))
+	require.Equal(t, example, written)
+	require.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+
+	// a failing sink does not prevent delivery to the remaining sinks
+	buf.Reset()
+	multi := alert.MultiSink{alert.NewWebhookSink(failing.URL), alert.NewWriterSink(&buf)}
+	require.Error(t, multi.Send(ctx, example))
+	require.Greater(t, buf.Len(), 0)
+}
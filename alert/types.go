@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"context"
+	"time"
+)
+
+type Severity string
+
+type Status string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// orders severities from least to most severe
+var severityRank = map[Severity]int{
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityCritical: 3,
+}
+
+const (
+	// the condition described by the alert is ongoing
+	StatusFiring Status = "firing"
+	// the condition described by the alert is no longer detected
+	StatusResolved Status = "resolved"
+)
+
+// Alert is a condition detected by an analyzer
+type Alert struct {
+	Severity Severity `json:"severity"`
+	Network  string   `json:"network"`
+	// consensus address of the validator the alert concerns, empty for network wide alerts
+	Validator string `json:"validator,omitempty"`
+	// moniker of the validator, set by Manager when the identity of the validator is known
+	Moniker string `json:"moniker,omitempty"`
+	// height at which the condition was detected, 0 if not applicable
+	Height   int64     `json:"height,omitempty"`
+	Analyzer string    `json:"analyzer"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+	// identifies the condition within the analyzer and network, defaults to Validator
+	Subject string `json:"subject,omitempty"`
+	// set by Manager when tracking the lifecycle of the alert
+	Status      Status    `json:"status,omitempty"`
+	FirstSeen   time.Time `json:"first_seen"`
+	Occurrences int       `json:"occurrences,omitempty"`
+	// related alerts sent as a single notification by Manager, with the most severe severity of the group
+	Alerts []Alert `json:"alerts,omitempty"`
+}
+
+// Returns the subject identifying the condition the alert describes
+func (a Alert) Key() string {
+	if a.Subject != "" {
+		return a.Subject
+	}
+	return a.Validator
+}
+
+// AlertSink delivers alerts to an external system
+type AlertSink interface {
+	Send(ctx context.Context, alert Alert) error
+}
@@ -0,0 +1,182 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rs/zerolog/log"
+)
+
+// Finds validators which cast votes for different block ids at the same height, round and vote type.
+// Only the first two conflicting votes of a validator are returned as evidence, votes are compared
+// in the order they are given
+func FindEquivocations(votes []db.VoteEvent) []db.EquivocationEvidence {
+	type voteKey struct {
+		validator string
+		height    int
+		round     int
+		voteType  string
+	}
+	var (
+		first    = make(map[voteKey]db.VoteEvent)
+		found    = make(map[voteKey]struct{})
+		evidence []db.EquivocationEvidence
+	)
+	for _, vote := range votes {
+		key := voteKey{vote.ValidatorAddress, vote.Height, vote.Round, vote.VoteType}
+		voteA, ok := first[key]
+		if !ok {
+			first[key] = vote
+			continue
+		}
+		if _, ok := found[key]; ok || voteA.BlockID == vote.BlockID {
+			continue
+		}
+		found[key] = struct{}{}
+		evidence = append(evidence, db.EquivocationEvidence{
+			Network:          vote.Network,
+			ValidatorAddress: vote.ValidatorAddress,
+			Height:           vote.Height,
+			Round:            vote.Round,
+			VoteType:         vote.VoteType,
+			VoteAID:          voteA.ID,
+			VoteABlockID:     voteA.BlockID,
+			VoteATimestamp:   voteA.BlockTimestamp,
+			VoteASignature:   voteA.ValidatorSignature,
+			VoteBID:          vote.ID,
+			VoteBBlockID:     vote.BlockID,
+			VoteBTimestamp:   vote.BlockTimestamp,
+			VoteBSignature:   vote.ValidatorSignature,
+		})
+	}
+	return evidence
+}
+
+const EquivocationAnalyzerName = "double-sign"
+
+// EquivocationAnalyzer detects validators double signing votes, storing the conflicting votes as evidence.
+//
+// Nodes only publish the votes they accepted, a conflicting vote is turned into evidence instead, so
+// equivocation is only visible when the votes of a network are gathered from several endpoints which
+// received different votes first
+type EquivocationAnalyzer struct {
+	db     db.Store
+	alerts *alert.Manager
+	// optional, see VoteSignal
+	signal *VoteSignal
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Creates an analyzer which checks votes on every poll, and as soon as signal reports that new votes have been
+// stored if signal is not nil
+func NewEquivocationAnalyzer(
+	ctx context.Context,
+	db db.Store,
+	alerts *alert.Manager,
+	signal *VoteSignal,
+) *EquivocationAnalyzer {
+	ctx, cancel := context.WithCancel(ctx)
+	return &EquivocationAnalyzer{
+		db,
+		alerts,
+		signal,
+		ctx,
+		cancel,
+	}
+}
+
+// Checks votes between fromHeight and toHeight for equivocations, returning evidence which has not been seen before
+func (ea *EquivocationAnalyzer) Check(
+	network string,
+	fromHeight int64,
+	toHeight int64,
+) ([]db.EquivocationEvidence, error) {
+	votes, err := ea.db.GetVotesInHeightRange(ea.ctx, network, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	var newEvidence []db.EquivocationEvidence
+	for _, evidence := range FindEquivocations(votes) {
+		stored, err := ea.db.StoreEquivocationEvidence(ea.ctx, &evidence)
+		if err != nil {
+			return newEvidence, err
+		}
+		if stored {
+			newEvidence = append(newEvidence, evidence)
+		}
+	}
+	return newEvidence, nil
+}
+
+func (ea *EquivocationAnalyzer) Start(
+	network string,
+	pollFrequency time.Duration,
+) {
+	var (
+		lastHeight int64
+		stored     <-chan struct{}
+	)
+	if ea.signal != nil {
+		stored = ea.signal.Subscribe(network)
+	}
+	ticker := time.NewTicker(pollFrequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ea.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-stored:
+		}
+		lastHeight = ea.poll(network, lastHeight)
+	}
+}
+
+// Checks the votes stored since lastHeight, returning the height up to which votes have been checked
+func (ea *EquivocationAnalyzer) poll(network string, lastHeight int64) int64 {
+	latestHeight, err := ea.db.GetLatestVoteHeight(ea.ctx, network)
+	if err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to query db for latest vote height")
+		return lastHeight
+	}
+	if latestHeight == 0 {
+		return lastHeight
+	}
+	if lastHeight == 0 {
+		lastHeight = latestHeight
+	}
+	// precommits for the previous height keep arriving after a block is committed, so the
+	// previous height is checked again, evidence which was already stored is not reported twice
+	evidence, err := ea.Check(network, lastHeight-1, latestHeight)
+	if err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to check votes for equivocation")
+	}
+	for _, ev := range evidence {
+		if err := ea.alerts.Notify(ea.ctx, alert.Alert{
+			Severity:  alert.SeverityCritical,
+			Network:   network,
+			Validator: ev.ValidatorAddress,
+			Height:    int64(ev.Height),
+			Analyzer:  EquivocationAnalyzerName,
+			Subject:   fmt.Sprintf("%s/%d/%d/%s", ev.ValidatorAddress, ev.Height, ev.Round, ev.VoteType),
+			Message: fmt.Sprintf(
+				"double sign detected, %s votes in round %d for %s and %s",
+				ev.VoteType, ev.Round, ev.VoteABlockID, ev.VoteBBlockID,
+			),
+		}); err != nil {
+			log.Error().Err(err).Str("network", network).Msg("failed to send alert")
+		}
+	}
+	if err != nil {
+		return lastHeight
+	}
+	return latestHeight
+}
+
+func (ea *EquivocationAnalyzer) Stop() {
+	ea.cancel()
+}
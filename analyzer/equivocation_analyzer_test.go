@@ -0,0 +1,107 @@
+package analyzer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/google/uuid"
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindEquivocations(t *testing.T) {
+	prevote := cmtproto.PrevoteType.String()
+	precommit := cmtproto.PrecommitType.String()
+	vote := func(validator string, round int, voteType string, blockID string) db.VoteEvent {
+		return db.VoteEvent{
+			ID:               uuid.New(),
+			Network:          "osmosis",
+			VoteType:         voteType,
+			Height:           10,
+			Round:            round,
+			BlockID:          blockID,
+			ValidatorAddress: validator,
+		}
+	}
+	votes := []db.VoteEvent{
+		vote("A", 0, prevote, "HASH1:1:000000000000"),
+		// duplicate vote for the same block is not an equivocation
+		vote("A", 0, prevote, "HASH1:1:000000000000"),
+		// different vote type
+		vote("A", 0, precommit, "HASH2:1:000000000000"),
+		// different round
+		vote("A", 1, prevote, "HASH2:1:000000000000"),
+		vote("B", 0, prevote, "HASH1:1:000000000000"),
+		// voting for nil and a block is an equivocation
+		vote("B", 0, prevote, ":0:000000000000"),
+		// only the first conflict is reported
+		vote("B", 0, prevote, "HASH3:1:000000000000"),
+	}
+	evidence := analyzer.FindEquivocations(votes)
+	require.Len(t, evidence, 1)
+	require.Equal(t, "B", evidence[0].ValidatorAddress)
+	require.Equal(t, "osmosis", evidence[0].Network)
+	require.Equal(t, 10, evidence[0].Height)
+	require.Equal(t, 0, evidence[0].Round)
+	require.Equal(t, prevote, evidence[0].VoteType)
+	require.Equal(t, votes[4].ID, evidence[0].VoteAID)
+	require.Equal(t, "HASH1:1:000000000000", evidence[0].VoteABlockID)
+	require.Equal(t, votes[5].ID, evidence[0].VoteBID)
+	require.Equal(t, ":0:000000000000", evidence[0].VoteBBlockID)
+}
+
+type channelSink chan alert.Alert
+
+func (cs channelSink) Send(ctx context.Context, a alert.Alert) error {
+	cs <- a
+	return nil
+}
+
+func TestEquivocationAnalyzerSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+
+	sink := make(channelSink, 1)
+	signal := analyzer.NewVoteSignal()
+	ea := analyzer.NewEquivocationAnalyzer(ctx, database, alert.NewManager(database, sink, 0, 0, nil), signal)
+	// polling alone would never detect the equivocation during the test
+	go ea.Start("osmosis", time.Hour)
+	defer ea.Stop()
+
+	vote := func(blockID string) common.ParsedVote {
+		return common.ParsedVote{
+			Type:             cmtproto.PrevoteType.String(),
+			Height:           10,
+			BlockID:          blockID,
+			ValidatorAddress: "A",
+			Signature:        []byte{1},
+		}
+	}
+	require.NoError(t, database.StoreVotes(ctx, "osmosis", []common.ParsedVote{
+		vote("HASH1:1:000000000000"),
+		vote("HASH2:1:000000000000"),
+	}))
+	// the analyzer subscribes once started, keep notifying until it does
+	deadline := time.After(5 * time.Second)
+	for {
+		signal.Notify("osmosis")
+		select {
+		case a := <-sink:
+			require.Equal(t, analyzer.EquivocationAnalyzerName, a.Analyzer)
+			require.Equal(t, "A", a.Validator)
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("equivocation was not detected once votes were stored")
+		}
+	}
+}
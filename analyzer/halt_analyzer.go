@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rs/zerolog/log"
+)
+
+// the progress of a network at the time it was checked
+type HaltStatus struct {
+	Height int64
+	Round  int64
+	Step   string
+	// proposer of the latest round, empty if unknown
+	Proposer string
+	// time at which the first round step of the height was observed
+	HeightStarted time.Time
+	// how long the network has been at the current height
+	Elapsed time.Duration
+	// the network has been at the current height for longer than the configured threshold
+	Stalled bool
+	// the network has escalated past the configured round at the current height
+	RoundsExceeded bool
+}
+
+// Evaluates whether a network at the given round step is stalled, heights which have lasted longer than
+// heightThreshold or escalated past round maxRounds are considered stalled. A zero heightThreshold
+// or maxRounds disables the respective check
+func EvaluateHalt(
+	step db.NewRoundStepEvent,
+	heightStarted time.Time,
+	now time.Time,
+	heightThreshold time.Duration,
+	maxRounds int64,
+) HaltStatus {
+	elapsed := now.Sub(heightStarted)
+	return HaltStatus{
+		Height:         int64(step.Height),
+		Round:          int64(step.Round),
+		Step:           step.Step,
+		HeightStarted:  heightStarted,
+		Elapsed:        elapsed,
+		Stalled:        heightThreshold > 0 && elapsed > heightThreshold,
+		RoundsExceeded: maxRounds > 0 && int64(step.Round) > maxRounds,
+	}
+}
+
+const HaltAnalyzerName = "halt"
+
+// HaltAnalyzer alerts when a network stops producing blocks, either by remaining at the same height for too
+// long or by escalating through too many rounds at a single height
+type HaltAnalyzer struct {
+	db              db.Store
+	alerts          *alert.Manager
+	heightThreshold time.Duration
+	maxRounds       int64
+	ctx             context.Context
+	cancel          context.CancelFunc
+}
+
+func NewHaltAnalyzer(
+	ctx context.Context,
+	db db.Store,
+	alerts *alert.Manager,
+	heightThreshold time.Duration,
+	maxRounds int64,
+) *HaltAnalyzer {
+	ctx, cancel := context.WithCancel(ctx)
+	return &HaltAnalyzer{
+		db,
+		alerts,
+		heightThreshold,
+		maxRounds,
+		ctx,
+		cancel,
+	}
+}
+
+// Returns the current progress of the network
+func (ha *HaltAnalyzer) Check(network string) (HaltStatus, error) {
+	step, err := ha.db.GetLatestNewRoundStep(ha.ctx, network)
+	if err != nil {
+		return HaltStatus{}, err
+	}
+	heightStarted, err := ha.db.GetHeightStartTime(ha.ctx, network, int64(step.Height))
+	if err != nil {
+		return HaltStatus{}, err
+	}
+	status := EvaluateHalt(step, heightStarted, time.Now(), ha.heightThreshold, ha.maxRounds)
+	round, err := ha.db.GetLatestNewRoundForHeight(ha.ctx, network, status.Height)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return HaltStatus{}, err
+	}
+	if err == nil && int64(round.Round) == status.Round {
+		status.Proposer = round.ValidatorAddress
+	}
+	return status, nil
+}
+
+func (ha *HaltAnalyzer) Start(
+	network string,
+	pollFrequency time.Duration,
+) {
+	ticker := time.NewTicker(pollFrequency)
+	for {
+		select {
+		case <-ha.ctx.Done():
+			return
+		case <-ticker.C:
+			status, err := ha.Check(network)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Info().Str("network", network).Msg("no round steps recorded")
+				continue
+			} else if err != nil {
+				log.Error().Err(err).Str("network", network).Msg("failed to check network progress")
+				continue
+			}
+			var alerts []alert.Alert
+			if status.Stalled {
+				alerts = append(alerts, alert.Alert{
+					Severity: alert.SeverityCritical,
+					Height:   status.Height,
+					Subject:  "stalled",
+					Message: fmt.Sprintf(
+						"height stalled for %s at round %d step %s, proposer %s",
+						status.Elapsed.Truncate(time.Second), status.Round, status.Step, status.Proposer,
+					),
+				})
+			}
+			if status.RoundsExceeded {
+				alerts = append(alerts, alert.Alert{
+					Severity: alert.SeverityWarning,
+					Height:   status.Height,
+					Subject:  "round-escalation",
+					Message: fmt.Sprintf(
+						"round escalated to %d past maximum of %d at step %s, proposer %s",
+						status.Round, ha.maxRounds, status.Step, status.Proposer,
+					),
+				})
+			}
+			if err := ha.alerts.Reconcile(ha.ctx, HaltAnalyzerName, network, alerts); err != nil {
+				log.Error().Err(err).Str("network", network).Msg("failed to reconcile alerts")
+			}
+			log.Info().
+				Str("network", network).
+				Int64("height", status.Height).
+				Int64("round", status.Round).
+				Str("step", status.Step).
+				Dur("elapsed", status.Elapsed).
+				Msg("checked network progress")
+		}
+	}
+}
+
+func (ha *HaltAnalyzer) Stop() {
+	ha.cancel()
+}
@@ -0,0 +1,35 @@
+package analyzer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateHalt(t *testing.T) {
+	started := time.Unix(1000, 0)
+	step := db.NewRoundStepEvent{Height: 100, Round: 0, Step: "RoundStepPrevote"}
+
+	status := analyzer.EvaluateHalt(step, started, started.Add(30*time.Second), time.Minute, 3)
+	require.Equal(t, int64(100), status.Height)
+	require.Equal(t, 30*time.Second, status.Elapsed)
+	require.False(t, status.Stalled)
+	require.False(t, status.RoundsExceeded)
+
+	status = analyzer.EvaluateHalt(step, started, started.Add(2*time.Minute), time.Minute, 3)
+	require.True(t, status.Stalled)
+	require.False(t, status.RoundsExceeded)
+
+	step.Round = 4
+	status = analyzer.EvaluateHalt(step, started, started.Add(30*time.Second), time.Minute, 3)
+	require.False(t, status.Stalled)
+	require.True(t, status.RoundsExceeded)
+
+	// zero thresholds disable the checks
+	status = analyzer.EvaluateHalt(step, started, started.Add(time.Hour), 0, 0)
+	require.False(t, status.Stalled)
+	require.False(t, status.RoundsExceeded)
+}
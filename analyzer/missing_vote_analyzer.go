@@ -2,26 +2,34 @@ package analyzer
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/rangesecurity/ctop/alert"
 	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/metrics"
 	"github.com/rs/zerolog/log"
 )
 
+const MissingVoteAnalyzerName = "missing-votes"
+
 // MissingVoteAnalyzer provides alerts whenever validators fail to vote within a specified timeframe
 type MissingVoteAnalyzer struct {
-	db     *db.Database
+	db     db.Store
+	alerts *alert.Manager
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 func NewMissingVoteAnalyzer(
 	ctx context.Context,
-	db *db.Database,
+	db db.Store,
+	alerts *alert.Manager,
 ) *MissingVoteAnalyzer {
 	ctx, cancel := context.WithCancel(ctx)
 	return &MissingVoteAnalyzer{
 		db,
+		alerts,
 		ctx,
 		cancel,
 	}
@@ -31,32 +39,52 @@ func (mva *MissingVoteAnalyzer) Start(
 	network string,
 	pollFrequency time.Duration,
 ) {
+	// height at which missed votes were last counted
+	var countedHeight int64
 	ticker := time.NewTicker(pollFrequency)
 	for {
 		select {
 		case <-mva.ctx.Done():
 			return
 		case <-ticker.C:
-			valis, err := mva.db.GetValidators(mva.ctx, network)
-			if err != nil {
-				log.Error().Err(err).Str("network", network).Msg("failed to get validators")
-				continue
-			}
 			foundVotes := make(map[string]struct{})
 			votes, err := mva.db.GetLatestVotesForNetwork(mva.ctx, network)
 			if err != nil {
 				log.Error().Err(err).Str("network", network).Msg("failed to query db for votes")
 				continue
 			}
+			var latestHeight int64
 			for _, vote := range votes {
 				foundVotes[vote.ValidatorAddress] = struct{}{}
+				if int64(vote.Height) > latestHeight {
+					latestHeight = int64(vote.Height)
+				}
 			}
-			for validatorAddress := range valis.Data {
+			// validators which joined after the latest height aren't expected to have voted yet
+			valis, err := validatorsAt(mva.ctx, mva.db, network, latestHeight)
+			if err != nil {
+				log.Error().Err(err).Str("network", network).Msg("failed to get validators")
+				continue
+			}
+			var alerts []alert.Alert
+			for validatorAddress := range valis {
 				if _, exists := foundVotes[validatorAddress]; !exists {
-					log.Warn().Str("validator", validatorAddress).Msg("missing vote")
+					if latestHeight > countedHeight {
+						metrics.ValidatorMissedVotes.WithLabelValues(network, validatorAddress).Inc()
+					}
+					alerts = append(alerts, alert.Alert{
+						Severity:  alert.SeverityWarning,
+						Validator: validatorAddress,
+						Height:    latestHeight,
+						Message:   fmt.Sprintf("validator has not voted at height %d", latestHeight),
+					})
 				}
 			}
-			log.Info().Int("num.validators_voted", len(foundVotes)).Int("total_validators", len(valis.Data)).Msg("checked votes")
+			countedHeight = latestHeight
+			if err := mva.alerts.Reconcile(mva.ctx, MissingVoteAnalyzerName, network, alerts); err != nil {
+				log.Error().Err(err).Str("network", network).Msg("failed to reconcile alerts")
+			}
+			log.Info().Int("num.validators_voted", len(foundVotes)).Int("total_validators", len(valis)).Msg("checked votes")
 		}
 	}
 }
@@ -0,0 +1,230 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rs/zerolog/log"
+)
+
+// the voting power observed for a single vote type within a round
+type VoteTally struct {
+	// voting power of all validators which cast a vote
+	Power int64
+	// voting power per block id voted for, nil votes are included
+	BlockPower map[string]int64
+	// block id which received more than 2/3 of the total voting power, empty if none did
+	QuorumBlockID string
+	// whether more than 2/3 of the total voting power voted for the same block id (or nil)
+	Quorum bool
+}
+
+// the prevote and precommit voting power observed for a single height and round
+type RoundQuorum struct {
+	Height     int64
+	Round      int64
+	TotalPower int64
+	Prevotes   VoteTally
+	Precommits VoteTally
+}
+
+// Computes the prevote and precommit voting power of every height and round the votes were cast for.
+// Votes from validators not in the validator set are ignored, and only the first vote of a validator
+// for a given height, round and vote type is counted
+func ComputeRoundQuorums(
+	votes []db.VoteEvent,
+	validators map[string]db.ValidatorInfo,
+) []RoundQuorum {
+	type roundKey struct {
+		height int64
+		round  int64
+	}
+	var totalPower int64
+	for _, vi := range validators {
+		totalPower += vi.VotingPower
+	}
+	rounds := make(map[roundKey]*RoundQuorum)
+	counted := make(map[roundKey]map[string]struct{})
+	for _, vote := range votes {
+		vi, ok := validators[vote.ValidatorAddress]
+		if !ok {
+			continue
+		}
+		key := roundKey{int64(vote.Height), int64(vote.Round)}
+		rq, ok := rounds[key]
+		if !ok {
+			rq = &RoundQuorum{
+				Height:     key.height,
+				Round:      key.round,
+				TotalPower: totalPower,
+				Prevotes:   VoteTally{BlockPower: make(map[string]int64)},
+				Precommits: VoteTally{BlockPower: make(map[string]int64)},
+			}
+			rounds[key] = rq
+			counted[key] = make(map[string]struct{})
+		}
+		var tally *VoteTally
+		switch vote.VoteType {
+		case cmtproto.PrevoteType.String():
+			tally = &rq.Prevotes
+		case cmtproto.PrecommitType.String():
+			tally = &rq.Precommits
+		default:
+			continue
+		}
+		countKey := vote.VoteType + vote.ValidatorAddress
+		if _, ok := counted[key][countKey]; ok {
+			continue
+		}
+		counted[key][countKey] = struct{}{}
+		tally.Power += vi.VotingPower
+		tally.BlockPower[vote.BlockID] += vi.VotingPower
+	}
+
+	quorums := make([]RoundQuorum, 0, len(rounds))
+	for _, rq := range rounds {
+		for _, tally := range []*VoteTally{&rq.Prevotes, &rq.Precommits} {
+			for blockID, power := range tally.BlockPower {
+				if HasTwoThirds(power, totalPower) {
+					tally.Quorum = true
+					if !common.IsNilBlockID(blockID) {
+						tally.QuorumBlockID = blockID
+					}
+				}
+			}
+		}
+		quorums = append(quorums, *rq)
+	}
+	sort.Slice(quorums, func(i, j int) bool {
+		if quorums[i].Height == quorums[j].Height {
+			return quorums[i].Round < quorums[j].Round
+		}
+		return quorums[i].Height < quorums[j].Height
+	})
+	return quorums
+}
+
+// returns true if power is more than 2/3 of total
+func HasTwoThirds(power int64, total int64) bool {
+	return total > 0 && power*3 > total*2
+}
+
+const QuorumAnalyzerName = "quorum"
+
+// QuorumAnalyzer tracks the voting power behind the prevotes and precommits of every round,
+// alerting when a round fails to reach +2/3 precommits for a block
+type QuorumAnalyzer struct {
+	db     db.Store
+	alerts *alert.Manager
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewQuorumAnalyzer(
+	ctx context.Context,
+	db db.Store,
+	alerts *alert.Manager,
+) *QuorumAnalyzer {
+	ctx, cancel := context.WithCancel(ctx)
+	return &QuorumAnalyzer{
+		db,
+		alerts,
+		ctx,
+		cancel,
+	}
+}
+
+// Returns the quorum of every round at the given height
+func (qa *QuorumAnalyzer) Analyze(
+	network string,
+	height int64,
+) ([]RoundQuorum, error) {
+	valis, err := validatorsAt(qa.ctx, qa.db, network, height)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := qa.db.GetVotesForHeight(qa.ctx, network, height)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeRoundQuorums(votes, valis), nil
+}
+
+func (qa *QuorumAnalyzer) Start(
+	network string,
+	pollFrequency time.Duration,
+) {
+	var lastHeight int64
+	ticker := time.NewTicker(pollFrequency)
+	for {
+		select {
+		case <-qa.ctx.Done():
+			return
+		case <-ticker.C:
+			latestHeight, err := qa.db.GetLatestVoteHeight(qa.ctx, network)
+			if err != nil {
+				log.Error().Err(err).Str("network", network).Msg("failed to query db for latest vote height")
+				continue
+			}
+			if latestHeight == 0 {
+				continue
+			}
+			// the first poll only reports on the latest height
+			if lastHeight == 0 {
+				lastHeight = latestHeight - 1
+			}
+			for height := lastHeight + 1; height <= latestHeight; height++ {
+				quorums, err := qa.Analyze(network, height)
+				if err != nil {
+					log.Error().Err(err).Str("network", network).Int64("height", height).Msg("failed to analyze quorum")
+					break
+				}
+				for _, rq := range quorums {
+					log.Info().
+						Str("network", network).
+						Int64("height", rq.Height).
+						Int64("round", rq.Round).
+						Int64("power.total", rq.TotalPower).
+						Int64("power.prevotes", rq.Prevotes.Power).
+						Int64("power.precommits", rq.Precommits.Power).
+						Bool("quorum.prevotes", rq.Prevotes.Quorum).
+						Bool("quorum.precommits", rq.Precommits.Quorum).
+						Str("quorum.block_id", rq.Precommits.QuorumBlockID).
+						Msg("checked quorum")
+				}
+				// the latest height may still be collecting votes, so it is checked again on the next poll
+				if height == latestHeight {
+					break
+				}
+				for _, rq := range quorums {
+					if rq.Precommits.QuorumBlockID == "" {
+						if err := qa.alerts.Notify(qa.ctx, alert.Alert{
+							Severity: alert.SeverityWarning,
+							Network:  network,
+							Height:   rq.Height,
+							Analyzer: QuorumAnalyzerName,
+							Subject:  fmt.Sprintf("%d/%d", rq.Height, rq.Round),
+							Message: fmt.Sprintf(
+								"round %d failed to reach +2/3 precommits for a block, precommit power %d of %d, prevote quorum %t",
+								rq.Round, rq.Precommits.Power, rq.TotalPower, rq.Prevotes.Quorum,
+							),
+						}); err != nil {
+							log.Error().Err(err).Str("network", network).Msg("failed to send alert")
+						}
+					}
+				}
+				lastHeight = height
+			}
+		}
+	}
+}
+
+func (qa *QuorumAnalyzer) Stop() {
+	qa.cancel()
+}
@@ -0,0 +1,115 @@
+package analyzer_test
+
+import (
+	"context"
+	"testing"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeRoundQuorums(t *testing.T) {
+	validators := map[string]db.ValidatorInfo{
+		"A": {VotingPower: 40},
+		"B": {VotingPower: 30},
+		"C": {VotingPower: 20},
+		"D": {VotingPower: 10},
+	}
+	blockID := "HASH:1:000000000000"
+	nilBlockID := ":0:000000000000"
+	prevote := cmtproto.PrevoteType.String()
+	precommit := cmtproto.PrecommitType.String()
+	votes := []db.VoteEvent{
+		// round 0: prevotes split, precommits for nil
+		{Height: 10, Round: 0, VoteType: prevote, ValidatorAddress: "A", BlockID: blockID},
+		{Height: 10, Round: 0, VoteType: prevote, ValidatorAddress: "B", BlockID: nilBlockID},
+		{Height: 10, Round: 0, VoteType: prevote, ValidatorAddress: "C", BlockID: blockID},
+		{Height: 10, Round: 0, VoteType: precommit, ValidatorAddress: "A", BlockID: nilBlockID},
+		{Height: 10, Round: 0, VoteType: precommit, ValidatorAddress: "B", BlockID: nilBlockID},
+		{Height: 10, Round: 0, VoteType: precommit, ValidatorAddress: "D", BlockID: nilBlockID},
+		// round 1: block committed
+		{Height: 10, Round: 1, VoteType: prevote, ValidatorAddress: "A", BlockID: blockID},
+		{Height: 10, Round: 1, VoteType: prevote, ValidatorAddress: "B", BlockID: blockID},
+		{Height: 10, Round: 1, VoteType: precommit, ValidatorAddress: "A", BlockID: blockID},
+		{Height: 10, Round: 1, VoteType: precommit, ValidatorAddress: "B", BlockID: blockID},
+		// duplicate votes are only counted once
+		{Height: 10, Round: 1, VoteType: precommit, ValidatorAddress: "B", BlockID: blockID},
+		// votes from unknown validators are ignored
+		{Height: 10, Round: 1, VoteType: precommit, ValidatorAddress: "E", BlockID: blockID},
+		{Height: 10, Round: 1, VoteType: precommit, ValidatorAddress: "C", BlockID: blockID},
+	}
+	quorums := analyzer.ComputeRoundQuorums(votes, validators)
+	require.Len(t, quorums, 2)
+
+	require.Equal(t, int64(0), quorums[0].Round)
+	require.Equal(t, int64(100), quorums[0].TotalPower)
+	require.Equal(t, int64(90), quorums[0].Prevotes.Power)
+	require.False(t, quorums[0].Prevotes.Quorum)
+	require.Equal(t, int64(60), quorums[0].Prevotes.BlockPower[blockID])
+	require.Equal(t, int64(80), quorums[0].Precommits.Power)
+	// +2/3 for nil is a quorum, but not for a block
+	require.True(t, quorums[0].Precommits.Quorum)
+	require.Equal(t, "", quorums[0].Precommits.QuorumBlockID)
+
+	require.Equal(t, int64(1), quorums[1].Round)
+	require.Equal(t, int64(70), quorums[1].Prevotes.Power)
+	require.True(t, quorums[1].Prevotes.Quorum)
+	require.Equal(t, blockID, quorums[1].Prevotes.QuorumBlockID)
+	require.Equal(t, int64(90), quorums[1].Precommits.Power)
+	require.Equal(t, blockID, quorums[1].Precommits.QuorumBlockID)
+}
+
+func TestHasTwoThirds(t *testing.T) {
+	require.False(t, analyzer.HasTwoThirds(66, 100))
+	require.True(t, analyzer.HasTwoThirds(67, 100))
+	// exactly 2/3 is not enough
+	require.False(t, analyzer.HasTwoThirds(2, 3))
+	require.False(t, analyzer.HasTwoThirds(0, 0))
+}
+
+func TestQuorumAnalyzerValidatorSetAtHeight(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+
+	require.NoError(t, database.StoreOrUpdateValidators(ctx, "osmosis", 10, map[string]interface{}{
+		"A": db.ValidatorInfo{VotingPower: 40},
+		"B": db.ValidatorInfo{VotingPower: 60},
+	}))
+	// C joins at 12, outweighing A and B
+	require.NoError(t, database.ApplyValidatorUpdates(ctx, "osmosis", 12, map[string]db.ValidatorInfo{
+		"C": {VotingPower: 200},
+	}))
+	blockID := "HASH:1:000000000000"
+	var votes []common.ParsedVote
+	for _, height := range []int64{11, 12} {
+		for _, address := range []string{"A", "B"} {
+			votes = append(votes, common.ParsedVote{
+				Type:             cmtproto.PrecommitType.String(),
+				Height:           height,
+				BlockID:          blockID,
+				ValidatorAddress: address,
+				Signature:        []byte{1},
+			})
+		}
+	}
+	require.NoError(t, database.StoreVotes(ctx, "osmosis", votes))
+
+	qa := analyzer.NewQuorumAnalyzer(ctx, database, nil)
+	quorums, err := qa.Analyze("osmosis", 11)
+	require.NoError(t, err)
+	require.Len(t, quorums, 1)
+	require.Equal(t, int64(100), quorums[0].TotalPower)
+	require.Equal(t, blockID, quorums[0].Precommits.QuorumBlockID)
+
+	quorums, err = qa.Analyze("osmosis", 12)
+	require.NoError(t, err)
+	require.Len(t, quorums, 1)
+	require.Equal(t, int64(300), quorums[0].TotalPower)
+	require.False(t, quorums[0].Precommits.Quorum)
+}
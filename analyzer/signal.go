@@ -0,0 +1,36 @@
+package analyzer
+
+import "sync"
+
+// VoteSignal wakes the analyzers of a network as soon as new votes of the network have been stored,
+// instead of leaving them to wait for their next poll
+type VoteSignal struct {
+	mu          sync.Mutex
+	subscribers map[string][]chan struct{}
+}
+
+func NewVoteSignal() *VoteSignal {
+	return &VoteSignal{subscribers: make(map[string][]chan struct{})}
+}
+
+// Returns a channel receiving a value whenever votes of the network have been stored, notifications are
+// coalesced while the subscriber is busy
+func (vs *VoteSignal) Subscribe(network string) <-chan struct{} {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	vs.subscribers[network] = append(vs.subscribers[network], ch)
+	return ch
+}
+
+// Notifies the subscribers of the network without blocking
+func (vs *VoteSignal) Notify(network string) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	for _, ch := range vs.subscribers[network] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package analyzer
+
+import (
+	"context"
+
+	"github.com/rangesecurity/ctop/db"
+)
+
+// returns the voting information of the validator set active at height, falling back to the latest stored set for
+// heights before the recorded history of the network
+func validatorsAt(ctx context.Context, store db.Store, network string, height int64) (map[string]db.ValidatorInfo, error) {
+	members, err := store.GetValidatorSetAt(ctx, network, height)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 {
+		return db.MemberInfo(members), nil
+	}
+	valis, err := store.GetValidators(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	return valis.Info(), nil
+}
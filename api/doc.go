@@ -0,0 +1,2 @@
+// Package api provides an http api serving indexed consensus data as json
+package api
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// number of events buffered per subscriber, subscribers falling further behind are disconnected
+	subscriberBuffer = 256
+	// interval at which idle connections are kept alive
+	keepAliveInterval = 15 * time.Second
+	writeTimeout      = 10 * time.Second
+)
+
+// Event is a single consensus event sent by the feed
+type Event struct {
+	Network string `json:"network"`
+	// name of the stream the event was read from, one of votes, new_round or new_round_step
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+	Data interface{} `json:"data"`
+	// moniker of the validator casting the vote or proposing the round
+	Moniker string `json:"moniker,omitempty"`
+}
+
+// Identities resolves the monikers of validators
+type Identities interface {
+	Moniker(ctx context.Context, network string, address string) string
+}
+
+// Filter selects the events sent to a subscriber, empty fields match all events
+type Filter struct {
+	Networks map[string]struct{}
+	Types    map[string]struct{}
+	// only votes cast by, and new rounds proposed by, the validator match
+	Validator string
+}
+
+// Returns true if the event passes the filter
+func (f Filter) Matches(event common.StreamEvent) bool {
+	if _, ok := f.Networks[event.Network]; len(f.Networks) > 0 && !ok {
+		return false
+	}
+	if _, ok := f.Types[event.Stream]; len(f.Types) > 0 && !ok {
+		return false
+	}
+	return f.Validator == "" || eventValidator(event) == f.Validator
+}
+
+// returns the validator casting a vote or proposing a new round, or an empty string for other events
+func eventValidator(event common.StreamEvent) string {
+	switch data := event.Data.(type) {
+	case *common.ParsedVote:
+		return data.ValidatorAddress
+	case *common.ParsedNewRound:
+		return data.ProposerAddress
+	default:
+		return ""
+	}
+}
+
+// parses the network, type and validator query parameters, network and type may be repeated
+func parseFilter(query url.Values) (Filter, error) {
+	filter := Filter{
+		Networks:  make(map[string]struct{}),
+		Types:     make(map[string]struct{}),
+		Validator: query.Get("validator"),
+	}
+	for _, network := range query["network"] {
+		filter.Networks[network] = struct{}{}
+	}
+	for _, eventType := range query["type"] {
+		switch eventType {
+		case common.StreamVotes, common.StreamNewRound, common.StreamNewRoundStep:
+			filter.Types[eventType] = struct{}{}
+		default:
+			return filter, fmt.Errorf("invalid type %q, expected one of %s, %s or %s",
+				eventType, common.StreamVotes, common.StreamNewRound, common.StreamNewRoundStep)
+		}
+	}
+	return filter, nil
+}
+
+type subscriber struct {
+	filter Filter
+	events chan Event
+}
+
+// Feed broadcasts live events to websocket and server-sent events subscribers, annotating events with the moniker
+// of their validator if identities is not nil
+type Feed struct {
+	identities  Identities
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	upgrader    websocket.Upgrader
+}
+
+// Returns a feed whose websocket endpoint accepts connections from the same host and the given origins,
+// where "*" allows any origin
+func NewFeed(identities Identities, origins []string) *Feed {
+	return &Feed{
+		identities:  identities,
+		subscribers: make(map[*subscriber]struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkOrigin(origins),
+		},
+	}
+}
+
+// returns a websocket origin check allowing requests without an origin, from the same host, or from one of origins
+func checkOrigin(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// Broadcasts events read from in until ctx is cancelled or in is closed
+func (f *Feed) Run(ctx context.Context, in <-chan common.StreamEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-in:
+			if !ok {
+				return
+			}
+			f.broadcast(ctx, event)
+		}
+	}
+}
+
+func (f *Feed) broadcast(ctx context.Context, event common.StreamEvent) {
+	out := Event{Network: event.Network, Type: event.Stream, ID: event.ID, Data: event.Data}
+	if address := eventValidator(event); address != "" && f.identities != nil {
+		out.Moniker = f.identities.Moniker(ctx, event.Network, address)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- out:
+		default:
+			// the subscriber can't keep up, closing its channel disconnects it
+			delete(f.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (f *Feed) subscribe(filter Filter) *subscriber {
+	sub := &subscriber{filter: filter, events: make(chan Event, subscriberBuffer)}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (f *Feed) unsubscribe(sub *subscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subscribers[sub]; ok {
+		delete(f.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// streams events over a websocket, each event is sent as a json text message
+func (f *Feed) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already responded with an error
+		return
+	}
+	defer conn.Close()
+	sub := f.subscribe(filter)
+	defer f.unsubscribe(sub)
+
+	// messages sent by the client are discarded, reading is required to process close and pong messages
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-sub.events:
+			if !ok {
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "subscriber too slow"),
+					time.Now().Add(writeTimeout),
+				)
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				log.Debug().Err(err).Msg("failed to write event to websocket")
+				return
+			}
+		}
+	}
+}
+
+// streams events as server-sent events, the event type is used as the name of each event
+func (f *Feed) handleSSE(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	sub := f.subscribe(filter)
+	defer f.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			encoded, err := json.Marshal(event)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to encode event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, encoded); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
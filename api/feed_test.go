@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rangesecurity/ctop/api"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed := api.NewFeed(identity.NewResolver(&store{}, time.Minute), nil)
+	events := make(chan common.StreamEvent)
+	go feed.Run(ctx, events)
+	server := httptest.NewServer(api.NewServer(&store{}, feed))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(server.URL, "http")+"/feed/ws?network=osmosis&type=votes&validator=A", nil,
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resp, err := http.Get(server.URL + "/feed/sse?network=osmosis&type=new_round_step")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// give both subscribers time to register
+	time.Sleep(100 * time.Millisecond)
+	for _, event := range []common.StreamEvent{
+		{Network: "cosmoshub", Stream: common.StreamVotes, ID: "1-0", Data: &common.ParsedVote{ValidatorAddress: "A"}},
+		{Network: "osmosis", Stream: common.StreamVotes, ID: "1-0", Data: &common.ParsedVote{ValidatorAddress: "B"}},
+		{Network: "osmosis", Stream: common.StreamNewRoundStep, ID: "2-0", Data: &common.ParsedNewRoundStep{Height: 2, Step: "RoundStepPropose"}},
+		{Network: "osmosis", Stream: common.StreamVotes, ID: "3-0", Data: &common.ParsedVote{Height: 3, ValidatorAddress: "A"}},
+	} {
+		events <- event
+	}
+
+	// only the vote of validator A on osmosis matches the websocket filter
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var wsEvent struct {
+		Network string            `json:"network"`
+		Type    string            `json:"type"`
+		ID      string            `json:"id"`
+		Data    common.ParsedVote `json:"data"`
+		Moniker string            `json:"moniker"`
+	}
+	require.NoError(t, conn.ReadJSON(&wsEvent))
+	require.Equal(t, "osmosis", wsEvent.Network)
+	require.Equal(t, common.StreamVotes, wsEvent.Type)
+	require.Equal(t, "3-0", wsEvent.ID)
+	require.Equal(t, int64(3), wsEvent.Data.Height)
+	require.Equal(t, "alice", wsEvent.Moniker)
+
+	// only the round step matches the sse filter
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	require.Equal(t, "id: 2-0", lines[0])
+	require.Equal(t, "event: new_round_step", lines[1])
+	var sseEvent struct {
+		Data common.ParsedNewRoundStep `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &sseEvent))
+	require.Equal(t, "RoundStepPropose", sseEvent.Data.Step)
+
+	invalid, err := http.Get(server.URL + "/feed/sse?type=blocks")
+	require.NoError(t, err)
+	defer invalid.Body.Close()
+	require.Equal(t, http.StatusBadRequest, invalid.StatusCode)
+}
+
+func TestFeedOrigins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed := api.NewFeed(nil, []string{"https://dashboard.example.com"})
+	go feed.Run(ctx, make(chan common.StreamEvent))
+	server := httptest.NewServer(api.NewServer(&store{}, feed))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/feed/ws"
+
+	for _, origin := range []string{"", "https://dashboard.example.com", server.URL} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		require.NoError(t, err, origin)
+		conn.Close()
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "https://evil.example.com")
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
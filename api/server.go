@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+	// duration validator identities are cached for before being reloaded from the store
+	identityCacheTTL = time.Minute
+)
+
+// Store provides the data served by the api
+type Store interface {
+	QueryVotes(ctx context.Context, network string, filter db.VoteFilter) ([]db.VoteEvent, error)
+	QueryNewRounds(ctx context.Context, network string, filter db.RoundFilter) ([]db.NewRoundEvent, error)
+	GetLatestNewRoundStep(ctx context.Context, network string) (db.NewRoundStepEvent, error)
+	GetLatestVoteHeight(ctx context.Context, network string) (int64, error)
+	GetValidators(ctx context.Context, network string) (db.Validators, error)
+	GetValidatorIdentities(ctx context.Context, network string) ([]db.ValidatorIdentity, error)
+}
+
+// Server serves the following endpoints:
+//
+//	GET /networks/{network}/status
+//	GET /networks/{network}/validators
+//	GET /networks/{network}/heights/{height}/votes
+//	GET /networks/{network}/validators/{address}/votes?from=&to=
+//	GET /networks/{network}/rounds?height=
+//	GET /feed/ws?network=&type=&validator=
+//	GET /feed/sse?network=&type=&validator=
+//
+// List endpoints accept limit and offset for pagination, from and to for height ranges, and since and until
+// (RFC3339) for time ranges. Validators are annotated with the identities stored by the validator indexer. The feed
+// endpoints are only served if a feed is given
+type Server struct {
+	store      Store
+	identities *identity.Resolver
+	mux        *http.ServeMux
+}
+
+func NewServer(store Store, feed *Feed) *Server {
+	s := &Server{
+		store:      store,
+		identities: identity.NewResolver(store, identityCacheTTL),
+		mux:        http.NewServeMux(),
+	}
+	if feed != nil {
+		s.mux.HandleFunc("GET /feed/ws", feed.handleWebsocket)
+		s.mux.HandleFunc("GET /feed/sse", feed.handleSSE)
+	}
+	s.mux.HandleFunc("GET /networks/{network}/status", s.handleStatus)
+	s.mux.HandleFunc("GET /networks/{network}/validators", s.handleValidators)
+	s.mux.HandleFunc("GET /networks/{network}/heights/{height}/votes", s.handleHeightVotes)
+	s.mux.HandleFunc("GET /networks/{network}/validators/{address}/votes", s.handleValidatorVotes)
+	s.mux.HandleFunc("GET /networks/{network}/rounds", s.handleRounds)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serves the api on addr until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	log.Info().Str("addr", addr).Msg("serving api")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	network := r.PathValue("network")
+	step, err := s.store.GetLatestNewRoundStep(r.Context(), network)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no data for network %s", network))
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	latestVoteHeight, err := s.store.GetLatestVoteHeight(r.Context(), network)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := Status{
+		Network:          network,
+		Height:           step.Height,
+		Round:            step.Round,
+		Step:             step.Step,
+		StepTime:         step.ReceivedAt,
+		LatestVoteHeight: latestVoteHeight,
+	}
+	// steps stored before the receive time was recorded only have the time they were stored at
+	if status.StepTime.IsZero() {
+		status.StepTime = step.CreatedAt
+	}
+	validators, err := s.store.GetValidators(r.Context(), network)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status.Validators = len(validators.Data)
+	status.TotalVotingPower = validators.TotalVotingPower()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// serves the latest validator set, ordered by voting power
+func (s *Server) handleValidators(w http.ResponseWriter, r *http.Request) {
+	network := r.PathValue("network")
+	validators, err := s.store.GetValidators(r.Context(), network)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no validators for network %s", network))
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	identities := s.identities.Identities(r.Context(), network)
+	items := make([]Validator, 0, len(validators.Data))
+	for address, info := range validators.Info() {
+		items = append(items, toValidator(address, info, identities[address]))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].VotingPower != items[j].VotingPower {
+			return items[i].VotingPower > items[j].VotingPower
+		}
+		return items[i].Address < items[j].Address
+	})
+	writeJSON(w, http.StatusOK, ValidatorSet{Network: network, Height: validators.Height, Validators: items})
+}
+
+func (s *Server) handleHeightVotes(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseInt(r.PathValue("height"), 10, 64)
+	if err != nil || height < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid height %q", r.PathValue("height")))
+		return
+	}
+	filter, err := parseVoteFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.Heights = db.HeightRange{From: height, To: height}
+	s.writeVotes(w, r, filter)
+}
+
+func (s *Server) handleValidatorVotes(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseVoteFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.Validator = r.PathValue("address")
+	s.writeVotes(w, r, filter)
+}
+
+func (s *Server) writeVotes(w http.ResponseWriter, r *http.Request, filter db.VoteFilter) {
+	votes, err := s.store.QueryVotes(r.Context(), r.PathValue("network"), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	monikers := s.identities.Monikers(r.Context(), r.PathValue("network"))
+	page := Page[Vote]{Items: make([]Vote, 0, len(votes)), Limit: filter.Page.Limit, Offset: filter.Page.Offset}
+	for _, vote := range votes {
+		page.Items = append(page.Items, toVote(vote, monikers))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleRounds(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var (
+		filter db.RoundFilter
+		err    error
+	)
+	if filter.Page, err = parsePage(query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Heights, err = parseHeightRange(query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Times, err = parseTimeRange(query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rounds, err := s.store.QueryNewRounds(r.Context(), r.PathValue("network"), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	monikers := s.identities.Monikers(r.Context(), r.PathValue("network"))
+	page := Page[Round]{Items: make([]Round, 0, len(rounds)), Limit: filter.Page.Limit, Offset: filter.Page.Offset}
+	for _, round := range rounds {
+		page.Items = append(page.Items, toRound(round, monikers))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func parseVoteFilter(query url.Values) (filter db.VoteFilter, err error) {
+	if filter.Page, err = parsePage(query); err != nil {
+		return
+	}
+	if filter.Heights, err = parseHeightRange(query); err != nil {
+		return
+	}
+	filter.Times, err = parseTimeRange(query)
+	return
+}
+
+func parsePage(query url.Values) (db.Page, error) {
+	page := db.Page{Limit: DefaultLimit}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > MaxLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		page.Limit = value
+	}
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return page, fmt.Errorf("invalid offset %q", offset)
+		}
+		page.Offset = value
+	}
+	return page, nil
+}
+
+// parses the from and to heights, height selects a single height
+func parseHeightRange(query url.Values) (db.HeightRange, error) {
+	var heights db.HeightRange
+	for _, bound := range []struct {
+		param string
+		value *int64
+	}{
+		{"from", &heights.From},
+		{"to", &heights.To},
+	} {
+		if param := query.Get(bound.param); param != "" {
+			value, err := strconv.ParseInt(param, 10, 64)
+			if err != nil || value < 1 {
+				return heights, fmt.Errorf("invalid %s height %q", bound.param, param)
+			}
+			*bound.value = value
+		}
+	}
+	if param := query.Get("height"); param != "" {
+		value, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || value < 1 {
+			return heights, fmt.Errorf("invalid height %q", param)
+		}
+		heights = db.HeightRange{From: value, To: value}
+	}
+	if heights.From != 0 && heights.To != 0 && heights.From > heights.To {
+		return heights, fmt.Errorf("from height %d is after to height %d", heights.From, heights.To)
+	}
+	return heights, nil
+}
+
+func parseTimeRange(query url.Values) (db.TimeRange, error) {
+	var times db.TimeRange
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{
+		{"since", &times.From},
+		{"until", &times.To},
+	} {
+		if param := query.Get(bound.param); param != "" {
+			value, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				return times, fmt.Errorf("invalid %s time %q, expected RFC3339", bound.param, param)
+			}
+			*bound.value = value
+		}
+	}
+	if !times.From.IsZero() && !times.To.IsZero() && times.From.After(times.To) {
+		return times, fmt.Errorf("since time %s is after until time %s", times.From.Format(time.RFC3339), times.To.Format(time.RFC3339))
+	}
+	return times, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Error().Err(err).Msg("failed to handle request")
+	}
+	writeJSON(w, status, Error{Error: err.Error()})
+}
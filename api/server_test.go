@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/api"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/stretchr/testify/require"
+)
+
+// in memory Store recording the filters it is queried with
+type store struct {
+	votes       []db.VoteEvent
+	rounds      []db.NewRoundEvent
+	voteFilter  db.VoteFilter
+	roundFilter db.RoundFilter
+}
+
+func (s *store) QueryVotes(ctx context.Context, network string, filter db.VoteFilter) ([]db.VoteEvent, error) {
+	s.voteFilter = filter
+	return s.votes, nil
+}
+
+func (s *store) QueryNewRounds(ctx context.Context, network string, filter db.RoundFilter) ([]db.NewRoundEvent, error) {
+	s.roundFilter = filter
+	return s.rounds, nil
+}
+
+func (s *store) GetLatestNewRoundStep(ctx context.Context, network string) (db.NewRoundStepEvent, error) {
+	if network != "osmosis" {
+		return db.NewRoundStepEvent{}, sql.ErrNoRows
+	}
+	return db.NewRoundStepEvent{
+		Network:    network,
+		Height:     100,
+		Round:      1,
+		Step:       "RoundStepPrevote",
+		ReceivedAt: time.Unix(100, 0).UTC(),
+		CreatedAt:  time.Unix(101, 0).UTC(),
+	}, nil
+}
+
+func (s *store) GetLatestVoteHeight(ctx context.Context, network string) (int64, error) {
+	return 100, nil
+}
+
+func (s *store) GetValidators(ctx context.Context, network string) (db.Validators, error) {
+	if network != "osmosis" {
+		return db.Validators{}, sql.ErrNoRows
+	}
+	return db.Validators{Network: network, Height: 99, Data: map[string]interface{}{
+		"A": map[string]interface{}{"voting_power": 10},
+		"B": map[string]interface{}{"voting_power": 20},
+	}}, nil
+}
+
+func (s *store) GetValidatorIdentities(ctx context.Context, network string) ([]db.ValidatorIdentity, error) {
+	if network != "osmosis" {
+		return nil, nil
+	}
+	return []db.ValidatorIdentity{{Network: network, Address: "A", Moniker: "alice", OperatorAddress: "osmovaloper1qqqq"}}, nil
+}
+
+func get(t *testing.T, server *api.Server, path string, status int, out interface{}) {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, status, recorder.Code, recorder.Body.String())
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), out))
+}
+
+func TestServer(t *testing.T) {
+	s := &store{
+		votes:  []db.VoteEvent{{Height: 100, Round: 0, VoteType: "SIGNED_MSG_TYPE_PREVOTE", ValidatorAddress: "A"}},
+		rounds: []db.NewRoundEvent{{Height: 100, Round: 0, ValidatorAddress: "A"}},
+	}
+	server := api.NewServer(s, nil)
+
+	var status api.Status
+	get(t, server, "/networks/osmosis/status", http.StatusOK, &status)
+	require.Equal(t, 100, status.Height)
+	require.Equal(t, "RoundStepPrevote", status.Step)
+	require.Equal(t, time.Unix(100, 0).UTC(), status.StepTime)
+	require.Equal(t, 2, status.Validators)
+	require.Equal(t, int64(30), status.TotalVotingPower)
+
+	var apiErr api.Error
+	get(t, server, "/networks/cosmoshub/status", http.StatusNotFound, &apiErr)
+	require.NotEmpty(t, apiErr.Error)
+
+	var votes api.Page[api.Vote]
+	get(t, server, "/networks/osmosis/heights/100/votes?limit=10&offset=5", http.StatusOK, &votes)
+	require.Len(t, votes.Items, 1)
+	require.Equal(t, "A", votes.Items[0].Validator)
+	require.Equal(t, "alice", votes.Items[0].Moniker)
+	require.Equal(t, db.HeightRange{From: 100, To: 100}, s.voteFilter.Heights)
+	require.Equal(t, db.Page{Limit: 10, Offset: 5}, s.voteFilter.Page)
+
+	get(t, server, "/networks/osmosis/validators/A/votes?from=90&to=100&since=2024-01-01T00:00:00Z", http.StatusOK, &votes)
+	require.Equal(t, "A", s.voteFilter.Validator)
+	require.Equal(t, db.HeightRange{From: 90, To: 100}, s.voteFilter.Heights)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), s.voteFilter.Times.From)
+	require.Equal(t, db.Page{Limit: api.DefaultLimit}, s.voteFilter.Page)
+
+	var rounds api.Page[api.Round]
+	get(t, server, "/networks/osmosis/rounds?height=100", http.StatusOK, &rounds)
+	require.Len(t, rounds.Items, 1)
+	require.Equal(t, "A", rounds.Items[0].Proposer)
+	require.Equal(t, "alice", rounds.Items[0].ProposerMoniker)
+	require.Equal(t, db.HeightRange{From: 100, To: 100}, s.roundFilter.Heights)
+
+	var set api.ValidatorSet
+	get(t, server, "/networks/osmosis/validators", http.StatusOK, &set)
+	require.Equal(t, int64(99), set.Height)
+	require.Equal(t, []api.Validator{
+		{Address: "B", VotingPower: 20},
+		{Address: "A", VotingPower: 10, Moniker: "alice", OperatorAddress: "osmovaloper1qqqq"},
+	}, set.Validators)
+	get(t, server, "/networks/cosmoshub/validators", http.StatusNotFound, &apiErr)
+
+	get(t, server, "/networks/osmosis/heights/abc/votes", http.StatusBadRequest, &apiErr)
+	get(t, server, "/networks/osmosis/rounds?limit=100000", http.StatusBadRequest, &apiErr)
+	get(t, server, "/networks/osmosis/rounds?since=yesterday", http.StatusBadRequest, &apiErr)
+	get(t, server, "/networks/osmosis/validators/A/votes?from=100&to=90", http.StatusBadRequest, &apiErr)
+	get(t, server, "/networks/osmosis/rounds?since=2024-01-02T00:00:00Z&until=2024-01-01T00:00:00Z", http.StatusBadRequest, &apiErr)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"time"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+)
+
+type Vote struct {
+	Height         int       `json:"height"`
+	Round          int       `json:"round"`
+	Type           string    `json:"type"`
+	BlockID        string    `json:"block_id"`
+	Timestamp      time.Time `json:"timestamp"`
+	Validator      string    `json:"validator"`
+	Moniker        string    `json:"moniker,omitempty"`
+	ValidatorIndex int       `json:"validator_index"`
+	Signature      []byte    `json:"signature"`
+}
+
+type Round struct {
+	Height          int       `json:"height"`
+	Round           int       `json:"round"`
+	Step            string    `json:"step"`
+	Proposer        string    `json:"proposer"`
+	ProposerMoniker string    `json:"proposer_moniker,omitempty"`
+	ProposerIndex   int       `json:"proposer_index"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type Validator struct {
+	Address          string `json:"address"`
+	VotingPower      int64  `json:"voting_power"`
+	ProposerPriority int64  `json:"proposer_priority"`
+	PubKey           string `json:"pub_key,omitempty"`
+	Moniker          string `json:"moniker,omitempty"`
+	ValconsAddress   string `json:"valcons_address,omitempty"`
+	OperatorAddress  string `json:"operator_address,omitempty"`
+	Website          string `json:"website,omitempty"`
+}
+
+type ValidatorSet struct {
+	Network    string      `json:"network"`
+	Height     int64       `json:"height"`
+	Validators []Validator `json:"validators"`
+}
+
+type Status struct {
+	Network          string    `json:"network"`
+	Height           int       `json:"height"`
+	Round            int       `json:"round"`
+	Step             string    `json:"step"`
+	StepTime         time.Time `json:"step_time"`
+	LatestVoteHeight int64     `json:"latest_vote_height"`
+	Validators       int       `json:"validators"`
+	TotalVotingPower int64     `json:"total_voting_power"`
+}
+
+// Page is the response of endpoints returning lists
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+func toVote(vote db.VoteEvent, monikers map[string]string) Vote {
+	return Vote{
+		Height:         vote.Height,
+		Round:          vote.Round,
+		Type:           vote.VoteType,
+		BlockID:        vote.BlockID,
+		Timestamp:      vote.BlockTimestamp,
+		Validator:      vote.ValidatorAddress,
+		Moniker:        monikers[vote.ValidatorAddress],
+		ValidatorIndex: vote.ValidatorIndex,
+		Signature:      vote.ValidatorSignature,
+	}
+}
+
+func toRound(round db.NewRoundEvent, monikers map[string]string) Round {
+	return Round{
+		Height:          round.Height,
+		Round:           round.Round,
+		Step:            round.Step,
+		Proposer:        round.ValidatorAddress,
+		ProposerMoniker: monikers[round.ValidatorAddress],
+		ProposerIndex:   round.ValidatorIndex,
+		CreatedAt:       round.CreatedAt,
+	}
+}
+
+func toValidator(address string, info db.ValidatorInfo, id identity.Identity) Validator {
+	return Validator{
+		Address:          address,
+		VotingPower:      info.VotingPower,
+		ProposerPriority: info.ProposerPriority,
+		PubKey:           info.PubKey,
+		Moniker:          id.Moniker,
+		ValconsAddress:   id.ValconsAddress,
+		OperatorAddress:  id.OperatorAddress,
+		Website:          id.Website,
+	}
+}
@@ -0,0 +1 @@
+DROP INDEX idx_vote_events_network_height;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX idx_vote_events_network_height ON vote_events (network, height);
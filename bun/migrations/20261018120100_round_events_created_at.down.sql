@@ -0,0 +1,13 @@
+DROP INDEX idx_new_round_events_network_height;
+
+--bun:split
+
+DROP INDEX idx_new_round_step_events_network_height;
+
+--bun:split
+
+ALTER TABLE new_round_step_events DROP COLUMN created_at;
+
+--bun:split
+
+ALTER TABLE new_round_events DROP COLUMN created_at;
\ No newline at end of file
@@ -0,0 +1,13 @@
+ALTER TABLE new_round_events ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+--bun:split
+
+ALTER TABLE new_round_step_events ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+--bun:split
+
+CREATE INDEX idx_new_round_step_events_network_height ON new_round_step_events (network, height);
+
+--bun:split
+
+CREATE INDEX idx_new_round_events_network_height ON new_round_events (network, height);
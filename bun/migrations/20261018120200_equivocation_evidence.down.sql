@@ -0,0 +1 @@
+DROP TABLE equivocation_evidence;
\ No newline at end of file
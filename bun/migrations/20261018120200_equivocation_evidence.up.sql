@@ -0,0 +1,18 @@
+CREATE TABLE equivocation_evidence (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    validator_address TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    vote_type TEXT NOT NULL,
+    vote_a_id UUID NOT NULL,
+    vote_a_block_id TEXT NOT NULL,
+    vote_a_timestamp TIMESTAMPTZ NOT NULL,
+    vote_a_signature BYTEA NOT NULL,
+    vote_b_id UUID NOT NULL,
+    vote_b_block_id TEXT NOT NULL,
+    vote_b_timestamp TIMESTAMPTZ NOT NULL,
+    vote_b_signature BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (network, validator_address, height, round, vote_type)
+);
@@ -0,0 +1 @@
+DROP TABLE alert_states;
\ No newline at end of file
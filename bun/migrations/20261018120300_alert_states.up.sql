@@ -0,0 +1,17 @@
+CREATE TABLE alert_states (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    analyzer TEXT NOT NULL,
+    network TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    status TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    validator TEXT NOT NULL,
+    height BIGINT NOT NULL,
+    message TEXT NOT NULL,
+    occurrences INTEGER NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    last_notified TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (analyzer, network, subject)
+);
@@ -0,0 +1,5 @@
+DROP TABLE round_state_events;
+
+--bun:split
+
+DROP TABLE complete_proposal_events;
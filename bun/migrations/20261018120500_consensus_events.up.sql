@@ -0,0 +1,29 @@
+CREATE TABLE complete_proposal_events (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    step TEXT NOT NULL,
+    block_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE INDEX idx_complete_proposal_events_network_height ON complete_proposal_events (network, height);
+
+--bun:split
+
+CREATE TABLE round_state_events (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    step TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE INDEX idx_round_state_events_network_height ON round_state_events (network, height);
@@ -0,0 +1,12 @@
+CREATE TABLE blocks (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    height BIGINT NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    proposer_address TEXT NOT NULL,
+    num_txs INTEGER,
+    commit_round INTEGER,
+    last_commit_signers TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (network, height)
+);
@@ -0,0 +1,5 @@
+DROP TABLE validator_set_changes;
+
+--bun:split
+
+ALTER TABLE validators DROP COLUMN height;
@@ -0,0 +1,17 @@
+ALTER TABLE validators ADD COLUMN height BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE validator_set_changes (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    height BIGINT NOT NULL,
+    validator_address TEXT NOT NULL,
+    voting_power BIGINT NOT NULL,
+    previous_voting_power BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE INDEX idx_validator_set_changes_network_height ON validator_set_changes (network, height);
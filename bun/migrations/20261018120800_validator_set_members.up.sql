@@ -0,0 +1,31 @@
+CREATE TABLE validator_set_members (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    validator_address TEXT NOT NULL,
+    pub_key TEXT,
+    voting_power BIGINT NOT NULL,
+    valid_from_height BIGINT NOT NULL,
+    valid_to_height BIGINT
+);
+
+--bun:split
+
+CREATE INDEX idx_validator_set_members_network_heights ON validator_set_members (network, valid_from_height, valid_to_height);
+
+--bun:split
+
+INSERT INTO validator_set_members (network, validator_address, voting_power, valid_from_height)
+SELECT validators.network, data.key, COALESCE((data.value->>'voting_power')::BIGINT, 0), validators.height
+FROM validators, jsonb_each(validators.data) AS data;
+
+--bun:split
+
+ALTER TABLE validator_set_changes ADD COLUMN kind TEXT NOT NULL DEFAULT '';
+
+--bun:split
+
+UPDATE validator_set_changes SET kind = CASE
+    WHEN previous_voting_power = 0 THEN 'join'
+    WHEN voting_power = 0 THEN 'leave'
+    ELSE 'power'
+END;
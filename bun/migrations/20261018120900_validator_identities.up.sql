@@ -0,0 +1,11 @@
+CREATE TABLE validator_identities (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    network TEXT NOT NULL,
+    address TEXT NOT NULL,
+    valcons_address TEXT,
+    operator_address TEXT,
+    moniker TEXT,
+    website TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (network, address)
+);
@@ -0,0 +1 @@
+ALTER TABLE new_round_step_events DROP COLUMN received_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE complete_proposal_events DROP COLUMN received_at;
+
+--bun:split
+
+ALTER TABLE round_state_events DROP COLUMN received_at;
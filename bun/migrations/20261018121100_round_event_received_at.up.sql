@@ -0,0 +1,5 @@
+ALTER TABLE complete_proposal_events ADD COLUMN received_at TIMESTAMPTZ;
+
+--bun:split
+
+ALTER TABLE round_state_events ADD COLUMN received_at TIMESTAMPTZ;
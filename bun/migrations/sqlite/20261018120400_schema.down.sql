@@ -0,0 +1,21 @@
+DROP TABLE alert_states;
+
+--bun:split
+
+DROP TABLE equivocation_evidence;
+
+--bun:split
+
+DROP TABLE validators;
+
+--bun:split
+
+DROP TABLE new_round_step_events;
+
+--bun:split
+
+DROP TABLE new_round_events;
+
+--bun:split
+
+DROP TABLE vote_events;
@@ -0,0 +1,101 @@
+CREATE TABLE vote_events (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    vote_type TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    block_id TEXT NOT NULL,
+    block_timestamp TIMESTAMP NOT NULL,
+    validator_address TEXT NOT NULL,
+    validator_index INTEGER NOT NULL,
+    validator_signature BLOB NOT NULL
+);
+
+--bun:split
+
+CREATE INDEX idx_vote_events_validator_network_height ON vote_events (validator_address, network, height);
+
+--bun:split
+
+CREATE INDEX idx_vote_events_network_height ON vote_events (network, height);
+
+--bun:split
+
+CREATE TABLE new_round_events (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    step TEXT NOT NULL,
+    validator_address TEXT NOT NULL,
+    validator_index INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+--bun:split
+
+CREATE INDEX idx_new_round_events_network_height ON new_round_events (network, height);
+
+--bun:split
+
+CREATE TABLE new_round_step_events (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    step TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+--bun:split
+
+CREATE INDEX idx_new_round_step_events_network_height ON new_round_step_events (network, height);
+
+--bun:split
+
+CREATE TABLE validators (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL UNIQUE,
+    data TEXT NOT NULL
+);
+
+--bun:split
+
+CREATE TABLE equivocation_evidence (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    validator_address TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    vote_type TEXT NOT NULL,
+    vote_a_id TEXT NOT NULL,
+    vote_a_block_id TEXT NOT NULL,
+    vote_a_timestamp TIMESTAMP NOT NULL,
+    vote_a_signature BLOB NOT NULL,
+    vote_b_id TEXT NOT NULL,
+    vote_b_block_id TEXT NOT NULL,
+    vote_b_timestamp TIMESTAMP NOT NULL,
+    vote_b_signature BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (network, validator_address, height, round, vote_type)
+);
+
+--bun:split
+
+CREATE TABLE alert_states (
+    id TEXT NOT NULL PRIMARY KEY,
+    analyzer TEXT NOT NULL,
+    network TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    status TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    validator TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    occurrences INTEGER NOT NULL,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    last_notified TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    UNIQUE (analyzer, network, subject)
+);
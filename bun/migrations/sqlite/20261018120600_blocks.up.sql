@@ -0,0 +1,12 @@
+CREATE TABLE blocks (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    time TIMESTAMP NOT NULL,
+    proposer_address TEXT NOT NULL,
+    num_txs INTEGER,
+    commit_round INTEGER,
+    last_commit_signers TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (network, height)
+);
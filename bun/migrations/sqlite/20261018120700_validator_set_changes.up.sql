@@ -0,0 +1,17 @@
+ALTER TABLE validators ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE validator_set_changes (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    validator_address TEXT NOT NULL,
+    voting_power INTEGER NOT NULL,
+    previous_voting_power INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+--bun:split
+
+CREATE INDEX idx_validator_set_changes_network_height ON validator_set_changes (network, height);
@@ -0,0 +1,5 @@
+ALTER TABLE validator_set_changes DROP COLUMN kind;
+
+--bun:split
+
+DROP TABLE validator_set_members;
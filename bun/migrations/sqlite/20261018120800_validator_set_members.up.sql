@@ -0,0 +1,31 @@
+CREATE TABLE validator_set_members (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    validator_address TEXT NOT NULL,
+    pub_key TEXT,
+    voting_power INTEGER NOT NULL,
+    valid_from_height INTEGER NOT NULL,
+    valid_to_height INTEGER
+);
+
+--bun:split
+
+CREATE INDEX idx_validator_set_members_network_heights ON validator_set_members (network, valid_from_height, valid_to_height);
+
+--bun:split
+
+INSERT INTO validator_set_members (id, network, validator_address, voting_power, valid_from_height)
+SELECT lower(hex(randomblob(16))), validators.network, data.key, CASE WHEN data.type = 'object' THEN COALESCE(json_extract(data.value, '$.voting_power'), 0) ELSE 0 END, validators.height
+FROM validators, json_each(validators.data) AS data;
+
+--bun:split
+
+ALTER TABLE validator_set_changes ADD COLUMN kind TEXT NOT NULL DEFAULT '';
+
+--bun:split
+
+UPDATE validator_set_changes SET kind = CASE
+    WHEN previous_voting_power = 0 THEN 'join'
+    WHEN voting_power = 0 THEN 'leave'
+    ELSE 'power'
+END;
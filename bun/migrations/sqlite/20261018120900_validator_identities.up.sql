@@ -0,0 +1,11 @@
+CREATE TABLE validator_identities (
+    id TEXT NOT NULL PRIMARY KEY,
+    network TEXT NOT NULL,
+    address TEXT NOT NULL,
+    valcons_address TEXT,
+    operator_address TEXT,
+    moniker TEXT,
+    website TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (network, address)
+);
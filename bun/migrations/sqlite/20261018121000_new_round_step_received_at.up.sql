@@ -0,0 +1 @@
+ALTER TABLE new_round_step_events ADD COLUMN received_at TIMESTAMP;
\ No newline at end of file
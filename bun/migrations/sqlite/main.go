@@ -0,0 +1,19 @@
+// Package sqlite provides the migrations of the sqlite database used in embedded mode
+package sqlite
+
+import (
+	"embed"
+
+	"github.com/uptrace/bun/migrate"
+)
+
+var Migrations = migrate.NewMigrations()
+
+//go:embed *.sql
+var sqlMigrations embed.FS
+
+func init() {
+	if err := Migrations.Discover(sqlMigrations); err != nil {
+		panic(err)
+	}
+}
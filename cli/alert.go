@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/urfave/cli/v2"
+)
+
+// flags configuring where alerts raised by analyzers are sent
+func alertFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "alert.webhook",
+			Usage:   "url to POST alerts to as JSON, may be specified multiple times",
+			EnvVars: []string{"CTOP_ALERT_WEBHOOK"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "alert.slack",
+			Usage:   "slack compatible incoming webhook url to send alerts to, may be specified multiple times",
+			EnvVars: []string{"CTOP_ALERT_SLACK"},
+		},
+		&cli.BoolFlag{
+			Name:    "alert.stdout",
+			Usage:   "write alerts to stdout as JSON lines",
+			EnvVars: []string{"CTOP_ALERT_STDOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "alert.renotify",
+			Usage:   "interval at which alerts which are still firing are sent again, 0 disables renotification",
+			Value:   time.Hour,
+			EnvVars: []string{"CTOP_ALERT_RENOTIFY"},
+		},
+		&cli.IntFlag{
+			Name: "alert.group",
+			Usage: "send alerts of an analyzer and network which change status at once as a single notification " +
+				"when there are at least this many, 0 disables grouping",
+			Value:   3,
+			EnvVars: []string{"CTOP_ALERT_GROUP"},
+		},
+	}
+}
+
+// builds an alert manager tracking alert state in the database and sending alerts to the configured sinks, with
+// the monikers stored by the validator indexer
+func alertManager(c *cli.Context, database db.Store) *alert.Manager {
+	return alert.NewManager(
+		database,
+		alertSink(c),
+		c.Duration("alert.renotify"),
+		c.Int("alert.group"),
+		identity.NewResolver(database, identityCacheTTL),
+	)
+}
+
+// builds the alert sink configured by alertFlags, alerts are logged if no sink is configured
+func alertSink(c *cli.Context) alert.AlertSink {
+	var sinks alert.MultiSink
+	for _, url := range c.StringSlice("alert.webhook") {
+		sinks = append(sinks, alert.NewWebhookSink(url))
+	}
+	for _, url := range c.StringSlice("alert.slack") {
+		sinks = append(sinks, alert.NewSlackSink(url))
+	}
+	if c.Bool("alert.stdout") {
+		sinks = append(sinks, alert.NewStdoutSink())
+	}
+	if len(sinks) == 0 {
+		return alert.LogSink{}
+	}
+	return sinks
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"github.com/rangesecurity/ctop/api"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func APICommand() *cli.Command {
+	return &cli.Command{
+		Name:  "api",
+		Usage: "Serve indexed consensus data over a json http api",
+		Flags: []cli.Flag{
+			dbURLFlag(),
+			&cli.StringFlag{
+				Name:    "listen.addr",
+				Usage:   "address to serve the api on",
+				Value:   ":8080",
+				EnvVars: []string{"CTOP_LISTEN_ADDR"},
+			},
+			redisURLFlag(),
+			&cli.StringSliceFlag{
+				Name:  "feed.networks",
+				Usage: "networks to serve a live feed of events for, the feed is disabled if none are given",
+			},
+			&cli.StringSliceFlag{
+				Name:  "feed.origins",
+				Usage: "origins allowed to open feed websockets besides the api's own host, \"*\" allows any origin",
+			},
+		},
+		Before: withConfig(applyConfig),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signalContext(c.Context)
+			defer cancel()
+			database, err := db.New(c.String("db.url"))
+			if err != nil {
+				return err
+			}
+
+			var feed *api.Feed
+			if networks := c.StringSlice("feed.networks"); len(networks) > 0 {
+				tail, err := service.NewEventTail(ctx, c.String("redis.url"))
+				if err != nil {
+					return err
+				}
+				defer tail.Close()
+				events := make(chan common.StreamEvent, 1024)
+				go func() {
+					if err := tail.Tail(networks, events); err != nil {
+						log.Error().Err(err).Msg("failed to tail event streams")
+					}
+				}()
+				feed = api.NewFeed(identity.NewResolver(database, identityCacheTTL), c.StringSlice("feed.origins"))
+				go feed.Run(ctx, events)
+			}
+
+			return api.NewServer(database, feed).ListenAndServe(ctx, c.String("listen.addr"))
+		},
+	}
+}
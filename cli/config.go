@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rangesecurity/ctop/config"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	configMetadataKey = "config"
+	// duration validator identities are cached for before being reloaded from the database
+	identityCacheTTL = time.Minute
+)
+
+func configFlag() cli.Flag {
+	return &cli.PathFlag{
+		Name:    "config",
+		Usage:   "yaml configuration file, flags and environment variables take precedence over it",
+		EnvVars: []string{"CTOP_CONFIG"},
+	}
+}
+
+// loads the configuration file given by --config, returning nil if no file is given
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	path := c.Path("config")
+	if path == "" {
+		return nil, nil
+	}
+	if cfg, ok := c.App.Metadata[configMetadataKey].(*config.Config); ok {
+		return cfg, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.App.Metadata == nil {
+		c.App.Metadata = make(map[string]interface{})
+	}
+	c.App.Metadata[configMetadataKey] = cfg
+	return cfg, nil
+}
+
+// returns the validator identities configured for each network, or nil if no configuration file is given
+func identityOverrides(c *cli.Context) map[string][]identity.Identity {
+	cfg, _ := loadConfig(c)
+	if cfg == nil {
+		return nil
+	}
+	overrides := make(map[string][]identity.Identity, len(cfg.Networks))
+	for _, network := range cfg.Networks {
+		for _, override := range network.Identities {
+			overrides[network.Name] = append(overrides[network.Name], identity.Identity{
+				Address:         override.Address,
+				OperatorAddress: override.OperatorAddress,
+				Moniker:         override.Moniker,
+				Website:         override.Website,
+			})
+		}
+	}
+	return overrides
+}
+
+// returns the chain id configured for each network, or nil if no configuration file is given
+func chainIDs(c *cli.Context) map[string]string {
+	cfg, _ := loadConfig(c)
+	if cfg == nil {
+		return nil
+	}
+	ids := make(map[string]string, len(cfg.Networks))
+	for _, network := range cfg.Networks {
+		if network.ChainID != "" {
+			ids[network.Name] = network.ChainID
+		}
+	}
+	return ids
+}
+
+// returns a before func which sets flags of the command that were given neither on the command line
+// nor through the environment from the configuration file
+func withConfig(appliers ...func(c *cli.Context, cfg *config.Config) error) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		cfg, err := loadConfig(c)
+		if err != nil || cfg == nil {
+			return err
+		}
+		for _, apply := range appliers {
+			if err := apply(c, cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// sets the flags shared by multiple commands, flags the command doesn't define are skipped
+func applyConfig(c *cli.Context, cfg *config.Config) error {
+	values := map[string][]string{
+		"db.url":           {cfg.Database.URL},
+		"redis.url":        {cfg.Redis.URL},
+		"redis.group":      {cfg.Redis.Group},
+		"redis.consumer":   {cfg.Redis.Consumer},
+		"redis.claim.idle": {durationValue(cfg.Redis.ClaimIdle)},
+		"metrics.addr":     {cfg.Metrics.Addr},
+		"listen.addr":      {cfg.API.Addr},
+		"feed.networks":    cfg.API.FeedNetworks,
+		"feed.origins":     cfg.API.FeedOrigins,
+		"alert.webhook":    cfg.Alerts.Webhooks,
+		"alert.slack":      cfg.Alerts.Slack,
+		"alert.renotify":   {durationValue(cfg.Alerts.Renotify)},
+		"alert.group":      {intValue(cfg.Alerts.Group)},
+	}
+	if cfg.Alerts.Stdout {
+		values["alert.stdout"] = []string{"true"}
+	}
+	for name, value := range values {
+		if err := setFromConfig(c, name, value...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sets --networks to pairs of (network_name, network_url) for every configured endpoint
+func applyNetworkEndpoints(c *cli.Context, cfg *config.Config) error {
+	var pairs []string
+	for _, network := range cfg.Networks {
+		for _, url := range network.RPC {
+			pairs = append(pairs, network.Name, url)
+		}
+	}
+	return setFromConfig(c, "networks", pairs...)
+}
+
+// sets --networks to the names of all configured networks, and the batch sizes of the redis event stream
+func applyNetworkNames(c *cli.Context, cfg *config.Config) error {
+	if err := setFromConfig(c, "networks", cfg.NetworkNames()...); err != nil {
+		return err
+	}
+	return applyBatchSizes(c, cfg)
+}
+
+// sets --batch.sizes to the batch sizes of all networks configuring one
+func applyBatchSizes(c *cli.Context, cfg *config.Config) error {
+	var sizes []string
+	for _, network := range cfg.Networks {
+		if network.BatchSize > 0 {
+			sizes = append(sizes, network.Name, fmt.Sprint(network.BatchSize))
+		}
+	}
+	return setFromConfig(c, "batch.sizes", sizes...)
+}
+
+// sets the poll frequency and thresholds of an analyzer from the configuration of the analyzed network
+func applyAnalyzerConfig(c *cli.Context, cfg *config.Config) error {
+	network, ok := cfg.Network(c.String("network"))
+	if !ok {
+		return nil
+	}
+	var maxRounds string
+	if network.Analyzers.MaxRounds > 0 {
+		maxRounds = fmt.Sprint(network.Analyzers.MaxRounds)
+	}
+	for name, value := range map[string]string{
+		"poll.frequency":   durationValue(network.PollInterval),
+		"height.threshold": durationValue(network.Analyzers.HeightThreshold),
+		"max.rounds":       maxRounds,
+	} {
+		if err := setFromConfig(c, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sets a flag of the command unless it is already set, or the configured value is empty
+func setFromConfig(c *cli.Context, name string, values ...string) error {
+	if !hasFlag(c, name) || c.IsSet(name) {
+		return nil
+	}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("invalid config value for %s %+v", name, err)
+		}
+	}
+	return nil
+}
+
+func hasFlag(c *cli.Context, name string) bool {
+	if c.Command == nil {
+		return false
+	}
+	for _, flag := range c.Command.Flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func intValue(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return fmt.Sprint(i)
+}
+
+func durationValue(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
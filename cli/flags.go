@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"github.com/rangesecurity/ctop/service"
+	"github.com/urfave/cli/v2"
+)
+
+// the password is expected to be given through --db.url, CTOP_DB_URL or the configuration file
+const defaultDBURL = "postgres://postgres@localhost:5432/ctop"
+
+func dbURLFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "db.url",
+		Usage:   "url of postgres database, or sqlite://<path> for a sqlite database",
+		Value:   defaultDBURL,
+		EnvVars: []string{"CTOP_DB_URL"},
+	}
+}
+
+func redisURLFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "redis.url",
+		Usage:   "address of redis server",
+		Value:   "localhost:6379",
+		EnvVars: []string{"CTOP_REDIS_URL"},
+	}
+}
+
+// flag of pairs of (network_name, network_url), a network may be given multiple times
+func networkEndpointsFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:    "networks",
+		Usage:   "pair of (network_name, network_url) specifying networks to connect to",
+		EnvVars: []string{"CTOP_NETWORKS"},
+	}
+}
+
+func fullBlocksFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name: "blocks.full",
+		Usage: "subscribe to NewBlock instead of NewBlockHeader events, recording the tx count and last commit " +
+			"signers of blocks. NewBlock events carry every tx of the block, so they are much larger than headers",
+	}
+}
+
+func connectorOptions(c *cli.Context) service.ConnectorOptions {
+	return service.ConnectorOptions{FullBlocks: c.Bool("blocks.full"), ChainIDs: chainIDs(c)}
+}
+
+// concatenates groups of flags shared by several commands
+func joinFlags(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+	return flags
+}
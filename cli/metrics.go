@@ -0,0 +1,14 @@
+package cli
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+// flag of long running commands specifying the address to serve prometheus metrics on
+func metricsFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "metrics.addr",
+		Usage:   "address to serve prometheus metrics on at /metrics, metrics are disabled if empty",
+		EnvVars: []string{"CTOP_METRICS_ADDR"},
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func RecordCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "record",
+		Usage: "Record every event received from the specified networks to a gzip compressed jsonl file",
+		Flags: []cli.Flag{
+			networkEndpointsFlag(),
+			fullBlocksFlag(),
+			&cli.StringFlag{
+				Name:     "output",
+				Usage:    "path of the recording, such as incident.jsonl.gz",
+				Required: true,
+			},
+		},
+		Before: withConfig(applyNetworkEndpoints),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signalContext(c.Context)
+			defer cancel()
+			endpoints := ParseNetworkConfigs(c.StringSlice("networks"))
+			if len(endpoints) == 0 {
+				return fmt.Errorf("no networks given")
+			}
+			writer, err := recording.Create(c.String("output"))
+			if err != nil {
+				return err
+			}
+			defer writer.Close()
+			recorder, err := service.NewRecorder(ctx, writer, endpoints, connectorOptions(c))
+			if err != nil {
+				return err
+			}
+			if err := recorder.Start(); err != nil {
+				recorder.Close()
+				return err
+			}
+			log.Info().Str("output", c.String("output")).Msg("recording events")
+
+			// block until we receive an exit notification
+			<-ctx.Done()
+			recorder.Close()
+			log.Info().Int64("events", writer.Events()).Str("output", c.String("output")).Msg("recording finished")
+			return writer.Close()
+		},
+	}
+}
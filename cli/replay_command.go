@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func ReplayCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Replay a recording made by the record command, storing its events in redis",
+		Flags: []cli.Flag{
+			redisURLFlag(),
+			&cli.StringFlag{
+				Name:     "input",
+				Usage:    "path of the recording",
+				Required: true,
+			},
+			&cli.Float64Flag{
+				Name:  "speed",
+				Usage: "factor by which the recording is sped up, 1 replays events at their original pace and 0 as fast as possible",
+				Value: 1,
+			},
+			&cli.StringFlag{
+				Name:  "network.prefix",
+				Usage: "prefix added to the networks of the recording, to replay it into streams separate from those of the live networks",
+			},
+		},
+		Before: withConfig(applyConfig),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signalContext(c.Context)
+			defer cancel()
+			if c.Float64("speed") < 0 {
+				return fmt.Errorf("invalid speed %v", c.Float64("speed"))
+			}
+			reader, err := recording.Open(c.String("input"))
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+			cc, err := cred.New(ctx, c.String("redis.url"), false)
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+			replayer := service.NewReplayer(ctx, cc, c.Float64("speed"), c.String("network.prefix"))
+			defer replayer.Close()
+			stored, err := replayer.Replay(reader)
+			log.Info().Int("events", stored).Str("input", c.String("input")).Msg("replay finished")
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		},
+	}
+}
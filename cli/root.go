@@ -8,20 +8,30 @@ import (
 func RootCmd() *cli.App {
 	return &cli.App{
 		Name: " ctop",
+		Flags: []cli.Flag{
+			configFlag(),
+		},
 		Commands: []*cli.Command{
 			RedisEventStreamCommand(),
 			EventSubscriptionServiceCommand(),
 			ValidatorIndexerCommand(),
 			DBCommand(migrations.Migrations),
 			AnalyzerCommand(),
+			TopCommand(),
+			APICommand(),
+			RunCommand(),
+			SimulateCommand(),
+			RecordCommand(),
+			ReplayCommand(),
 		},
 	}
 }
 
-func ParseNetworkConfigs(args []string) map[string]string {
-	config := make(map[string]string, len(args)/2)
-	for i := 0; i < len(args); i += 2 {
-		config[args[i]] = args[i+1]
+// Parses pairs of (network_name, network_url), a network may be specified multiple times to connect to several endpoints
+func ParseNetworkConfigs(args []string) map[string][]string {
+	config := make(map[string][]string, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		config[args[i]] = append(config[args[i]], args[i+1])
 	}
 	return config
 }
@@ -0,0 +1,322 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rangesecurity/ctop/alert"
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/metrics"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rangesecurity/ctop/supervisor"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// delay before restarting a failed component, doubling on every consecutive failure
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// analyzers polling the database for a single network until their context is cancelled
+type networkAnalyzer interface {
+	Start(network string, pollFrequency time.Duration)
+}
+
+type analyzerConstructor func(
+	ctx context.Context,
+	c *cli.Context,
+	database db.Store,
+	alerts *alert.Manager,
+	signal *analyzer.VoteSignal,
+	network string,
+) networkAnalyzer
+
+// constructors of the analyzers run by the run command, keyed by the name of their analyzer subcommand
+var runAnalyzers = map[string]analyzerConstructor{
+	"missing-votes": func(ctx context.Context, c *cli.Context, database db.Store, alerts *alert.Manager, signal *analyzer.VoteSignal, network string) networkAnalyzer {
+		return analyzer.NewMissingVoteAnalyzer(ctx, database, alerts)
+	},
+	"quorum": func(ctx context.Context, c *cli.Context, database db.Store, alerts *alert.Manager, signal *analyzer.VoteSignal, network string) networkAnalyzer {
+		return analyzer.NewQuorumAnalyzer(ctx, database, alerts)
+	},
+	"double-sign": func(ctx context.Context, c *cli.Context, database db.Store, alerts *alert.Manager, signal *analyzer.VoteSignal, network string) networkAnalyzer {
+		return analyzer.NewEquivocationAnalyzer(ctx, database, alerts, signal)
+	},
+	"halt": func(ctx context.Context, c *cli.Context, database db.Store, alerts *alert.Manager, signal *analyzer.VoteSignal, network string) networkAnalyzer {
+		heightThreshold, maxRounds := c.Duration("height.threshold"), c.Int64("max.rounds")
+		if cfg, _ := loadConfig(c); cfg != nil {
+			if settings, ok := cfg.Network(network); ok {
+				if settings.Analyzers.HeightThreshold > 0 && !c.IsSet("height.threshold") {
+					heightThreshold = settings.Analyzers.HeightThreshold
+				}
+				if settings.Analyzers.MaxRounds > 0 && !c.IsSet("max.rounds") {
+					maxRounds = int64(settings.Analyzers.MaxRounds)
+				}
+			}
+		}
+		return analyzer.NewHaltAnalyzer(ctx, database, alerts, heightThreshold, maxRounds)
+	},
+}
+
+func RunCommand() *cli.Command {
+	return &cli.Command{
+		Name: "run",
+		Usage: "Run the event subscription service, redis event stream, validator indexer and analyzers in a " +
+			"single process, restarting components which fail",
+		Flags: append([]cli.Flag{
+			redisURLFlag(),
+			dbURLFlag(),
+			networkEndpointsFlag(),
+			fullBlocksFlag(),
+			&cli.DurationFlag{
+				Name:  "poll.frequency",
+				Usage: "duration to poll networks for validators, and to run analyzers",
+				Value: 5 * time.Second,
+			},
+			metricsFlag(),
+		}, joinFlags(runAnalyzerFlags(), embeddedFlags(), eventStreamFlags(), alertFlags())...),
+		Before: withConfig(applyConfig, applyNetworkEndpoints, applyBatchSizes),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signalContext(c.Context)
+			defer cancel()
+			metrics.Serve(ctx, c.String("metrics.addr"))
+			if err := validateAnalyzers(c); err != nil {
+				return err
+			}
+			endpoints := ParseNetworkConfigs(c.StringSlice("networks"))
+			if len(endpoints) == 0 {
+				return fmt.Errorf("no networks given")
+			}
+			if err := validateDoubleSignEndpoints(c, endpoints); err != nil {
+				return err
+			}
+			networks := make([]string, 0, len(endpoints))
+			for network := range endpoints {
+				networks = append(networks, network)
+			}
+			sort.Strings(networks)
+
+			// all components share a single database and redis connection pool
+			database, streams, err := openStorage(ctx, c)
+			if err != nil {
+				return err
+			}
+			defer database.Close()
+			defer streams.Close()
+
+			// components are stopped in the order they are added, so upstream components stop first
+			// allowing downstream components to finish persisting and analyzing the events already received
+			sup := supervisor.New(minRestartBackoff, maxRestartBackoff)
+			sup.Add("event-subscription-service", func(ctx context.Context) error {
+				subService, err := service.NewServiceWithStreams(ctx, streams, endpoints, connectorOptions(c))
+				if err != nil {
+					return err
+				}
+				defer subService.Close()
+				if err := subService.StartEventSubscriptions(); err != nil {
+					return err
+				}
+				<-ctx.Done()
+				return nil
+			})
+			signal := analyzer.NewVoteSignal()
+			if err := addEventStream(sup, c, streams, database, signal, networks); err != nil {
+				return err
+			}
+			sup.Add("validator-indexer", func(ctx context.Context) error {
+				indexer, err := service.NewValidatorIndexer(ctx, database, endpoints, chainIDs(c), identityOverrides(c))
+				if err != nil {
+					return err
+				}
+				indexer.Start(c.Duration("poll.frequency"), pollFrequencies(c, networks))
+				return nil
+			})
+			addAnalyzers(sup, c, database, alertManager(c, database), signal, networks)
+			err = sup.Run(ctx)
+			log.Info().Msg("all components stopped")
+			return err
+		},
+	}
+}
+
+func runAnalyzerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "analyzers",
+			Usage: "analyzers to run against every network, one of missing-votes, quorum, double-sign or halt",
+			Value: cli.NewStringSlice("missing-votes"),
+		},
+		&cli.DurationFlag{
+			Name:  "height.threshold",
+			Usage: "alert when the network remains at the same height for longer than this duration",
+			Value: time.Minute,
+		},
+		&cli.Int64Flag{
+			Name:  "max.rounds",
+			Usage: "alert when the network escalates past this round at a single height",
+			Value: 3,
+		},
+	}
+}
+
+func embeddedFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "embedded",
+			Usage:   "store events in memory and persist them to a sqlite database, instead of using redis and postgres",
+			EnvVars: []string{"CTOP_EMBEDDED"},
+		},
+		&cli.StringFlag{
+			Name:    "embedded.path",
+			Usage:   "path of the sqlite database used in embedded mode, :memory: keeps the database in memory",
+			Value:   "ctop.db",
+			EnvVars: []string{"CTOP_EMBEDDED_PATH"},
+		},
+		&cli.IntFlag{
+			Name:  "embedded.capacity",
+			Usage: "number of events held in memory per network and event type in embedded mode",
+			Value: cred.DefaultMemoryCapacity,
+		},
+	}
+}
+
+// returns an error if --analyzers contains an unknown analyzer
+func validateAnalyzers(c *cli.Context) error {
+	for _, name := range c.StringSlice("analyzers") {
+		if _, ok := runAnalyzers[name]; !ok {
+			return fmt.Errorf("unknown analyzer %s", name)
+		}
+	}
+	return nil
+}
+
+// returns an error if the double-sign analyzer is given by --analyzers and a network has less than two endpoints.
+// Nodes only publish the votes they accepted, so conflicting votes are only observed by comparing the votes
+// published by several nodes
+func validateDoubleSignEndpoints(c *cli.Context, endpoints map[string][]string) error {
+	for _, name := range c.StringSlice("analyzers") {
+		if name != analyzer.EquivocationAnalyzerName {
+			continue
+		}
+		for network, urls := range endpoints {
+			if len(urls) < 2 {
+				return fmt.Errorf(
+					"the %s analyzer requires at least two endpoints for network %s, found %d",
+					name, network, len(urls),
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// adds the component persisting events of the networks from the streams to the database, notifying signal
+// whenever votes have been stored
+func addEventStream(
+	sup *supervisor.Supervisor,
+	c *cli.Context,
+	streams cred.Streams,
+	database db.Store,
+	signal *analyzer.VoteSignal,
+	networks []string,
+) error {
+	consumer, err := consumerName(c)
+	if err != nil {
+		return err
+	}
+	batch, err := batchOptions(c)
+	if err != nil {
+		return err
+	}
+	sup.Add("redis-event-stream", func(ctx context.Context) error {
+		eventStream := service.NewRedisEventStreamWithStreams(
+			ctx,
+			streams,
+			database,
+			c.String("redis.group"),
+			consumer,
+			c.Duration("redis.claim.idle"),
+			batch,
+		)
+		defer eventStream.Close()
+		eventStream.VotesStored = signal.Notify
+		return persistEvents(eventStream, networks)
+	})
+	return nil
+}
+
+// adds a component for every analyzer given by --analyzers and network
+func addAnalyzers(
+	sup *supervisor.Supervisor,
+	c *cli.Context,
+	database db.Store,
+	alerts *alert.Manager,
+	signal *analyzer.VoteSignal,
+	networks []string,
+) {
+	for _, name := range c.StringSlice("analyzers") {
+		for _, network := range networks {
+			newAnalyzer := runAnalyzers[name]
+			sup.Add(fmt.Sprintf("%s/%s", name, network), func(ctx context.Context) error {
+				newAnalyzer(ctx, c, database, alerts, signal, network).Start(network, pollFrequency(c, network))
+				return nil
+			})
+		}
+	}
+}
+
+// opens the database and the streams events are queued in. In embedded mode events are held in memory and
+// persisted to a sqlite database, whose schema is migrated on startup
+func openStorage(ctx context.Context, c *cli.Context) (db.Store, cred.Streams, error) {
+	if !c.Bool("embedded") {
+		database, err := db.New(c.String("db.url"))
+		if err != nil {
+			return nil, nil, err
+		}
+		cc, err := cred.New(ctx, c.String("redis.url"), false)
+		if err != nil {
+			database.Close()
+			return nil, nil, err
+		}
+		return database, cc, nil
+	}
+	database, err := db.NewSQLite(c.String("embedded.path"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := database.CreateSchema(ctx); err != nil {
+		database.Close()
+		return nil, nil, fmt.Errorf("failed to migrate database %+v", err)
+	}
+	log.Info().Str("path", c.String("embedded.path")).Msg("running in embedded mode")
+	return database, cred.NewMemoryStreams(c.Int("embedded.capacity")), nil
+}
+
+// returns the poll interval configured for the network, --poll.frequency takes precedence over the configuration
+// file
+func pollFrequency(c *cli.Context, network string) time.Duration {
+	if c.IsSet("poll.frequency") {
+		return c.Duration("poll.frequency")
+	}
+	if cfg, _ := loadConfig(c); cfg != nil {
+		if settings, ok := cfg.Network(network); ok && settings.PollInterval > 0 {
+			return settings.PollInterval
+		}
+	}
+	return c.Duration("poll.frequency")
+}
+
+// returns the poll interval of every network, see pollFrequency
+func pollFrequencies(c *cli.Context, networks []string) map[string]time.Duration {
+	frequencies := make(map[string]time.Duration, len(networks))
+	for _, network := range networks {
+		frequencies[network] = pollFrequency(c, network)
+	}
+	return frequencies
+}
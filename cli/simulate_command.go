@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/metrics"
+	"github.com/rangesecurity/ctop/simulator"
+	"github.com/rangesecurity/ctop/supervisor"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func SimulateCommand() *cli.Command {
+	defaults := simulator.DefaultConfig()
+	return &cli.Command{
+		Name: "simulate",
+		Usage: "Simulate the consensus events of a network with injected faults, persisting them through the redis " +
+			"event stream and running the analyzers against them",
+		Flags: append([]cli.Flag{
+			redisURLFlag(),
+			dbURLFlag(),
+			&cli.DurationFlag{
+				Name:  "poll.frequency",
+				Usage: "duration to run analyzers",
+				Value: 5 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "name of the simulated network",
+				Value: defaults.Network,
+			},
+			&cli.IntFlag{
+				Name:  "validators",
+				Usage: "number of validators, all with the same voting power",
+				Value: defaults.Validators,
+			},
+			&cli.Int64Flag{
+				Name:  "voting.power",
+				Usage: "voting power of every validator",
+				Value: defaults.VotingPower,
+			},
+			&cli.Int64Flag{
+				Name:  "start.height",
+				Usage: "first simulated height, must be above the heights already stored for the network",
+				Value: defaults.StartHeight,
+			},
+			&cli.Int64Flag{
+				Name:  "heights",
+				Usage: "number of heights to simulate, 0 simulates until the command is stopped",
+			},
+			&cli.DurationFlag{
+				Name:  "block.time",
+				Usage: "duration of a height committed in its first round",
+				Value: defaults.BlockTime,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout.propose",
+				Usage: "duration validators wait for a proposal before prevoting nil",
+				Value: defaults.TimeoutPropose,
+			},
+			&cli.IntSliceFlag{
+				Name:  "offline",
+				Usage: "index of a validator which never votes or proposes, may be repeated",
+			},
+			&cli.IntSliceFlag{
+				Name:  "slow.proposers",
+				Usage: "index of a validator whose proposals miss the propose timeout, may be repeated",
+			},
+			&cli.IntSliceFlag{
+				Name:  "double.signers",
+				Usage: "index of a validator which signs conflicting prevotes, may be repeated",
+			},
+			&cli.IntSliceFlag{
+				Name:  "partition",
+				Usage: "index of a validator cut off from the network at --partition.height, may be repeated",
+			},
+			&cli.Int64Flag{
+				Name:  "partition.height",
+				Usage: "height at which the partition occurs",
+			},
+			&cli.IntFlag{
+				Name:  "partition.rounds",
+				Usage: "number of rounds the partition lasts",
+				Value: 3,
+			},
+			metricsFlag(),
+		}, joinFlags(runAnalyzerFlags(), embeddedFlags(), eventStreamFlags(), alertFlags())...),
+		Before: withConfig(applyConfig, applyBatchSizes),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signalContext(c.Context)
+			defer cancel()
+			metrics.Serve(ctx, c.String("metrics.addr"))
+			if err := validateAnalyzers(c); err != nil {
+				return err
+			}
+			cfg := simulator.Config{
+				Network:        c.String("network"),
+				Validators:     c.Int("validators"),
+				VotingPower:    c.Int64("voting.power"),
+				StartHeight:    c.Int64("start.height"),
+				BlockTime:      c.Duration("block.time"),
+				TimeoutPropose: c.Duration("timeout.propose"),
+				Faults: simulator.Faults{
+					Offline:       c.IntSlice("offline"),
+					SlowProposers: c.IntSlice("slow.proposers"),
+					DoubleSigners: c.IntSlice("double.signers"),
+				},
+			}
+			if partition := c.IntSlice("partition"); len(partition) > 0 {
+				if !c.IsSet("partition.height") {
+					return fmt.Errorf("--partition requires --partition.height")
+				}
+				cfg.Faults.Partitions = []simulator.Partition{{
+					Validators: partition,
+					Height:     c.Int64("partition.height"),
+					Rounds:     c.Int("partition.rounds"),
+				}}
+			}
+
+			database, streams, err := openStorage(ctx, c)
+			if err != nil {
+				return err
+			}
+			defer database.Close()
+			defer streams.Close()
+			sim, err := simulator.NewSimulator(ctx, streams, cfg)
+			if err != nil {
+				return err
+			}
+			defer sim.Close()
+			// the validator indexer is replaced by the simulated validator set
+			if err := storeSimulatedValidators(ctx, database, cfg.Network, sim); err != nil {
+				return fmt.Errorf("failed to store validators %+v", err)
+			}
+
+			sup := supervisor.New(minRestartBackoff, maxRestartBackoff)
+			sup.Add("simulator", func(ctx context.Context) error {
+				// heights simulated before a restart are not simulated again
+				var remaining int64
+				if heights := c.Int64("heights"); heights > 0 {
+					if remaining = cfg.StartHeight + heights - sim.Height(); remaining <= 0 {
+						return nil
+					}
+				}
+				if err := sim.Run(remaining); err != nil {
+					return err
+				}
+				if ctx.Err() == nil {
+					log.Info().Str("network", cfg.Network).Int64("height", sim.Height()-1).Msg("simulation finished")
+				}
+				return nil
+			})
+			signal := analyzer.NewVoteSignal()
+			if err := addEventStream(sup, c, streams, database, signal, []string{cfg.Network}); err != nil {
+				return err
+			}
+			addAnalyzers(sup, c, database, alertManager(c, database), signal, []string{cfg.Network})
+			err = sup.Run(ctx)
+			log.Info().Msg("all components stopped")
+			return err
+		},
+	}
+}
+
+func storeSimulatedValidators(ctx context.Context, database db.Store, network string, sim *simulator.Simulator) error {
+	data := make(map[string]interface{})
+	for _, validator := range sim.Validators() {
+		data[validator.Address.String()] = db.ValidatorInfo{
+			VotingPower:      validator.VotingPower,
+			ProposerPriority: validator.ProposerPriority,
+		}
+	}
+	return database.StoreOrUpdateValidators(ctx, network, sim.Height(), data)
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/rangesecurity/ctop/top"
+	"github.com/urfave/cli/v2"
+)
+
+func TopCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "top",
+		Usage: "Display a live dashboard of the consensus state of a network",
+		Flags: []cli.Flag{
+			redisURLFlag(),
+			dbURLFlag(),
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "network to display",
+			},
+		},
+		Before: withConfig(applyConfig),
+		Action: func(c *cli.Context) error {
+			network := c.String("network")
+			if network == "" {
+				return fmt.Errorf("--network is required")
+			}
+			// monikers and the stored validator set are only displayed if a database is configured, as the dashboard
+			// otherwise only needs redis
+			var (
+				identities    top.Identities
+				validatorSets top.ValidatorSets
+			)
+			if c.IsSet("db.url") {
+				database, err := db.New(c.String("db.url"))
+				if err != nil {
+					return err
+				}
+				defer database.Close()
+				identities = identity.NewResolver(database, identityCacheTTL)
+				validatorSets = database
+			}
+			dashboard, err := top.NewDashboard(c.Context, c.String("redis.url"), network, identities, validatorSets)
+			if err != nil {
+				return err
+			}
+			defer dashboard.Close()
+			return dashboard.Run()
+		},
+	}
+}
@@ -1,31 +1,155 @@
 package common
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+)
 
 // wrapper around types.Vote which provides easier to store types
 type ParsedVote struct {
-	Type             string
-	Round            int64
-	Height           int64
-	BlockID          string
-	Timestamp        time.Time
-	ValidatorAddress string
-	ValidatorIndex   int64
-	Signature        []byte
+	Type             string    `json:"type"`
+	Round            int64     `json:"round"`
+	Height           int64     `json:"height"`
+	BlockID          string    `json:"block_id"`
+	Timestamp        time.Time `json:"timestamp"`
+	ValidatorAddress string    `json:"validator_address"`
+	ValidatorIndex   int64     `json:"validator_index"`
+	Signature        []byte    `json:"signature"`
 }
 
 // wrapper around types.EventDataNewRound which provides easier to store types
 type ParsedNewRound struct {
-	Height          int64
-	Round           int64
-	Step            string
-	ProposerAddress string
-	ProposerIndex   int64
+	Height          int64  `json:"height"`
+	Round           int64  `json:"round"`
+	Step            string `json:"step"`
+	ProposerAddress string `json:"proposer_address"`
+	ProposerIndex   int64  `json:"proposer_index"`
 }
 
 // wrapper around types.EventDataRoundState which provides easier to store types
 type ParsedNewRoundStep struct {
-	Height int64
-	Round  int64
-	Step   string
+	Height int64  `json:"height"`
+	Round  int64  `json:"round"`
+	Step   string `json:"step"`
+	// time the event was received from the node, zero for events stored before it was recorded
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// wrapper around types.EventDataCompleteProposal which provides easier to store types
+type ParsedCompleteProposal struct {
+	Height  int64  `json:"height"`
+	Round   int64  `json:"round"`
+	Step    string `json:"step"`
+	BlockID string `json:"block_id"`
+	// time the event was received from the node, zero for events stored before it was recorded
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// wrapper around a types.EventDataRoundState published for one of the RoundEventTypes
+type ParsedRoundEvent struct {
+	Type   string `json:"type"`
+	Height int64  `json:"height"`
+	Round  int64  `json:"round"`
+	Step   string `json:"step"`
+	// time the event was received from the node, zero for events stored before it was recorded
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// wrapper around types.EventDataNewBlockHeader or types.EventDataNewBlock which provides easier to store
+// types. NumTxs and the last commit are only known for NewBlock events
+type ParsedBlock struct {
+	Height          int64     `json:"height"`
+	Time            time.Time `json:"time"`
+	ProposerAddress string    `json:"proposer_address"`
+	NumTxs          *int64    `json:"num_txs,omitempty"`
+	// round in which the previous height was committed
+	LastCommitRound *int64 `json:"last_commit_round,omitempty"`
+	// validators which signed the previous height, see CommitSigners
+	LastCommitSigners string `json:"last_commit_signers,omitempty"`
+}
+
+// Returns a bitmap of the validators which signed a commit, ordered by validator index. Validators which
+// precommitted the block are marked with x, validators which were absent or precommitted nil with _
+func CommitSigners(commit *types.Commit) string {
+	if commit == nil {
+		return ""
+	}
+	var signers strings.Builder
+	for _, sig := range commit.Signatures {
+		if sig.BlockIDFlag == types.BlockIDFlagCommit {
+			signers.WriteByte('x')
+		} else {
+			signers.WriteByte('_')
+		}
+	}
+	return signers.String()
+}
+
+// the round state events other than NewRoundStep, each of which is written to its own stream
+var RoundEventTypes = []string{
+	types.EventPolka,
+	types.EventLock,
+	types.EventRelock,
+	types.EventUnlock,
+	types.EventTimeoutPropose,
+	types.EventTimeoutWait,
+	types.EventValidBlock,
+}
+
+// event type -> stream of the RoundEventTypes
+var RoundEventStreams = map[string]string{
+	types.EventPolka:          StreamPolka,
+	types.EventLock:           StreamLock,
+	types.EventRelock:         StreamRelock,
+	types.EventUnlock:         StreamUnlock,
+	types.EventTimeoutPropose: StreamTimeoutPropose,
+	types.EventTimeoutWait:    StreamTimeoutWait,
+	types.EventValidBlock:     StreamValidBlock,
+}
+
+// names of the redis streams events are written to, prefixed by the network name
+const (
+	StreamVotes            = "votes"
+	StreamNewRound         = "new_round"
+	StreamNewRoundStep     = "new_round_step"
+	StreamCompleteProposal = "complete_proposal"
+	StreamPolka            = "polka"
+	StreamLock             = "lock"
+	StreamRelock           = "relock"
+	StreamUnlock           = "unlock"
+	StreamTimeoutPropose   = "timeout_propose"
+	StreamTimeoutWait      = "timeout_wait"
+	StreamValidBlock       = "valid_block"
+	// NewBlockHeader or NewBlock events, depending on which the event subscription service subscribes to
+	StreamBlocks = "blocks"
+)
+
+// returns the key of the redis stream holding events of the given type for a network
+func StreamKey(network string, stream string) string {
+	return network + ":" + stream
+}
+
+// streams which are also written to a capped live stream. Messages of the live streams are never acknowledged,
+// so they can be followed by live feeds while the messages of the stream are persisted and deleted
+var LiveStreams = []string{StreamVotes, StreamNewRound, StreamNewRoundStep}
+
+// returns the key of the live stream of a stream, see LiveStreams
+func LiveStreamKey(network string, stream string) string {
+	return StreamKey(network, stream) + ":live"
+}
+
+// an event read from one of the network event streams, Data is one of
+// *ParsedVote, *ParsedNewRound, *ParsedNewRoundStep, *ParsedCompleteProposal or *ParsedRoundEvent depending on Stream
+type StreamEvent struct {
+	Network string
+	Stream  string
+	ID      string
+	Data    interface{}
+}
+
+// nil votes are cast with an empty block hash, which BlockID.String renders as ":0:000000000000"
+func IsNilBlockID(blockID string) bool {
+	return blockID == "" || strings.HasPrefix(blockID, ":")
 }
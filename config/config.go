@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the storage, networks and alerting shared by all commands. Fields which are not set fall back
+// to the defaults of the corresponding command line flags
+type Config struct {
+	Database Database  `yaml:"database"`
+	Redis    Redis     `yaml:"redis"`
+	Networks []Network `yaml:"networks"`
+	Alerts   Alerts    `yaml:"alerts"`
+	Metrics  Metrics   `yaml:"metrics"`
+	API      API       `yaml:"api"`
+}
+
+type Database struct {
+	URL string `yaml:"url"`
+}
+
+type Redis struct {
+	URL string `yaml:"url"`
+	// consumer group and consumer name used by the redis event stream
+	Group     string        `yaml:"group"`
+	Consumer  string        `yaml:"consumer"`
+	ClaimIdle time.Duration `yaml:"claim_idle"`
+}
+
+type Network struct {
+	Name string `yaml:"name"`
+	// chain id of the network, endpoints whose /status reports another network are rejected when connecting
+	ChainID string   `yaml:"chain_id"`
+	RPC     []string `yaml:"rpc"`
+	// interval at which the validator indexer and analyzers poll the network
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// number of events written to the database at once by the redis event stream
+	BatchSize int       `yaml:"batch_size"`
+	Analyzers Analyzers `yaml:"analyzers"`
+	// identities of validators, taking precedence over the identities registered with the staking module
+	Identities []Identity `yaml:"identities"`
+}
+
+// Identity of a validator keyed by its hex consensus address, empty fields keep the registered value
+type Identity struct {
+	Address         string `yaml:"address"`
+	Moniker         string `yaml:"moniker"`
+	OperatorAddress string `yaml:"operator_address"`
+	Website         string `yaml:"website"`
+}
+
+// thresholds of the analyzers, zero values use the analyzer defaults
+type Analyzers struct {
+	HeightThreshold time.Duration `yaml:"height_threshold"`
+	MaxRounds       int           `yaml:"max_rounds"`
+}
+
+type Alerts struct {
+	Webhooks []string      `yaml:"webhooks"`
+	Slack    []string      `yaml:"slack"`
+	Stdout   bool          `yaml:"stdout"`
+	Renotify time.Duration `yaml:"renotify"`
+	// minimum number of alerts sent as a single notification, see alert.Manager
+	Group int `yaml:"group"`
+}
+
+type Metrics struct {
+	Addr string `yaml:"addr"`
+}
+
+type API struct {
+	Addr string `yaml:"addr"`
+	// networks to serve a live feed of events for
+	FeedNetworks []string `yaml:"feed_networks"`
+	// origins allowed to open feed websockets besides the api's own host
+	FeedOrigins []string `yaml:"feed_origins"`
+}
+
+// Loads the configuration file at path. Environment variables referenced as ${VAR} are expanded, allowing
+// secrets such as database passwords to be kept out of the file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parses and validates a configuration, unknown fields are rejected
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(expandEnv(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config %+v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// matches environment variables referenced as ${VAR}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expands environment variables referenced as ${VAR}, leaving any other $ untouched so values such as passwords
+// may contain it
+func expandEnv(data []byte) []byte {
+	return envPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		return []byte(os.Getenv(string(envPattern.FindSubmatch(match)[1])))
+	})
+}
+
+func (c *Config) Validate() error {
+	names := make(map[string]struct{}, len(c.Networks))
+	for i, network := range c.Networks {
+		if network.Name == "" {
+			return fmt.Errorf("network %d has no name", i)
+		}
+		if _, ok := names[network.Name]; ok {
+			return fmt.Errorf("network %s is configured more than once", network.Name)
+		}
+		names[network.Name] = struct{}{}
+		if len(network.RPC) == 0 {
+			return fmt.Errorf("network %s has no rpc endpoints", network.Name)
+		}
+		for j, identity := range network.Identities {
+			if identity.Address == "" {
+				return fmt.Errorf("identity %d of network %s has no address", j, network.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the configuration of a network
+func (c *Config) Network(name string) (Network, bool) {
+	for _, network := range c.Networks {
+		if network.Name == name {
+			return network, true
+		}
+	}
+	return Network{}, false
+}
+
+// Returns the rpc endpoints of every network
+func (c *Config) Endpoints() map[string][]string {
+	endpoints := make(map[string][]string, len(c.Networks))
+	for _, network := range c.Networks {
+		endpoints[network.Name] = network.RPC
+	}
+	return endpoints
+}
+
+// Returns the names of all networks
+func (c *Config) NetworkNames() []string {
+	names := make([]string, 0, len(c.Networks))
+	for _, network := range c.Networks {
+		names = append(names, network.Name)
+	}
+	return names
+}
@@ -0,0 +1,2 @@
+// Package config provides the yaml configuration file shared by all ctop commands
+package config
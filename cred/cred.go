@@ -2,12 +2,19 @@ package cred
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
 	"github.com/redis/go-redis/v9"
 )
 
+var _ Streams = (*CredClient)(nil)
+
+// CredClient stores events in redis streams, using lua scripts to assign message ids
 type CredClient struct {
 	unsafe bool
 	rdb    *redis.Client
@@ -18,7 +25,7 @@ func New(ctx context.Context, url string, unsafe bool) (*CredClient, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: url,
 	})
-	scripts := [3]*redis.Script{VotesLuaScript, NewRoundStepScript, NewRoundScript}
+	scripts := [6]*redis.Script{VotesLuaScript, NewRoundStepScript, NewRoundScript, CompleteProposalScript, RoundEventScript, BlockScript}
 	for _, script := range scripts {
 		res := script.Load(ctx, rdb)
 		if err := res.Err(); err != nil {
@@ -46,6 +53,7 @@ func (c *CredClient) StoreVote(ctx context.Context, network string, voteInfo typ
 			voteInfo.Vote.BlockID.String(),
 			voteInfo.Vote.Type.String(),
 			voteInfo.Vote.Timestamp.String(),
+			LiveStreamLength,
 		},
 	).Err()
 }
@@ -63,12 +71,17 @@ func (c *CredClient) StoreNewRound(ctx context.Context, network string, roundInf
 			roundInfo.Step,
 			roundInfo.Proposer.Address.String(),
 			roundInfo.Proposer.Index,
+			LiveStreamLength,
 		},
 	).Err()
 }
 
-func (c *CredClient) StoreNewRoundStep(ctx context.Context, network string, roundInfo types.EventDataRoundState) error {
-
+func (c *CredClient) StoreNewRoundStep(
+	ctx context.Context,
+	network string,
+	roundInfo types.EventDataRoundState,
+	receivedAt time.Time,
+) error {
 	return NewRoundStepScript.Run(
 		ctx,
 		c.rdb,
@@ -78,9 +91,87 @@ func (c *CredClient) StoreNewRoundStep(ctx context.Context, network string, roun
 			roundInfo.Height,
 			roundInfo.Round,
 			roundInfo.Step,
+			formatReceivedAt(receivedAt),
+			LiveStreamLength,
+		},
+	).Err()
+}
+
+func (c *CredClient) StoreCompleteProposal(
+	ctx context.Context,
+	network string,
+	proposalInfo types.EventDataCompleteProposal,
+	receivedAt time.Time,
+) error {
+	return CompleteProposalScript.Run(
+		ctx,
+		c.rdb,
+		nil,
+		[]interface{}{
+			network,
+			proposalInfo.Height,
+			proposalInfo.Round,
+			proposalInfo.Step,
+			proposalInfo.BlockID.String(),
+			formatReceivedAt(receivedAt),
+		},
+	).Err()
+}
+
+func (c *CredClient) StoreRoundEvent(
+	ctx context.Context,
+	network string,
+	eventType string,
+	roundInfo types.EventDataRoundState,
+	receivedAt time.Time,
+) error {
+	stream, ok := common.RoundEventStreams[eventType]
+	if !ok {
+		return fmt.Errorf("unsupported round event %s", eventType)
+	}
+	return RoundEventScript.Run(
+		ctx,
+		c.rdb,
+		nil,
+		[]interface{}{
+			network,
+			stream,
+			roundInfo.Height,
+			roundInfo.Round,
+			roundInfo.Step,
+			formatReceivedAt(receivedAt),
+		},
+	).Err()
+}
+
+func (c *CredClient) StoreNewBlockHeader(ctx context.Context, network string, headerInfo types.EventDataNewBlockHeader) error {
+	return c.storeBlock(ctx, network, headerInfo.Header.Height, newBlockFields(headerInfo.Header, nil))
+}
+
+func (c *CredClient) StoreNewBlock(ctx context.Context, network string, blockInfo types.EventDataNewBlock) error {
+	if blockInfo.Block == nil {
+		return fmt.Errorf("block is nil")
+	}
+	return c.storeBlock(ctx, network, blockInfo.Block.Height, newBlockFields(blockInfo.Block.Header, blockInfo.Block))
+}
+
+func (c *CredClient) storeBlock(ctx context.Context, network string, height int64, fields blockFields) error {
+	return BlockScript.Run(
+		ctx,
+		c.rdb,
+		nil,
+		[]interface{}{
+			network,
+			height,
+			fields.time,
+			fields.proposer,
+			fields.numTxs,
+			fields.lastCommitRound,
+			fields.lastCommitSigners,
 		},
 	).Err()
 }
+
 func (c *CredClient) FlushAll(ctx context.Context) error {
 	if c.unsafe {
 		return c.rdb.FlushAll(ctx).Err()
@@ -90,3 +181,137 @@ func (c *CredClient) FlushAll(ctx context.Context) error {
 }
 
 func (c *CredClient) Redis() *redis.Client { return c.rdb }
+
+func (c *CredClient) CreateGroup(ctx context.Context, stream string, group string) error {
+	err := c.rdb.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %+v", err)
+	}
+	return nil
+}
+
+func (c *CredClient) ReadGroup(
+	ctx context.Context,
+	stream string,
+	group string,
+	consumer string,
+	id string,
+	count int64,
+	block time.Duration,
+) ([]Message, error) {
+	entries, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, id},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return toMessages(entries), nil
+}
+
+func (c *CredClient) Claim(
+	ctx context.Context,
+	stream string,
+	group string,
+	consumer string,
+	minIdle time.Duration,
+) ([]Message, error) {
+	var (
+		claimed []Message
+		start   = "0-0"
+	)
+	for {
+		messages, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    group,
+			Consumer: consumer,
+			MinIdle:  minIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return claimed, err
+		}
+		for _, message := range messages {
+			claimed = append(claimed, Message{Stream: stream, ID: message.ID, Values: message.Values})
+		}
+		if next == "0-0" {
+			return claimed, nil
+		}
+		start = next
+	}
+}
+
+func (c *CredClient) Ack(ctx context.Context, stream string, group string, ids ...string) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.XAck(ctx, stream, group, ids...)
+	pipe.XDel(ctx, stream, ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *CredClient) Read(ctx context.Context, streams []string, ids []string, block time.Duration) ([]Message, error) {
+	entries, err := c.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: append(append([]string{}, streams...), ids...),
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return toMessages(entries), nil
+}
+
+func (c *CredClient) LastID(ctx context.Context, stream string) (string, error) {
+	exists, err := c.rdb.Exists(ctx, stream).Result()
+	if err != nil {
+		return "", err
+	}
+	if exists == 0 {
+		return "0-0", nil
+	}
+	// acknowledged messages are deleted, but the stream still rejects ids up to the last one generated
+	info, err := c.rdb.XInfoStream(ctx, stream).Result()
+	if err != nil {
+		return "", err
+	}
+	return info.LastGeneratedID, nil
+}
+
+func (c *CredClient) Info(ctx context.Context, stream string, group string) (StreamInfo, error) {
+	var info StreamInfo
+	length, err := c.rdb.XLen(ctx, stream).Result()
+	if err != nil {
+		return info, err
+	}
+	info.Length = length
+	groups, err := c.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return info, err
+	}
+	for _, g := range groups {
+		if g.Name == group {
+			info.Lag, info.Pending = g.Lag, g.Pending
+		}
+	}
+	return info, nil
+}
+
+func toMessages(entries []redis.XStream) []Message {
+	var messages []Message
+	for _, entry := range entries {
+		for _, message := range entry.Messages {
+			messages = append(messages, Message{Stream: entry.Stream, ID: message.ID, Values: message.Values})
+		}
+	}
+	return messages
+}
+
+// Closes the connection pool of the client
+func (c *CredClient) Close() error { return c.rdb.Close() }
@@ -3,6 +3,7 @@ package cred_test
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 	"time"
 
@@ -15,11 +16,16 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// runs against redis when CTOP_TEST_REDIS_URL is set, such as localhost:6379
 func TestCred(t *testing.T) {
 	// TODO: use table tests
+	url := os.Getenv("CTOP_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("CTOP_TEST_REDIS_URL not set")
+	}
 
 	ctx := context.Background()
-	client, err := cred.New(ctx, "localhost:6379", true)
+	client, err := cred.New(ctx, url, true)
 	require.NoError(t, err)
 
 	// clear pre-existing state
@@ -82,6 +88,7 @@ func TestCred(t *testing.T) {
 			Round:  1,
 			Step:   "RoundStepPropose",
 		},
+		time.Now(),
 	))
 	require.NoError(t, client.StoreNewRoundStep(
 		ctx,
@@ -91,6 +98,7 @@ func TestCred(t *testing.T) {
 			Round:  1,
 			Step:   "RoundStepPrecommit",
 		},
+		time.Now(),
 	))
 	msgs, err = client.Redis().XRange(
 		ctx, "osmosis:new_round_step", fmt.Sprint(22345), fmt.Sprint(22345),
@@ -1,2 +1,3 @@
-// Package cred provides a wrapper around the go-redis client
+// Package cred provides the streams events are queued in between the event subscription service and the
+// redis event stream, backed by redis or held in memory
 package cred
@@ -0,0 +1,511 @@
+package cred
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+)
+
+// default number of messages held by every stream of MemoryStreams
+const DefaultMemoryCapacity = 100_000
+
+var _ Streams = (*MemoryStreams)(nil)
+
+// MemoryStreams keeps streams in memory, allowing all components to run within a single process without redis.
+// Every stream is a ring buffer holding up to capacity messages, once a stream is full its oldest messages are
+// dropped, whether or not they have been acknowledged. Live streams hold up to LiveStreamLength messages
+type MemoryStreams struct {
+	mu       sync.Mutex
+	capacity int
+	streams  map[string]*memoryStream
+	// closed and replaced whenever a message is added, waking up blocked readers
+	notify chan struct{}
+}
+
+type memoryStream struct {
+	// ordered by id, acknowledged messages are removed once they reach the front
+	entries []*memoryEntry
+	length  int
+	lastID  streamID
+	groups  map[string]*memoryGroup
+}
+
+type memoryEntry struct {
+	id      streamID
+	values  map[string]interface{}
+	deleted bool
+}
+
+type memoryGroup struct {
+	lastDelivered streamID
+	pending       map[streamID]*pendingEntry
+}
+
+type pendingEntry struct {
+	entry     *memoryEntry
+	consumer  string
+	delivered time.Time
+}
+
+func NewMemoryStreams(capacity int) *MemoryStreams {
+	return &MemoryStreams{
+		capacity: capacity,
+		streams:  make(map[string]*memoryStream),
+		notify:   make(chan struct{}),
+	}
+}
+
+func (m *MemoryStreams) StoreVote(ctx context.Context, network string, voteInfo types.EventDataVote) error {
+	return m.addLive(network, common.StreamVotes, voteInfo.Vote.Height, map[string]interface{}{
+		"validator":  voteInfo.Vote.ValidatorAddress.String(),
+		"round":      strconv.FormatInt(int64(voteInfo.Vote.Round), 10),
+		"signature":  string(voteInfo.Vote.Signature),
+		"index":      strconv.FormatInt(int64(voteInfo.Vote.ValidatorIndex), 10),
+		"block_hash": voteInfo.Vote.BlockID.String(),
+		"type":       voteInfo.Vote.Type.String(),
+		"timestamp":  voteInfo.Vote.Timestamp.String(),
+	})
+}
+
+func (m *MemoryStreams) StoreNewRound(ctx context.Context, network string, roundInfo types.EventDataNewRound) error {
+	return m.addLive(network, common.StreamNewRound, roundInfo.Height, map[string]interface{}{
+		"round":          strconv.FormatInt(int64(roundInfo.Round), 10),
+		"step":           roundInfo.Step,
+		"proposer":       roundInfo.Proposer.Address.String(),
+		"proposer_index": strconv.FormatInt(int64(roundInfo.Proposer.Index), 10),
+	})
+}
+
+func (m *MemoryStreams) StoreNewRoundStep(
+	ctx context.Context,
+	network string,
+	roundInfo types.EventDataRoundState,
+	receivedAt time.Time,
+) error {
+	return m.addLive(network, common.StreamNewRoundStep, roundInfo.Height, map[string]interface{}{
+		"round":       strconv.FormatInt(int64(roundInfo.Round), 10),
+		"step":        roundInfo.Step,
+		"received_at": formatReceivedAt(receivedAt),
+	})
+}
+
+func (m *MemoryStreams) StoreCompleteProposal(
+	ctx context.Context,
+	network string,
+	proposalInfo types.EventDataCompleteProposal,
+	receivedAt time.Time,
+) error {
+	return m.add(common.StreamKey(network, common.StreamCompleteProposal), proposalInfo.Height, map[string]interface{}{
+		"round":       strconv.FormatInt(int64(proposalInfo.Round), 10),
+		"step":        proposalInfo.Step,
+		"block_id":    proposalInfo.BlockID.String(),
+		"received_at": formatReceivedAt(receivedAt),
+	})
+}
+
+func (m *MemoryStreams) StoreRoundEvent(
+	ctx context.Context,
+	network string,
+	eventType string,
+	roundInfo types.EventDataRoundState,
+	receivedAt time.Time,
+) error {
+	stream, ok := common.RoundEventStreams[eventType]
+	if !ok {
+		return fmt.Errorf("unsupported round event %s", eventType)
+	}
+	return m.add(common.StreamKey(network, stream), roundInfo.Height, map[string]interface{}{
+		"round":       strconv.FormatInt(int64(roundInfo.Round), 10),
+		"step":        roundInfo.Step,
+		"received_at": formatReceivedAt(receivedAt),
+	})
+}
+
+func (m *MemoryStreams) StoreNewBlockHeader(ctx context.Context, network string, headerInfo types.EventDataNewBlockHeader) error {
+	return m.storeBlock(network, headerInfo.Header.Height, newBlockFields(headerInfo.Header, nil))
+}
+
+func (m *MemoryStreams) StoreNewBlock(ctx context.Context, network string, blockInfo types.EventDataNewBlock) error {
+	if blockInfo.Block == nil {
+		return fmt.Errorf("block is nil")
+	}
+	return m.storeBlock(network, blockInfo.Block.Height, newBlockFields(blockInfo.Block.Header, blockInfo.Block))
+}
+
+func (m *MemoryStreams) storeBlock(network string, height int64, fields blockFields) error {
+	return m.add(common.StreamKey(network, common.StreamBlocks), height, map[string]interface{}{
+		"time":                fields.time,
+		"proposer":            fields.proposer,
+		"num_txs":             fields.numTxs,
+		"last_commit_round":   fields.lastCommitRound,
+		"last_commit_signers": fields.lastCommitSigners,
+	})
+}
+
+// adds a message with the next id of the height, like redis messages can't be added for heights
+// lower than the height of the newest message
+func (m *MemoryStreams) add(key string, height int64, values map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.insert(key, height, values, m.capacity); err != nil {
+		return err
+	}
+	m.wake()
+	return nil
+}
+
+// adds a message to the stream of a network and to its live stream, see common.LiveStreams
+func (m *MemoryStreams) addLive(network string, stream string, height int64, values map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.insert(common.StreamKey(network, stream), height, values, m.capacity); err != nil {
+		return err
+	}
+	// both streams are only written together, so the message has the same id in the live stream
+	if err := m.insert(common.LiveStreamKey(network, stream), height, values, min(m.capacity, LiveStreamLength)); err != nil {
+		return err
+	}
+	m.wake()
+	return nil
+}
+
+// inserts a message into a stream holding up to capacity messages. Must be called with the lock held
+func (m *MemoryStreams) insert(key string, height int64, values map[string]interface{}, capacity int) error {
+	stream := m.stream(key)
+	id := streamID{height: uint64(height), seq: 1}
+	if id.height == stream.lastID.height {
+		id.seq = stream.lastID.seq + 1
+	} else if id.height < stream.lastID.height {
+		return fmt.Errorf("height %d is lower than the height of the newest message of %s", height, key)
+	}
+	if len(stream.entries) >= capacity {
+		stream.evict()
+	}
+	stream.entries = append(stream.entries, &memoryEntry{id: id, values: values})
+	stream.length++
+	stream.lastID = id
+	return nil
+}
+
+// wakes up blocked readers. Must be called with the lock held
+func (m *MemoryStreams) wake() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// returns the stream, creating it if it doesn't exist. Must be called with the lock held
+func (m *MemoryStreams) stream(key string) *memoryStream {
+	stream, ok := m.streams[key]
+	if !ok {
+		stream = &memoryStream{groups: make(map[string]*memoryGroup)}
+		m.streams[key] = stream
+	}
+	return stream
+}
+
+// drops the oldest message, removing it from the pending messages of all groups
+func (s *memoryStream) evict() {
+	oldest := s.entries[0]
+	s.entries[0] = nil
+	s.entries = s.entries[1:]
+	if !oldest.deleted {
+		s.length--
+	}
+	for _, group := range s.groups {
+		delete(group.pending, oldest.id)
+	}
+}
+
+// removes acknowledged messages from the front of the stream
+func (s *memoryStream) compact() {
+	for len(s.entries) > 0 && s.entries[0].deleted {
+		s.entries[0] = nil
+		s.entries = s.entries[1:]
+	}
+}
+
+// returns the index of the first entry with an id greater than id
+func (s *memoryStream) after(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return id.less(s.entries[i].id)
+	})
+}
+
+func (m *MemoryStreams) CreateGroup(ctx context.Context, stream string, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stream(stream)
+	if _, ok := s.groups[group]; !ok {
+		s.groups[group] = &memoryGroup{pending: make(map[streamID]*pendingEntry)}
+	}
+	return nil
+}
+
+func (m *MemoryStreams) ReadGroup(
+	ctx context.Context,
+	stream string,
+	group string,
+	consumer string,
+	id string,
+	count int64,
+	block time.Duration,
+) ([]Message, error) {
+	if id != ">" {
+		return m.readPending(stream, group, consumer, id, count)
+	}
+	var messages []Message
+	err := m.wait(ctx, block, func() (bool, error) {
+		s, ok := m.streams[stream]
+		if !ok || s.groups[group] == nil {
+			return false, fmt.Errorf("consumer group %s of %s does not exist", group, stream)
+		}
+		g := s.groups[group]
+		now := time.Now()
+		for _, entry := range s.entries[s.after(g.lastDelivered):] {
+			if count > 0 && int64(len(messages)) >= count {
+				break
+			}
+			if entry.deleted {
+				continue
+			}
+			g.pending[entry.id] = &pendingEntry{entry: entry, consumer: consumer, delivered: now}
+			g.lastDelivered = entry.id
+			messages = append(messages, entry.message(stream))
+		}
+		return len(messages) > 0, nil
+	})
+	return messages, err
+}
+
+// returns the messages pending for the consumer following id
+func (m *MemoryStreams) readPending(stream string, group string, consumer string, id string, count int64) ([]Message, error) {
+	after, err := parseStreamID(id)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.streams[stream]
+	if !ok || s.groups[group] == nil {
+		return nil, fmt.Errorf("consumer group %s of %s does not exist", group, stream)
+	}
+	var pending []*pendingEntry
+	for _, p := range s.groups[group].pending {
+		if p.consumer == consumer && after.less(p.entry.id) {
+			pending = append(pending, p)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].entry.id.less(pending[j].entry.id) })
+	if count > 0 && int64(len(pending)) > count {
+		pending = pending[:count]
+	}
+	messages := make([]Message, 0, len(pending))
+	for _, p := range pending {
+		messages = append(messages, p.entry.message(stream))
+	}
+	return messages, nil
+}
+
+func (m *MemoryStreams) Claim(
+	ctx context.Context,
+	stream string,
+	group string,
+	consumer string,
+	minIdle time.Duration,
+) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.streams[stream]
+	if !ok || s.groups[group] == nil {
+		return nil, fmt.Errorf("consumer group %s of %s does not exist", group, stream)
+	}
+	var (
+		claimed []*pendingEntry
+		now     = time.Now()
+	)
+	for _, p := range s.groups[group].pending {
+		if now.Sub(p.delivered) >= minIdle {
+			p.consumer, p.delivered = consumer, now
+			claimed = append(claimed, p)
+		}
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].entry.id.less(claimed[j].entry.id) })
+	messages := make([]Message, 0, len(claimed))
+	for _, p := range claimed {
+		messages = append(messages, p.entry.message(stream))
+	}
+	return messages, nil
+}
+
+func (m *MemoryStreams) Ack(ctx context.Context, stream string, group string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.streams[stream]
+	if !ok {
+		return nil
+	}
+	for _, id := range ids {
+		parsed, err := parseStreamID(id)
+		if err != nil {
+			return err
+		}
+		if g, ok := s.groups[group]; ok {
+			delete(g.pending, parsed)
+		}
+		if i := s.after(parsed.prev()); i < len(s.entries) && s.entries[i].id == parsed && !s.entries[i].deleted {
+			s.entries[i].deleted = true
+			s.length--
+		}
+	}
+	s.compact()
+	return nil
+}
+
+func (m *MemoryStreams) Read(ctx context.Context, streams []string, ids []string, block time.Duration) ([]Message, error) {
+	if len(streams) != len(ids) {
+		return nil, fmt.Errorf("expected an id for each of the %d streams", len(streams))
+	}
+	after := make([]streamID, len(ids))
+	for i, id := range ids {
+		parsed, err := parseStreamID(id)
+		if err != nil {
+			return nil, err
+		}
+		after[i] = parsed
+	}
+	var messages []Message
+	err := m.wait(ctx, block, func() (bool, error) {
+		for i, key := range streams {
+			s, ok := m.streams[key]
+			if !ok {
+				continue
+			}
+			for _, entry := range s.entries[s.after(after[i]):] {
+				if !entry.deleted {
+					messages = append(messages, entry.message(key))
+				}
+			}
+		}
+		return len(messages) > 0, nil
+	})
+	return messages, err
+}
+
+func (m *MemoryStreams) LastID(ctx context.Context, stream string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.streams[stream]; ok {
+		return s.lastID.String(), nil
+	}
+	return streamID{}.String(), nil
+}
+
+func (m *MemoryStreams) Info(ctx context.Context, stream string, group string) (StreamInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var info StreamInfo
+	s, ok := m.streams[stream]
+	if !ok {
+		return info, nil
+	}
+	info.Length = int64(s.length)
+	if g, ok := s.groups[group]; ok {
+		info.Pending = int64(len(g.pending))
+		for _, entry := range s.entries[s.after(g.lastDelivered):] {
+			if !entry.deleted {
+				info.Lag++
+			}
+		}
+	}
+	return info, nil
+}
+
+func (m *MemoryStreams) FlushAll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams = make(map[string]*memoryStream)
+	return nil
+}
+
+func (m *MemoryStreams) Close() error {
+	return nil
+}
+
+// calls read with the lock held until it returns true, ctx is cancelled or block elapses.
+// A block of 0 waits until ctx is cancelled
+func (m *MemoryStreams) wait(ctx context.Context, block time.Duration, read func() (bool, error)) error {
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		m.mu.Lock()
+		done, err := read()
+		notify := m.notify
+		m.mu.Unlock()
+		if done || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return nil
+		case <-notify:
+		}
+	}
+}
+
+func (e *memoryEntry) message(stream string) Message {
+	return Message{Stream: stream, ID: e.id.String(), Values: e.values}
+}
+
+// the id of a message, made up of the height and a sequence number within the height
+type streamID struct {
+	height uint64
+	seq    uint64
+}
+
+func parseStreamID(id string) (streamID, error) {
+	heightPart, seqPart, found := strings.Cut(id, "-")
+	height, err := strconv.ParseUint(heightPart, 10, 64)
+	if err != nil {
+		return streamID{}, fmt.Errorf("invalid stream id %s", id)
+	}
+	if !found {
+		return streamID{height: height}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return streamID{}, fmt.Errorf("invalid stream id %s", id)
+	}
+	return streamID{height: height, seq: seq}, nil
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.height < other.height || (id.height == other.height && id.seq < other.seq)
+}
+
+// returns the id preceding id
+func (id streamID) prev() streamID {
+	if id.seq > 0 {
+		return streamID{height: id.height, seq: id.seq - 1}
+	}
+	if id.height == 0 {
+		return id
+	}
+	return streamID{height: id.height - 1, seq: ^uint64(0)}
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.height, id.seq)
+}
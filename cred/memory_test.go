@@ -0,0 +1,82 @@
+package cred_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStreams(t *testing.T) {
+	ctx := context.Background()
+	streams := cred.NewMemoryStreams(4)
+	require.NoError(t, streams.CreateGroup(ctx, "osmosis:votes", "ctop"))
+
+	for i := int64(10); i < 12; i++ {
+		require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: exampleVote(i, byte(cmtproto.PrevoteType))}))
+		require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: exampleVote(i, byte(cmtproto.PrecommitType))}))
+	}
+	// like redis, messages can't be added for heights lower than the newest message
+	require.Error(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: exampleVote(9, byte(cmtproto.PrevoteType))}))
+
+	msgs, err := streams.ReadGroup(ctx, "osmosis:votes", "ctop", "a", ">", 3, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	require.Equal(t, []string{"10-1", "10-2", "11-1"}, []string{msgs[0].ID, msgs[1].ID, msgs[2].ID})
+	require.Equal(t, "SIGNED_MSG_TYPE_PREVOTE", msgs[0].Values["type"])
+	require.Equal(t, "2", msgs[0].Values["round"])
+
+	info, err := streams.Info(ctx, "osmosis:votes", "ctop")
+	require.NoError(t, err)
+	require.Equal(t, cred.StreamInfo{Length: 4, Lag: 1, Pending: 3}, info)
+
+	// pending messages are returned to their consumer until acknowledged
+	require.NoError(t, streams.Ack(ctx, "osmosis:votes", "ctop", "10-1"))
+	pending, err := streams.ReadGroup(ctx, "osmosis:votes", "ctop", "a", "0", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, "10-2", pending[0].ID)
+
+	// idle messages are claimed by other consumers
+	time.Sleep(5 * time.Millisecond)
+	claimed, err := streams.Claim(ctx, "osmosis:votes", "ctop", "b", time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	pending, err = streams.ReadGroup(ctx, "osmosis:votes", "ctop", "a", "0", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	// blocked reads return once a message is added
+	read := make(chan []cred.Message)
+	go func() {
+		msgs, err := streams.ReadGroup(ctx, "osmosis:votes", "ctop", "a", ">", 10, time.Second)
+		require.NoError(t, err)
+		read <- msgs
+	}()
+	msgs, err = streams.ReadGroup(ctx, "osmosis:votes", "ctop", "a", ">", 10, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: exampleVote(12, byte(cmtproto.PrevoteType))}))
+	select {
+	case msgs := <-read:
+		require.Len(t, msgs, 1)
+		require.Equal(t, "12-1", msgs[0].ID)
+	case <-time.After(time.Second):
+		t.Fatal("blocked read did not return")
+	}
+
+	// once full the oldest messages are dropped
+	require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: exampleVote(13, byte(cmtproto.PrevoteType))}))
+	lastID, err := streams.LastID(ctx, "osmosis:votes")
+	require.NoError(t, err)
+	require.Equal(t, "13-1", lastID)
+	all, err := streams.Read(ctx, []string{"osmosis:votes"}, []string{"0-0"}, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	require.Equal(t, "11-1", all[0].ID)
+	require.Equal(t, "osmosis:votes", all[0].Stream)
+}
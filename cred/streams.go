@@ -0,0 +1,63 @@
+package cred
+
+import (
+	"context"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+)
+
+// Streams stores the events of every network in streams keyed by common.StreamKey, from which they are
+// consumed through consumer groups. Messages are identified by ids of the form <height>-<sequence>
+type Streams interface {
+	StoreVote(ctx context.Context, network string, voteInfo types.EventDataVote) error
+	StoreNewRound(ctx context.Context, network string, roundInfo types.EventDataNewRound) error
+	// receivedAt is the time the event was received from the node, allowing the progress of consensus to be
+	// timed independently of when the event is persisted
+	StoreNewRoundStep(ctx context.Context, network string, roundInfo types.EventDataRoundState, receivedAt time.Time) error
+	StoreCompleteProposal(ctx context.Context, network string, proposalInfo types.EventDataCompleteProposal, receivedAt time.Time) error
+	// Stores a round state event published for eventType, one of common.RoundEventTypes
+	StoreRoundEvent(ctx context.Context, network string, eventType string, roundInfo types.EventDataRoundState, receivedAt time.Time) error
+	// Headers and blocks are both written to the blocks stream, blocks adding the tx count and last commit
+	StoreNewBlockHeader(ctx context.Context, network string, headerInfo types.EventDataNewBlockHeader) error
+	StoreNewBlock(ctx context.Context, network string, blockInfo types.EventDataNewBlock) error
+
+	// Creates a consumer group delivering the stream from its first message, creating the stream if it
+	// doesn't exist. Groups which already exist are left unchanged
+	CreateGroup(ctx context.Context, stream string, group string) error
+	// Reads up to count messages for a consumer of the group. An id of ">" reads messages never delivered
+	// to the group, blocking for up to block if there are none, any other id reads the messages pending
+	// for the consumer after that id
+	ReadGroup(ctx context.Context, stream string, group string, consumer string, id string, count int64, block time.Duration) ([]Message, error)
+	// Transfers messages which have been pending for longer than minIdle to the consumer
+	Claim(ctx context.Context, stream string, group string, consumer string, minIdle time.Duration) ([]Message, error)
+	// Acknowledges messages, removing them from the stream
+	Ack(ctx context.Context, stream string, group string, ids ...string) error
+
+	// Reads messages following ids[i] from streams[i], blocking for up to block if there are none
+	Read(ctx context.Context, streams []string, ids []string, block time.Duration) ([]Message, error)
+	// Returns the id of the newest message added to the stream, even if it has since been deleted, or 0-0 if
+	// nothing was added to the stream
+	LastID(ctx context.Context, stream string) (string, error)
+	// Returns the length of the stream, and the lag and pending messages of the group
+	Info(ctx context.Context, stream string, group string) (StreamInfo, error)
+
+	FlushAll(ctx context.Context) error
+	Close() error
+}
+
+// a message read from a stream, values are encoded as strings
+type Message struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+}
+
+type StreamInfo struct {
+	// number of messages in the stream
+	Length int64
+	// number of messages which have not been delivered to the group
+	Lag int64
+	// number of messages delivered to the group which have not been acknowledged
+	Pending int64
+}
@@ -1,6 +1,16 @@
 package cred
 
-import "github.com/redis/go-redis/v9"
+import (
+	"strconv"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/redis/go-redis/v9"
+)
+
+// approximate number of messages kept by every live stream, see common.LiveStreams
+const LiveStreamLength = 10_000
 
 var VotesLuaScript = redis.NewScript(`
 local base_key = ARGV[1]
@@ -12,6 +22,7 @@ local index = ARGV[6]
 local block_hash = ARGV[7]
 local vote_type = ARGV[8]
 local timestamp = ARGV[9]
+local live_length = ARGV[10]
 
 -- Generate the sequence key based on the base key and block height
 local sequence_key = base_key .. ":sequence_vote:" .. block_height
@@ -22,8 +33,10 @@ local sequence = redis.call("INCR", sequence_key)
 -- Construct the ID
 local id = block_height .. "-" .. sequence
 
--- Add entry to the stream
-redis.call("XADD", base_key .. ":votes", id, "validator", validator, "round", round, "signature", signature, "index", index, "block_hash", block_hash, "type", vote_type, "timestamp", timestamp)
+-- Add entry to the stream, and to the live stream which is never acknowledged
+local fields = {"validator", validator, "round", round, "signature", signature, "index", index, "block_hash", block_hash, "type", vote_type, "timestamp", timestamp}
+redis.call("XADD", base_key .. ":votes", id, unpack(fields))
+redis.call("XADD", base_key .. ":votes:live", "MAXLEN", "~", live_length, id, unpack(fields))
 
 return id
 `)
@@ -33,6 +46,8 @@ local base_key = ARGV[1]
 local block_height = ARGV[2]
 local round = ARGV[3]
 local step = ARGV[4]
+local received_at = ARGV[5]
+local live_length = ARGV[6]
 
 -- Generate the sequence key based on the base key and block height
 local sequence_key = base_key .. ":sequence_round_step:" .. block_height
@@ -43,8 +58,10 @@ local sequence = redis.call("INCR", sequence_key)
 -- Construct the ID
 local id = block_height .. "-" .. sequence
 
--- Add entry to the stream
-redis.call("XADD", base_key .. ":new_round_step", id, "round", round, "step", step)
+-- Add entry to the stream, and to the live stream which is never acknowledged
+local fields = {"round", round, "step", step, "received_at", received_at}
+redis.call("XADD", base_key .. ":new_round_step", id, unpack(fields))
+redis.call("XADD", base_key .. ":new_round_step:live", "MAXLEN", "~", live_length, id, unpack(fields))
 
 return id
 `)
@@ -56,6 +73,7 @@ local round = ARGV[3]
 local step = ARGV[4]
 local proposer = ARGV[5]
 local proposer_index = ARGV[6]
+local live_length = ARGV[7]
 
 -- Generate the sequence key based on the base key and block height
 local sequence_key = base_key .. ":sequence_round:" .. block_height
@@ -66,12 +84,120 @@ local sequence = redis.call("INCR", sequence_key)
 -- Construct the ID
 local id = block_height .. "-" .. sequence
 
+-- Add entry to the stream, and to the live stream which is never acknowledged
+local fields = {"round", round, "step", step, "proposer", proposer, "proposer_index", proposer_index}
+redis.call("XADD", base_key .. ":new_round", id, unpack(fields))
+redis.call("XADD", base_key .. ":new_round:live", "MAXLEN", "~", live_length, id, unpack(fields))
+
+return id
+`)
+
+var CompleteProposalScript = redis.NewScript(`
+local base_key = ARGV[1]
+local block_height = ARGV[2]
+local round = ARGV[3]
+local step = ARGV[4]
+local block_id = ARGV[5]
+local received_at = ARGV[6]
+
+-- Generate the sequence key based on the base key and block height
+local sequence_key = base_key .. ":sequence_complete_proposal:" .. block_height
+
+-- Increment the sequence counter
+local sequence = redis.call("INCR", sequence_key)
+
+-- Construct the ID
+local id = block_height .. "-" .. sequence
+
 -- Add entry to the stream
-redis.call("XADD", base_key .. ":new_round", id, 
-           "round", round, 
-           "step", step, 
-           "proposer", proposer, 
-           "proposer_index", proposer_index)
+redis.call("XADD", base_key .. ":complete_proposal", id,
+           "round", round,
+           "step", step,
+           "block_id", block_id,
+           "received_at", received_at)
 
 return id
 `)
+
+var RoundEventScript = redis.NewScript(`
+local base_key = ARGV[1]
+local stream = ARGV[2]
+local block_height = ARGV[3]
+local round = ARGV[4]
+local step = ARGV[5]
+local received_at = ARGV[6]
+
+-- Generate the sequence key based on the base key, stream and block height
+local sequence_key = base_key .. ":sequence_" .. stream .. ":" .. block_height
+
+-- Increment the sequence counter
+local sequence = redis.call("INCR", sequence_key)
+
+-- Construct the ID
+local id = block_height .. "-" .. sequence
+
+-- Add entry to the stream
+redis.call("XADD", base_key .. ":" .. stream, id, "round", round, "step", step, "received_at", received_at)
+
+return id
+`)
+
+var BlockScript = redis.NewScript(`
+local base_key = ARGV[1]
+local block_height = ARGV[2]
+local time = ARGV[3]
+local proposer = ARGV[4]
+local num_txs = ARGV[5]
+local last_commit_round = ARGV[6]
+local last_commit_signers = ARGV[7]
+
+-- Generate the sequence key based on the base key and block height
+local sequence_key = base_key .. ":sequence_block:" .. block_height
+
+-- Increment the sequence counter
+local sequence = redis.call("INCR", sequence_key)
+
+-- Construct the ID
+local id = block_height .. "-" .. sequence
+
+-- Add entry to the stream
+redis.call("XADD", base_key .. ":blocks", id,
+           "time", time,
+           "proposer", proposer,
+           "num_txs", num_txs,
+           "last_commit_round", last_commit_round,
+           "last_commit_signers", last_commit_signers)
+
+return id
+`)
+
+// formats the time an event was received for storage in a stream
+func formatReceivedAt(receivedAt time.Time) string {
+	return receivedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// values of a block stored in the blocks stream, the tx count and last commit are empty for block headers
+type blockFields struct {
+	time              string
+	proposer          string
+	numTxs            string
+	lastCommitRound   string
+	lastCommitSigners string
+}
+
+func newBlockFields(header types.Header, block *types.Block) blockFields {
+	fields := blockFields{
+		time:     header.Time.UTC().Format(time.RFC3339Nano),
+		proposer: header.ProposerAddress.String(),
+	}
+	if block == nil {
+		return fields
+	}
+	fields.numTxs = strconv.Itoa(len(block.Data.Txs))
+	// the first block has an empty last commit
+	if block.LastCommit != nil && len(block.LastCommit.Signatures) > 0 {
+		fields.lastCommitRound = strconv.FormatInt(int64(block.LastCommit.Round), 10)
+		fields.lastCommitSigners = common.CommitSigners(block.LastCommit)
+	}
+	return fields
+}
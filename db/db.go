@@ -3,8 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/rangesecurity/ctop/bun/migrations"
+	sqlitemigrations "github.com/rangesecurity/ctop/bun/migrations/sqlite"
 	"github.com/rangesecurity/ctop/common"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
@@ -17,27 +22,59 @@ type Database struct {
 	DB *bun.DB
 }
 
+// Opens the database at url, a sqlite database if the url starts with sqlite:// and postgres otherwise
 func New(url string) (*Database, error) {
 	db := OpenDB(url)
 	return &Database{DB: db}, nil
 }
 
+// Opens a postgres database
+func NewPostgres(url string) (*Database, error) {
+	return &Database{DB: OpenPostgres(url)}, nil
+}
+
+// Opens the sqlite database at path, creating it if it doesn't exist
+func NewSQLite(path string) (*Database, error) {
+	return &Database{DB: OpenSQLite(path)}, nil
+}
+
+// Closes the connection pool of the database
+func (d *Database) Close() error {
+	return d.DB.Close()
+}
+
 func (d *Database) StoreVote(
 	ctx context.Context,
 	network string,
 	vote common.ParsedVote,
 ) error {
-	_, err := d.DB.NewInsert().Model(&VoteEvent{
-		Network:            network,
-		VoteType:           vote.Type,
-		Height:             int(vote.Height),
-		Round:              int(vote.Round),
-		BlockID:            vote.BlockID,
-		BlockTimestamp:     vote.Timestamp,
-		ValidatorAddress:   vote.ValidatorAddress,
-		ValidatorIndex:     int(vote.ValidatorIndex),
-		ValidatorSignature: vote.Signature,
-	}).Exec(ctx)
+	return d.StoreVotes(ctx, network, []common.ParsedVote{vote})
+}
+
+// Stores votes using a single multi row insert
+func (d *Database) StoreVotes(
+	ctx context.Context,
+	network string,
+	votes []common.ParsedVote,
+) error {
+	if len(votes) == 0 {
+		return nil
+	}
+	events := make([]VoteEvent, 0, len(votes))
+	for _, vote := range votes {
+		events = append(events, VoteEvent{
+			Network:            network,
+			VoteType:           vote.Type,
+			Height:             int(vote.Height),
+			Round:              int(vote.Round),
+			BlockID:            vote.BlockID,
+			BlockTimestamp:     vote.Timestamp,
+			ValidatorAddress:   vote.ValidatorAddress,
+			ValidatorIndex:     int(vote.ValidatorIndex),
+			ValidatorSignature: vote.Signature,
+		})
+	}
+	_, err := d.DB.NewInsert().Model(&events).Exec(ctx)
 	return err
 }
 
@@ -46,14 +83,30 @@ func (d *Database) StoreNewRound(
 	network string,
 	roundInfo common.ParsedNewRound,
 ) error {
-	_, err := d.DB.NewInsert().Model(&NewRoundEvent{
-		Network:          network,
-		Height:           int(roundInfo.Height),
-		Round:            int(roundInfo.Round),
-		Step:             roundInfo.Step,
-		ValidatorAddress: roundInfo.ProposerAddress,
-		ValidatorIndex:   int(roundInfo.ProposerIndex),
-	}).Exec(ctx)
+	return d.StoreNewRounds(ctx, network, []common.ParsedNewRound{roundInfo})
+}
+
+// Stores new round events using a single multi row insert
+func (d *Database) StoreNewRounds(
+	ctx context.Context,
+	network string,
+	rounds []common.ParsedNewRound,
+) error {
+	if len(rounds) == 0 {
+		return nil
+	}
+	events := make([]NewRoundEvent, 0, len(rounds))
+	for _, roundInfo := range rounds {
+		events = append(events, NewRoundEvent{
+			Network:          network,
+			Height:           int(roundInfo.Height),
+			Round:            int(roundInfo.Round),
+			Step:             roundInfo.Step,
+			ValidatorAddress: roundInfo.ProposerAddress,
+			ValidatorIndex:   int(roundInfo.ProposerIndex),
+		})
+	}
+	_, err := d.DB.NewInsert().Model(&events).Exec(ctx)
 	return err
 }
 
@@ -62,42 +115,384 @@ func (d *Database) StoreNewRoundStep(
 	network string,
 	roundInfo common.ParsedNewRoundStep,
 ) error {
-	_, err := d.DB.NewInsert().Model(&NewRoundStepEvent{
-		Network: network,
-		Height:  int(roundInfo.Height),
-		Round:   int(roundInfo.Round),
-		Step:    roundInfo.Step,
-	}).Exec(ctx)
+	return d.StoreNewRoundSteps(ctx, network, []common.ParsedNewRoundStep{roundInfo})
+}
+
+// Stores new round step events using a single multi row insert. Commit steps set the commit round of stored
+// blocks whose commit round is unknown
+func (d *Database) StoreNewRoundSteps(
+	ctx context.Context,
+	network string,
+	steps []common.ParsedNewRoundStep,
+) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	var (
+		events  = make([]NewRoundStepEvent, 0, len(steps))
+		commits []int64
+	)
+	for _, roundInfo := range steps {
+		events = append(events, NewRoundStepEvent{
+			Network:    network,
+			Height:     int(roundInfo.Height),
+			Round:      int(roundInfo.Round),
+			Step:       roundInfo.Step,
+			ReceivedAt: roundInfo.ReceivedAt,
+		})
+		if roundInfo.Step == roundStepCommit {
+			commits = append(commits, roundInfo.Height)
+		}
+	}
+	if len(commits) == 0 {
+		_, err := d.DB.NewInsert().Model(&events).Exec(ctx)
+		return err
+	}
+	return d.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&events).Exec(ctx); err != nil {
+			return err
+		}
+		return setCommitRounds(ctx, tx, network, commits)
+	})
+}
+
+// Stores complete proposal events using a single multi row insert
+func (d *Database) StoreCompleteProposals(
+	ctx context.Context,
+	network string,
+	proposals []common.ParsedCompleteProposal,
+) error {
+	if len(proposals) == 0 {
+		return nil
+	}
+	events := make([]CompleteProposalEvent, 0, len(proposals))
+	for _, proposalInfo := range proposals {
+		events = append(events, CompleteProposalEvent{
+			Network:    network,
+			Height:     int(proposalInfo.Height),
+			Round:      int(proposalInfo.Round),
+			Step:       proposalInfo.Step,
+			BlockID:    proposalInfo.BlockID,
+			ReceivedAt: proposalInfo.ReceivedAt,
+		})
+	}
+	_, err := d.DB.NewInsert().Model(&events).Exec(ctx)
+	return err
+}
+
+// Stores round state events using a single multi row insert
+func (d *Database) StoreRoundEvents(
+	ctx context.Context,
+	network string,
+	roundEvents []common.ParsedRoundEvent,
+) error {
+	if len(roundEvents) == 0 {
+		return nil
+	}
+	events := make([]RoundStateEvent, 0, len(roundEvents))
+	for _, roundEvent := range roundEvents {
+		events = append(events, RoundStateEvent{
+			Network:    network,
+			EventType:  roundEvent.Type,
+			Height:     int(roundEvent.Height),
+			Round:      int(roundEvent.Round),
+			Step:       roundEvent.Step,
+			ReceivedAt: roundEvent.ReceivedAt,
+		})
+	}
+	_, err := d.DB.NewInsert().Model(&events).Exec(ctx)
 	return err
 }
 
+// Stores blocks, setting the commit round of the blocks preceding them from their last commit. Blocks stored
+// from headers, which have no last commit, take their commit round from the stored commit step of their height
+// until the next block is stored. Blocks which have already been stored are skipped
+func (d *Database) StoreBlocks(
+	ctx context.Context,
+	network string,
+	parsed []common.ParsedBlock,
+) error {
+	if len(parsed) == 0 {
+		return nil
+	}
+	var (
+		blocks  = make([]Block, 0, len(parsed))
+		heights = make([]int64, 0, len(parsed))
+	)
+	for _, block := range parsed {
+		heights = append(heights, block.Height)
+		blocks = append(blocks, Block{
+			Network:           network,
+			Height:            block.Height,
+			Time:              block.Time,
+			ProposerAddress:   block.ProposerAddress,
+			NumTxs:            intPtr(block.NumTxs),
+			LastCommitSigners: block.LastCommitSigners,
+		})
+	}
+	return d.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&blocks).On("CONFLICT (network, height) DO NOTHING").Exec(ctx); err != nil {
+			return err
+		}
+		if err := setCommitRounds(ctx, tx, network, heights); err != nil {
+			return err
+		}
+		for _, block := range parsed {
+			if block.LastCommitRound == nil {
+				continue
+			}
+			if _, err := tx.NewUpdate().
+				Model((*Block)(nil)).
+				Set("commit_round = ?", *block.LastCommitRound).
+				Where("network = ?", network).
+				Where("height = ?", block.Height-1).
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// step a height is committed in
+const roundStepCommit = "RoundStepCommit"
+
+// sets the commit round of the blocks at heights whose commit round is unknown to the round of the stored commit
+// step of their height
+func setCommitRounds(ctx context.Context, tx bun.Tx, network string, heights []int64) error {
+	var rounds []struct {
+		Height int64
+		Round  int
+	}
+	if err := tx.NewSelect().
+		Model((*NewRoundStepEvent)(nil)).
+		Column("height").
+		ColumnExpr("MAX(round) AS round").
+		Where("network = ?", network).
+		Where("step = ?", roundStepCommit).
+		Where("height IN (?)", bun.In(heights)).
+		Group("height").
+		Scan(ctx, &rounds); err != nil {
+		return err
+	}
+	for _, round := range rounds {
+		if _, err := tx.NewUpdate().
+			Model((*Block)(nil)).
+			Set("commit_round = ?", round.Round).
+			Where("network = ?", network).
+			Where("height = ?", round.Height).
+			Where("commit_round IS NULL").
+			Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func intPtr(value *int64) *int {
+	if value == nil {
+		return nil
+	}
+	v := int(*value)
+	return &v
+}
+
+// Replaces the validator set of a network with the set active at height, see updateValidators
 func (d *Database) StoreOrUpdateValidators(
 	ctx context.Context,
 	network string,
+	height int64,
 	data map[string]interface{},
+) error {
+	return d.updateValidators(ctx, network, height, func(map[string]ValidatorInfo) map[string]interface{} {
+		return data
+	})
+}
+
+// Applies the voting power and public keys of validators taking effect at height to the stored validator set,
+// a voting power of 0 removing the validator. The proposer priority of updates is ignored, validators joining
+// the set have a proposer priority of 0 until the set is replaced by StoreOrUpdateValidators
+func (d *Database) ApplyValidatorUpdates(
+	ctx context.Context,
+	network string,
+	height int64,
+	updates map[string]ValidatorInfo,
+) error {
+	return d.updateValidators(ctx, network, height, func(current map[string]ValidatorInfo) map[string]interface{} {
+		data := make(map[string]interface{}, len(current)+len(updates))
+		for address, info := range current {
+			data[address] = info
+		}
+		for address, update := range updates {
+			if update.VotingPower == 0 {
+				delete(data, address)
+				continue
+			}
+			info := current[address]
+			info.VotingPower = update.VotingPower
+			if update.PubKey != "" {
+				info.PubKey = update.PubKey
+			}
+			data[address] = info
+		}
+		return data
+	})
+}
+
+// replaces the validator set of a network with the data returned by update, recording the changes of voting power
+// with height and keeping validator_set_members in sync. Sets older than the stored one are ignored, so a poll
+// racing an update can't revert it. The first set stored for a network isn't recorded as a change, as the heights
+// its validators joined at are unknown, its members are valid from height
+func (d *Database) updateValidators(
+	ctx context.Context,
+	network string,
+	height int64,
+	update func(current map[string]ValidatorInfo) map[string]interface{},
 ) error {
 	return d.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
-		var (
-			validators Validators
-			err        error
-		)
-		if err = tx.NewSelect().Model(&validators).Where("network = ?", network).Scan(ctx); err != nil {
+		var validators Validators
+		if err := tx.NewSelect().Model(&validators).Where("network = ?", network).Scan(ctx); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
 			validators = Validators{
 				Network: network,
-				Data:    data,
+				Height:  height,
+				Data:    update(nil),
+			}
+			if _, err = tx.NewInsert().Model(&validators).Exec(ctx); err != nil {
+				return err
+			}
+			return insertMembers(ctx, tx, network, height, validators.Info(), nil)
+		}
+		if height < validators.Height {
+			return nil
+		}
+		previous := validators.Info()
+		validators.Height = height
+		validators.Data = update(previous)
+		current := validators.Info()
+		changes := validatorSetChanges(network, height, previous, current)
+		if len(changes) > 0 {
+			if _, err := tx.NewInsert().Model(&changes).Exec(ctx); err != nil {
+				return err
+			}
+			if err := closeMembers(ctx, tx, network, height, changes); err != nil {
+				return err
 			}
-			_, err = tx.NewInsert().Model(&validators).Exec(ctx)
-		} else {
-			if validators.Data == nil {
-				validators.Data = make(map[string]interface{})
+			if err := insertMembers(ctx, tx, network, height, current, changes); err != nil {
+				return err
 			}
-			validators.Data = data
-			_, err = tx.NewUpdate().Model(&validators).Column("data").Where("network = ?", network).Exec(ctx)
 		}
+		// public keys of sets stored before they were recorded
+		for address, info := range current {
+			if before, ok := previous[address]; !ok || before.PubKey != "" || info.PubKey == "" {
+				continue
+			}
+			if _, err := tx.NewUpdate().
+				Model((*ValidatorSetMember)(nil)).
+				Set("pub_key = ?", info.PubKey).
+				Where("network = ?", network).
+				Where("validator_address = ?", address).
+				Where("valid_to_height IS NULL").
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewUpdate().Model(&validators).Column("height", "data").Where("network = ?", network).Exec(ctx)
 		return err
 	})
 }
 
+// ends the membership of validators which left the set or changed their voting power before height
+func closeMembers(ctx context.Context, tx bun.Tx, network string, height int64, changes []ValidatorSetChange) error {
+	var addresses []string
+	for _, change := range changes {
+		if change.Kind != ValidatorJoined {
+			addresses = append(addresses, change.ValidatorAddress)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	_, err := tx.NewUpdate().
+		Model((*ValidatorSetMember)(nil)).
+		Set("valid_to_height = ?", height-1).
+		Where("network = ?", network).
+		Where("validator_address IN (?)", bun.In(addresses)).
+		Where("valid_to_height IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// adds the validators of current which joined or changed their voting power as members valid from height, or every
+// validator of current if changes is nil
+func insertMembers(ctx context.Context, tx bun.Tx, network string, height int64, current map[string]ValidatorInfo, changes []ValidatorSetChange) error {
+	var members []ValidatorSetMember
+	add := func(address string) {
+		members = append(members, ValidatorSetMember{
+			Network:          network,
+			ValidatorAddress: address,
+			PubKey:           current[address].PubKey,
+			VotingPower:      current[address].VotingPower,
+			ValidFromHeight:  height,
+		})
+	}
+	if changes == nil {
+		for address := range current {
+			add(address)
+		}
+	}
+	for _, change := range changes {
+		if change.Kind != ValidatorLeft {
+			add(change.ValidatorAddress)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	_, err := tx.NewInsert().Model(&members).Exec(ctx)
+	return err
+}
+
+// returns the changes of voting power between two validator sets, ordered by address
+func validatorSetChanges(network string, height int64, previous, current map[string]ValidatorInfo) []ValidatorSetChange {
+	var changes []ValidatorSetChange
+	for address, info := range current {
+		before, ok := previous[address]
+		if ok && before.VotingPower == info.VotingPower {
+			continue
+		}
+		kind := ValidatorPowerChange
+		if !ok {
+			kind = ValidatorJoined
+		}
+		changes = append(changes, ValidatorSetChange{
+			Network:             network,
+			Height:              height,
+			ValidatorAddress:    address,
+			Kind:                kind,
+			VotingPower:         info.VotingPower,
+			PreviousVotingPower: before.VotingPower,
+		})
+	}
+	for address, before := range previous {
+		if _, ok := current[address]; !ok {
+			changes = append(changes, ValidatorSetChange{
+				Network:             network,
+				Height:              height,
+				ValidatorAddress:    address,
+				Kind:                ValidatorLeft,
+				PreviousVotingPower: before.VotingPower,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ValidatorAddress < changes[j].ValidatorAddress
+	})
+	return changes
+}
+
 func (d *Database) GetVotes(ctx context.Context, network string) (votes []VoteEvent, err error) {
 	err = d.DB.NewSelect().Model(&votes).Where("network = ?", network).Scan(ctx)
 	return
@@ -113,11 +508,95 @@ func (d *Database) GetNewRoundSteps(ctx context.Context, network string) (steps
 	return
 }
 
+// Returns the complete proposal events of a height, ordered by round
+func (d *Database) GetCompleteProposalsForHeight(ctx context.Context, network string, height int64) (proposals []CompleteProposalEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&proposals).
+		Where("network = ?", network).
+		Where("height = ?", height).
+		OrderExpr("round ASC, COALESCE(received_at, created_at) ASC").
+		Scan(ctx)
+	return
+}
+
+// Returns the round state events of a height in the order they were received
+func (d *Database) GetRoundEventsForHeight(ctx context.Context, network string, height int64) (events []RoundStateEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&events).
+		Where("network = ?", network).
+		Where("height = ?", height).
+		OrderExpr("round ASC, COALESCE(received_at, created_at) ASC").
+		Scan(ctx)
+	return
+}
+
+// Returns the blocks between fromHeight and toHeight inclusive, ordered by height
+func (d *Database) GetBlocksInHeightRange(ctx context.Context, network string, fromHeight int64, toHeight int64) (blocks []Block, err error) {
+	err = d.DB.NewSelect().
+		Model(&blocks).
+		Where("network = ?", network).
+		Where("height >= ?", fromHeight).
+		Where("height <= ?", toHeight).
+		Order("height ASC").
+		Scan(ctx)
+	return
+}
+
 func (d *Database) GetValidators(ctx context.Context, network string) (validators Validators, err error) {
 	err = d.DB.NewSelect().Model(&validators).Where("network = ?", network).Scan(ctx)
 	return
 }
 
+// Returns the validator set changes which took effect between fromHeight and toHeight inclusive, ordered by height
+func (d *Database) GetValidatorSetChanges(ctx context.Context, network string, fromHeight int64, toHeight int64) (changes []ValidatorSetChange, err error) {
+	err = d.DB.NewSelect().
+		Model(&changes).
+		Where("network = ?", network).
+		Where("height >= ?", fromHeight).
+		Where("height <= ?", toHeight).
+		Order("height ASC", "validator_address ASC").
+		Scan(ctx)
+	return
+}
+
+// Returns the members of the validator set active at height, ordered by voting power. The set is empty for heights
+// before the first set stored for the network
+func (d *Database) GetValidatorSetAt(ctx context.Context, network string, height int64) (members []ValidatorSetMember, err error) {
+	err = d.DB.NewSelect().
+		Model(&members).
+		Where("network = ?", network).
+		Where("valid_from_height <= ?", height).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("valid_to_height IS NULL").WhereOr("valid_to_height >= ?", height)
+		}).
+		Order("voting_power DESC", "validator_address ASC").
+		Scan(ctx)
+	return
+}
+
+// Replaces the identities of the validators of a network
+func (d *Database) StoreValidatorIdentities(ctx context.Context, network string, identities []ValidatorIdentity) error {
+	return d.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*ValidatorIdentity)(nil)).Where("network = ?", network).Exec(ctx); err != nil {
+			return err
+		}
+		if len(identities) == 0 {
+			return nil
+		}
+		for i := range identities {
+			identities[i].Network = network
+		}
+		_, err := tx.NewInsert().Model(&identities).Exec(ctx)
+		return err
+	})
+}
+
+// Returns the identities of the validators of a network, ordered by address
+func (d *Database) GetValidatorIdentities(ctx context.Context, network string) (identities []ValidatorIdentity, err error) {
+	err = d.DB.NewSelect().Model(&identities).Where("network = ?", network).Order("address ASC").Scan(ctx)
+	return
+}
+
 func (d *Database) GetLatestVotesForNetwork(
 	ctx context.Context,
 	network string,
@@ -133,20 +612,190 @@ func (d *Database) GetLatestVotesForNetwork(
 	err := d.DB.NewSelect().
 		Model(&voteEvents).
 		With("latest_heights", subquery).
-		TableExpr("vote_events AS ve").
-		Join("JOIN latest_heights AS lh ON ve.validator_address = lh.validator_address AND ve.network = lh.network AND ve.height = lh.max_height").
-		Where("ve.network IN (?)", bun.In([]string{network})).
+		Join("JOIN latest_heights AS lh ON vote_event.validator_address = lh.validator_address AND vote_event.network = lh.network AND vote_event.height = lh.max_height").
+		Where("vote_event.network IN (?)", bun.In([]string{network})).
 		Scan(ctx)
 	return voteEvents, err
 }
 
+// Returns all votes cast at the given height
+func (d *Database) GetVotesForHeight(ctx context.Context, network string, height int64) (votes []VoteEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&votes).
+		Where("network = ?", network).
+		Where("height = ?", height).
+		Order("round ASC").
+		Scan(ctx)
+	return
+}
+
+// Returns the highest height for which a vote has been stored, or 0 if no votes are stored
+func (d *Database) GetLatestVoteHeight(ctx context.Context, network string) (int64, error) {
+	var height sql.NullInt64
+	err := d.DB.NewSelect().
+		Model((*VoteEvent)(nil)).
+		ColumnExpr("MAX(height)").
+		Where("network = ?", network).
+		Scan(ctx, &height)
+	return height.Int64, err
+}
+
+// Returns the most recent round step, ordered by height and round
+func (d *Database) GetLatestNewRoundStep(ctx context.Context, network string) (step NewRoundStepEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&step).
+		Where("network = ?", network).
+		Order("height DESC", "round DESC", "created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	return
+}
+
+// Returns the most recent new round event for the given height
+func (d *Database) GetLatestNewRoundForHeight(ctx context.Context, network string, height int64) (round NewRoundEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&round).
+		Where("network = ?", network).
+		Where("height = ?", height).
+		Order("round DESC", "created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	return
+}
+
+// Returns the time at which the first round step of the given height was received,
+// falling back to the insert time for steps stored without a receive time
+func (d *Database) GetHeightStartTime(ctx context.Context, network string, height int64) (time.Time, error) {
+	var startTime time.Time
+	err := d.DB.NewSelect().
+		Model((*NewRoundStepEvent)(nil)).
+		ColumnExpr("MIN(COALESCE(received_at, created_at))").
+		Where("network = ?", network).
+		Where("height = ?", height).
+		Scan(ctx, &startTime)
+	return startTime, err
+}
+
+// Returns all votes cast between fromHeight and toHeight inclusive
+func (d *Database) GetVotesInHeightRange(
+	ctx context.Context,
+	network string,
+	fromHeight int64,
+	toHeight int64,
+) (votes []VoteEvent, err error) {
+	err = d.DB.NewSelect().
+		Model(&votes).
+		Where("network = ?", network).
+		Where("height >= ?", fromHeight).
+		Where("height <= ?", toHeight).
+		Order("height ASC", "round ASC").
+		Scan(ctx)
+	return
+}
+
+// Stores evidence of an equivocation, returning false if evidence for the same validator, height,
+// round and vote type has already been stored
+func (d *Database) StoreEquivocationEvidence(
+	ctx context.Context,
+	evidence *EquivocationEvidence,
+) (bool, error) {
+	res, err := d.DB.NewInsert().
+		Model(evidence).
+		On("CONFLICT (network, validator_address, height, round, vote_type) DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (d *Database) GetEquivocationEvidence(ctx context.Context, network string) (evidence []EquivocationEvidence, err error) {
+	err = d.DB.NewSelect().Model(&evidence).Where("network = ?", network).Order("height ASC").Scan(ctx)
+	return
+}
+
+// Returns the state of an alert, sql.ErrNoRows is returned if the alert has never fired
+func (d *Database) GetAlertState(
+	ctx context.Context,
+	analyzer string,
+	network string,
+	subject string,
+) (state AlertState, err error) {
+	err = d.DB.NewSelect().
+		Model(&state).
+		Where("analyzer = ?", analyzer).
+		Where("network = ?", network).
+		Where("subject = ?", subject).
+		Scan(ctx)
+	return
+}
+
+// Returns the state of all alerts of an analyzer which are currently firing
+func (d *Database) GetFiringAlertStates(
+	ctx context.Context,
+	analyzer string,
+	network string,
+) (states []AlertState, err error) {
+	err = d.DB.NewSelect().
+		Model(&states).
+		Where("analyzer = ?", analyzer).
+		Where("network = ?", network).
+		Where("status = ?", "firing").
+		Scan(ctx)
+	return
+}
+
+// Inserts or updates the state of an alert
+func (d *Database) StoreAlertState(ctx context.Context, state *AlertState) error {
+	_, err := d.DB.NewInsert().
+		Model(state).
+		On("CONFLICT (analyzer, network, subject) DO UPDATE").
+		Set("status = EXCLUDED.status").
+		Set("severity = EXCLUDED.severity").
+		Set("validator = EXCLUDED.validator").
+		Set("height = EXCLUDED.height").
+		Set("message = EXCLUDED.message").
+		Set("occurrences = EXCLUDED.occurrences").
+		Set("first_seen = EXCLUDED.first_seen").
+		Set("last_seen = EXCLUDED.last_seen").
+		Set("last_notified = EXCLUDED.last_notified").
+		Set("resolved_at = EXCLUDED.resolved_at").
+		Exec(ctx)
+	return err
+}
+
+// Creates the migration tables if needed and runs all migrations
 func (d *Database) CreateSchema(ctx context.Context) error {
-	migrator := migrate.NewMigrator(d.DB, migrations.Migrations)
+	migrator := migrate.NewMigrator(d.DB, Migrations(d.DB))
+	if err := migrator.Init(ctx); err != nil {
+		return err
+	}
 	_, err := migrator.Migrate(ctx)
 	return err
 }
 
+// Returns the migrations of the database, sqlite databases have their own migrations
+func Migrations(db *bun.DB) *migrate.Migrations {
+	if IsSQLiteDB(db) {
+		return sqlitemigrations.Migrations
+	}
+	return migrations.Migrations
+}
+
+// Opens a postgres database, or a sqlite database if the url starts with sqlite://
 func OpenDB(url string) *bun.DB {
+	if IsSQLite(url) {
+		return OpenSQLite(strings.TrimPrefix(url, sqliteScheme))
+	}
+	return OpenPostgres(url)
+}
+
+// Opens a postgres database
+func OpenPostgres(url string) *bun.DB {
 	sqldb := sql.OpenDB(pgdriver.NewConnector(
 		pgdriver.WithDSN(url),
 		pgdriver.WithTLSConfig(nil),
@@ -1,2 +1,3 @@
-// Package db provides a postgresql database client
+// Package db stores consensus events behind the Store interface, backed by postgres or, for tests, embedded
+// deployments and small installations, a sqlite file
 package db
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -32,6 +34,7 @@ type NewRoundEvent struct {
 	Step             string
 	ValidatorAddress string
 	ValidatorIndex   int
+	CreatedAt        time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
 
 type NewRoundStepEvent struct {
@@ -43,12 +46,291 @@ type NewRoundStepEvent struct {
 	Height int
 	Round  int
 	Step   string
+	// time the connector received the event, null for events stored before it was recorded
+	ReceivedAt time.Time `bun:",nullzero"`
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+type CompleteProposalEvent struct {
+	bun.BaseModel `bun:"table:complete_proposal_events"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	Height  int
+	Round   int
+	Step    string
+	BlockID string
+	// time the connector received the event, null for events stored before it was recorded
+	ReceivedAt time.Time `bun:",nullzero"`
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// a Polka, Lock, Relock, Unlock, TimeoutPropose, TimeoutWait or ValidBlock event
+type RoundStateEvent struct {
+	bun.BaseModel `bun:"table:round_state_events"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	EventType string
+	Height    int
+	Round     int
+	Step      string
+	// time the connector received the event, null for events stored before it was recorded
+	ReceivedAt time.Time `bun:",nullzero"`
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// a committed block, NumTxs and LastCommitSigners are only known for blocks stored from NewBlock events
+type Block struct {
+	bun.BaseModel `bun:"table:blocks"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	Height          int64
+	Time            time.Time
+	ProposerAddress string
+	NumTxs          *int
+	// round in which the block was committed, set once the next block, whose last commit holds it, is stored
+	CommitRound *int
+	// validators which signed the previous height, see common.CommitSigners
+	LastCommitSigners string    `bun:",nullzero"`
+	CreatedAt         time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
 
 type Validators struct {
 	bun.BaseModel `bun:"table:validators"`
 	ID            uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
 	Network       string
-	// map validator_address => last_vote_time
+	// height the set is active at, sets older than the stored one aren't stored
+	Height int64
+	// map validator_address => ValidatorInfo
 	Data map[string]interface{} `bun:"type:jsonb"`
 }
+
+// voting information of a single validator stored in Validators.Data
+type ValidatorInfo struct {
+	VotingPower      int64 `json:"voting_power"`
+	ProposerPriority int64 `json:"proposer_priority"`
+	// base64 encoded public key, empty for sets stored without public keys
+	PubKey string `json:"pub_key,omitempty"`
+}
+
+// Decodes the validator information stored in Data, entries which were stored
+// without voting information are returned with zero voting power
+func (v *Validators) Info() map[string]ValidatorInfo {
+	info := make(map[string]ValidatorInfo, len(v.Data))
+	for address, value := range v.Data {
+		var vi ValidatorInfo
+		if encoded, err := json.Marshal(value); err == nil {
+			_ = json.Unmarshal(encoded, &vi)
+		}
+		info[address] = vi
+	}
+	return info
+}
+
+// Returns the total voting power of the validator set
+func (v *Validators) TotalVotingPower() int64 {
+	var total int64
+	for _, vi := range v.Info() {
+		total += vi.VotingPower
+	}
+	return total
+}
+
+// kinds of validator set changes
+const (
+	ValidatorJoined      = "join"
+	ValidatorLeft        = "leave"
+	ValidatorPowerChange = "power"
+)
+
+// a change of the voting power of a validator, taking effect at Height. Validators joining the set have a
+// PreviousVotingPower of 0, validators leaving it a VotingPower of 0
+type ValidatorSetChange struct {
+	bun.BaseModel `bun:"table:validator_set_changes"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	Height           int64
+	ValidatorAddress string
+	// one of ValidatorJoined, ValidatorLeft or ValidatorPowerChange
+	Kind                string
+	VotingPower         int64
+	PreviousVotingPower int64
+	CreatedAt           time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// a validator with the voting power it had from ValidFromHeight to ValidToHeight inclusive, ValidToHeight being
+// nil while the validator is in the active set with that voting power
+type ValidatorSetMember struct {
+	bun.BaseModel `bun:"table:validator_set_members"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	ValidatorAddress string
+	PubKey           string `bun:",nullzero"`
+	VotingPower      int64
+	ValidFromHeight  int64
+	ValidToHeight    *int64
+}
+
+// Returns the voting information of members keyed by validator address
+func MemberInfo(members []ValidatorSetMember) map[string]ValidatorInfo {
+	info := make(map[string]ValidatorInfo, len(members))
+	for _, member := range members {
+		info[member.ValidatorAddress] = ValidatorInfo{VotingPower: member.VotingPower, PubKey: member.PubKey}
+	}
+	return info
+}
+
+// moniker, operator and valcons address of a validator, keyed by its hex consensus address
+type ValidatorIdentity struct {
+	bun.BaseModel `bun:"table:validator_identities"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	Address         string
+	ValconsAddress  string    `bun:",nullzero"`
+	OperatorAddress string    `bun:",nullzero"`
+	Moniker         string    `bun:",nullzero"`
+	Website         string    `bun:",nullzero"`
+	UpdatedAt       time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// two conflicting votes cast by the same validator for the same height, round and vote type
+type EquivocationEvidence struct {
+	bun.BaseModel `bun:"table:equivocation_evidence"`
+
+	ID      uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	Network string
+
+	ValidatorAddress string
+	Height           int
+	Round            int
+	VoteType         string
+
+	VoteAID        uuid.UUID `bun:"vote_a_id,type:uuid"`
+	VoteABlockID   string    `bun:"vote_a_block_id"`
+	VoteATimestamp time.Time `bun:"vote_a_timestamp"`
+	VoteASignature []byte    `bun:"vote_a_signature"`
+	VoteBID        uuid.UUID `bun:"vote_b_id,type:uuid"`
+	VoteBBlockID   string    `bun:"vote_b_block_id"`
+	VoteBTimestamp time.Time `bun:"vote_b_timestamp"`
+	VoteBSignature []byte    `bun:"vote_b_signature"`
+
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// the lifecycle of an alert, keyed by analyzer, network and subject
+type AlertState struct {
+	bun.BaseModel `bun:"table:alert_states"`
+
+	ID uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+
+	Analyzer string
+	Network  string
+	Subject  string
+	// firing or resolved
+	Status string
+
+	// details of the most recent occurrence
+	Severity  string
+	Validator string
+	Height    int64
+	Message   string
+
+	Occurrences  int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	LastNotified time.Time
+	ResolvedAt   time.Time `bun:",nullzero"`
+}
+
+// ids are generated by the application rather than the database, as sqlite has no uuid_generate_v4
+func generateID(id *uuid.UUID, query bun.Query) {
+	if _, ok := query.(*bun.InsertQuery); ok && *id == uuid.Nil {
+		*id = uuid.New()
+	}
+}
+
+var (
+	_ bun.BeforeAppendModelHook = (*VoteEvent)(nil)
+	_ bun.BeforeAppendModelHook = (*NewRoundEvent)(nil)
+	_ bun.BeforeAppendModelHook = (*NewRoundStepEvent)(nil)
+	_ bun.BeforeAppendModelHook = (*CompleteProposalEvent)(nil)
+	_ bun.BeforeAppendModelHook = (*RoundStateEvent)(nil)
+	_ bun.BeforeAppendModelHook = (*Block)(nil)
+	_ bun.BeforeAppendModelHook = (*Validators)(nil)
+	_ bun.BeforeAppendModelHook = (*ValidatorSetChange)(nil)
+	_ bun.BeforeAppendModelHook = (*ValidatorSetMember)(nil)
+	_ bun.BeforeAppendModelHook = (*ValidatorIdentity)(nil)
+	_ bun.BeforeAppendModelHook = (*EquivocationEvidence)(nil)
+	_ bun.BeforeAppendModelHook = (*AlertState)(nil)
+)
+
+func (v *VoteEvent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&v.ID, query)
+	return nil
+}
+
+func (r *NewRoundEvent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&r.ID, query)
+	return nil
+}
+
+func (r *NewRoundStepEvent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&r.ID, query)
+	return nil
+}
+
+func (p *CompleteProposalEvent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&p.ID, query)
+	return nil
+}
+
+func (r *RoundStateEvent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&r.ID, query)
+	return nil
+}
+
+func (b *Block) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&b.ID, query)
+	return nil
+}
+
+func (v *Validators) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&v.ID, query)
+	return nil
+}
+
+func (c *ValidatorSetChange) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&c.ID, query)
+	return nil
+}
+
+func (m *ValidatorSetMember) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&m.ID, query)
+	return nil
+}
+
+func (i *ValidatorIdentity) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&i.ID, query)
+	return nil
+}
+
+func (e *EquivocationEvidence) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&e.ID, query)
+	return nil
+}
+
+func (a *AlertState) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	generateID(&a.ID, query)
+	return nil
+}
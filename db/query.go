@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Page limits the number of rows returned by a query
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// HeightRange restricts a query to heights between From and To inclusive, a zero bound is ignored
+type HeightRange struct {
+	From int64
+	To   int64
+}
+
+// TimeRange restricts a query to times between From and To inclusive, a zero bound is ignored
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// VoteFilter selects the votes returned by QueryVotes, zero fields are ignored
+type VoteFilter struct {
+	Validator string
+	Heights   HeightRange
+	// filters on the vote timestamp
+	Times TimeRange
+	Page  Page
+}
+
+// RoundFilter selects the rounds returned by QueryNewRounds, zero fields are ignored
+type RoundFilter struct {
+	Heights HeightRange
+	// filters on the time the round was stored
+	Times TimeRange
+	Page  Page
+}
+
+// Returns votes matching the filter, ordered by height, round and validator
+func (d *Database) QueryVotes(ctx context.Context, network string, filter VoteFilter) (votes []VoteEvent, err error) {
+	query := d.DB.NewSelect().
+		Model(&votes).
+		Where("network = ?", network)
+	if filter.Validator != "" {
+		query = query.Where("validator_address = ?", filter.Validator)
+	}
+	query = filter.Heights.apply(query)
+	query = filter.Times.apply(query, "block_timestamp")
+	err = filter.Page.apply(query).
+		Order("height ASC", "round ASC", "validator_index ASC", "vote_type ASC").
+		Scan(ctx)
+	return
+}
+
+// Returns new round events matching the filter, ordered by height and round
+func (d *Database) QueryNewRounds(ctx context.Context, network string, filter RoundFilter) (rounds []NewRoundEvent, err error) {
+	query := d.DB.NewSelect().
+		Model(&rounds).
+		Where("network = ?", network)
+	query = filter.Heights.apply(query)
+	query = filter.Times.apply(query, "created_at")
+	err = filter.Page.apply(query).
+		Order("height ASC", "round ASC", "created_at ASC").
+		Scan(ctx)
+	return
+}
+
+func (p Page) apply(query *bun.SelectQuery) *bun.SelectQuery {
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit)
+	}
+	if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	return query
+}
+
+func (hr HeightRange) apply(query *bun.SelectQuery) *bun.SelectQuery {
+	if hr.From > 0 {
+		query = query.Where("height >= ?", hr.From)
+	}
+	if hr.To > 0 {
+		query = query.Where("height <= ?", hr.To)
+	}
+	return query
+}
+
+func (tr TimeRange) apply(query *bun.SelectQuery, column string) *bun.SelectQuery {
+	if !tr.From.IsZero() {
+		query = query.Where("? >= ?", bun.Ident(column), tr.From)
+	}
+	if !tr.To.IsZero() {
+		query = query.Where("? <= ?", bun.Ident(column), tr.To)
+	}
+	return query
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// urls of sqlite databases are of the form sqlite://<path>, sqlite://:memory: opens an in memory database
+const sqliteScheme = "sqlite://"
+
+// Returns true if the url refers to a sqlite database
+func IsSQLite(url string) bool {
+	return strings.HasPrefix(url, sqliteScheme)
+}
+
+// Returns true if the database is a sqlite database
+func IsSQLiteDB(db *bun.DB) bool {
+	return db.Dialect().Name() == dialect.SQLite
+}
+
+// Returns the url of the sqlite database at path
+func SQLiteURL(path string) string {
+	return sqliteScheme + path
+}
+
+// Opens the sqlite database at path, creating it if it doesn't exist
+func OpenSQLite(path string) *bun.DB {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	sqldb, err := sql.Open(sqliteshim.ShimName, dsn)
+	if err != nil {
+		// sql.Open only fails if the driver isn't registered
+		panic(err)
+	}
+	// sqlite allows a single writer, serializing queries avoids busy errors, and keeps in memory
+	// databases alive as they only exist for the lifetime of their connection
+	sqldb.SetMaxOpenConns(1)
+	sqldb.SetMaxIdleConns(1)
+	sqldb.SetConnMaxLifetime(0)
+	sqldb.SetConnMaxIdleTime(0)
+	return bun.NewDB(sqldb, sqlitedialect.New())
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rangesecurity/ctop/common"
+)
+
+// Store covers all reads and writes of the services, analyzers and api. Database implements Store against
+// both postgres and sqlite, the dialect specific parts being the connection, migrations and column types
+type Store interface {
+	StoreVote(ctx context.Context, network string, vote common.ParsedVote) error
+	StoreVotes(ctx context.Context, network string, votes []common.ParsedVote) error
+	StoreNewRound(ctx context.Context, network string, roundInfo common.ParsedNewRound) error
+	StoreNewRounds(ctx context.Context, network string, rounds []common.ParsedNewRound) error
+	StoreNewRoundStep(ctx context.Context, network string, roundInfo common.ParsedNewRoundStep) error
+	StoreNewRoundSteps(ctx context.Context, network string, steps []common.ParsedNewRoundStep) error
+	StoreCompleteProposals(ctx context.Context, network string, proposals []common.ParsedCompleteProposal) error
+	StoreRoundEvents(ctx context.Context, network string, roundEvents []common.ParsedRoundEvent) error
+	StoreBlocks(ctx context.Context, network string, blocks []common.ParsedBlock) error
+	StoreOrUpdateValidators(ctx context.Context, network string, height int64, data map[string]interface{}) error
+	ApplyValidatorUpdates(ctx context.Context, network string, height int64, updates map[string]ValidatorInfo) error
+	StoreValidatorIdentities(ctx context.Context, network string, identities []ValidatorIdentity) error
+
+	GetVotes(ctx context.Context, network string) ([]VoteEvent, error)
+	GetNewRounds(ctx context.Context, network string) ([]NewRoundEvent, error)
+	GetNewRoundSteps(ctx context.Context, network string) ([]NewRoundStepEvent, error)
+	GetCompleteProposalsForHeight(ctx context.Context, network string, height int64) ([]CompleteProposalEvent, error)
+	GetRoundEventsForHeight(ctx context.Context, network string, height int64) ([]RoundStateEvent, error)
+	GetBlocksInHeightRange(ctx context.Context, network string, fromHeight int64, toHeight int64) ([]Block, error)
+	GetValidators(ctx context.Context, network string) (Validators, error)
+	GetValidatorSetAt(ctx context.Context, network string, height int64) ([]ValidatorSetMember, error)
+	GetValidatorIdentities(ctx context.Context, network string) ([]ValidatorIdentity, error)
+	GetValidatorSetChanges(ctx context.Context, network string, fromHeight int64, toHeight int64) ([]ValidatorSetChange, error)
+	GetLatestVotesForNetwork(ctx context.Context, network string) ([]VoteEvent, error)
+	GetVotesForHeight(ctx context.Context, network string, height int64) ([]VoteEvent, error)
+	GetLatestVoteHeight(ctx context.Context, network string) (int64, error)
+	GetLatestNewRoundStep(ctx context.Context, network string) (NewRoundStepEvent, error)
+	GetLatestNewRoundForHeight(ctx context.Context, network string, height int64) (NewRoundEvent, error)
+	GetHeightStartTime(ctx context.Context, network string, height int64) (time.Time, error)
+	GetVotesInHeightRange(ctx context.Context, network string, fromHeight int64, toHeight int64) ([]VoteEvent, error)
+	QueryVotes(ctx context.Context, network string, filter VoteFilter) ([]VoteEvent, error)
+	QueryNewRounds(ctx context.Context, network string, filter RoundFilter) ([]NewRoundEvent, error)
+
+	StoreEquivocationEvidence(ctx context.Context, evidence *EquivocationEvidence) (bool, error)
+	GetEquivocationEvidence(ctx context.Context, network string) ([]EquivocationEvidence, error)
+
+	GetAlertState(ctx context.Context, analyzer string, network string, subject string) (AlertState, error)
+	GetFiringAlertStates(ctx context.Context, analyzer string, network string) ([]AlertState, error)
+	StoreAlertState(ctx context.Context, state *AlertState) error
+
+	// Creates the migration tables if needed and runs all migrations of the backend
+	CreateSchema(ctx context.Context) error
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
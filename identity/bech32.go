@@ -0,0 +1,39 @@
+package identity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Encodes data as a bech32 string with the human readable part hrp, as specified by BIP-173
+func EncodeBech32(hrp string, data []byte) (string, error) {
+	if hrp == "" {
+		return "", fmt.Errorf("empty bech32 prefix")
+	}
+	values, err := bech32.ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(strings.ToLower(hrp), values)
+}
+
+// Returns the human readable part of a bech32 string, such as cosmosvaloper for an operator address
+func Bech32Prefix(address string) string {
+	separator := strings.LastIndexByte(address, '1')
+	if separator < 1 {
+		return ""
+	}
+	return strings.ToLower(address[:separator])
+}
+
+// Returns the valcons address of a hex consensus address, deriving the prefix from the bech32 operator address of
+// the validator, such as osmovalcons for osmovaloper1...
+func ValconsAddress(operatorAddress string, consensusAddress []byte) (string, error) {
+	prefix := Bech32Prefix(operatorAddress)
+	if !strings.HasSuffix(prefix, "valoper") {
+		return "", fmt.Errorf("invalid operator address %q", operatorAddress)
+	}
+	return EncodeBech32(strings.TrimSuffix(prefix, "valoper")+"valcons", consensusAddress)
+}
@@ -0,0 +1,30 @@
+package identity_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeBech32(t *testing.T) {
+	encoded, err := identity.EncodeBech32("a", nil)
+	require.NoError(t, err)
+	require.Equal(t, "a12uel5l", encoded)
+
+	_, err = identity.EncodeBech32("", nil)
+	require.Error(t, err)
+}
+
+func TestValconsAddress(t *testing.T) {
+	address, err := hex.DecodeString("00E8E7FC77015A06D4D01E564A0BCFCD8627524D")
+	require.NoError(t, err)
+	valcons, err := identity.ValconsAddress("osmovaloper1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqwx5tc0", address)
+	require.NoError(t, err)
+	require.Equal(t, "osmovalcons1qr5w0lrhq9dqd4xsrety5z70ekrzw5jdlusfzs", valcons)
+
+	_, err = identity.ValconsAddress("osmo1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq", address)
+	require.Error(t, err)
+	require.Equal(t, "osmovaloper", identity.Bech32Prefix("osmovaloper1qqqq"))
+}
@@ -0,0 +1,3 @@
+// Package identity resolves the hex consensus addresses ctop is keyed by to the monikers, operator addresses and
+// bech32 valcons addresses of validators, as registered with the Cosmos SDK staking module
+package identity
@@ -0,0 +1,172 @@
+package identity
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rs/zerolog/log"
+)
+
+// Store provides the identities stored by the validator indexer
+type Store interface {
+	GetValidatorIdentities(ctx context.Context, network string) ([]db.ValidatorIdentity, error)
+}
+
+// Resolver resolves consensus addresses to the identities stored by the validator indexer, caching the identities
+// of a network for ttl
+type Resolver struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu sync.Mutex
+	// network -> identities loaded last
+	cache map[string]cachedIdentities
+}
+
+type cachedIdentities struct {
+	// consensus address -> identity
+	identities map[string]Identity
+	loaded     time.Time
+	// set while the identities are reloaded, during which the identities loaded last are returned
+	loading bool
+}
+
+func NewResolver(store Store, ttl time.Duration) *Resolver {
+	return &Resolver{
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+		cache: make(map[string]cachedIdentities),
+	}
+}
+
+// Returns the identities of a network keyed by consensus address. Identities are only used for display, so if they
+// can't be loaded the error is logged at debug level and the identities loaded last are returned until the ttl
+// expires again. The store is queried without holding the lock, callers asking for the identities while they are
+// reloaded get the identities loaded last
+func (r *Resolver) Identities(ctx context.Context, network string) map[string]Identity {
+	r.mu.Lock()
+	cached, ok := r.cache[network]
+	if ok && (r.now().Sub(cached.loaded) < r.ttl || cached.loading && cached.identities != nil) {
+		r.mu.Unlock()
+		return cached.identities
+	}
+	cached.loading = true
+	r.cache[network] = cached
+	r.mu.Unlock()
+
+	models, err := r.store.GetValidatorIdentities(ctx, network)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached = r.cache[network]
+	cached.loading = false
+	cached.loaded = r.now()
+	if err != nil {
+		log.Debug().Err(err).Str("network", network).Msg("failed to load validator identities")
+	} else {
+		cached.identities = make(map[string]Identity, len(models))
+		for _, model := range models {
+			cached.identities[model.Address] = FromModel(model)
+		}
+	}
+	r.cache[network] = cached
+	return cached.identities
+}
+
+// Returns the identity of a validator
+func (r *Resolver) Resolve(ctx context.Context, network string, address string) (Identity, bool) {
+	identity, ok := r.Identities(ctx, network)[NormalizeAddress(address)]
+	return identity, ok
+}
+
+// Returns the moniker of a validator, or an empty string if it is unknown
+func (r *Resolver) Moniker(ctx context.Context, network string, address string) string {
+	identity, _ := r.Resolve(ctx, network, address)
+	return identity.Moniker
+}
+
+// Returns the monikers of the validators of a network keyed by consensus address
+func (r *Resolver) Monikers(ctx context.Context, network string) map[string]string {
+	identities := r.Identities(ctx, network)
+	monikers := make(map[string]string, len(identities))
+	for address, identity := range identities {
+		if identity.Moniker != "" {
+			monikers[address] = identity.Moniker
+		}
+	}
+	return monikers
+}
+
+// Merges overrides into identities, the fields an override sets taking precedence. Overrides of validators without
+// an identity are added, and valcons addresses derived for identities with an operator address
+func Merge(identities []Identity, overrides []Identity) []Identity {
+	merged := make([]Identity, 0, len(identities)+len(overrides))
+	index := make(map[string]int, len(identities)+len(overrides))
+	for _, identity := range identities {
+		identity.Address = NormalizeAddress(identity.Address)
+		index[identity.Address] = len(merged)
+		merged = append(merged, identity)
+	}
+	for _, override := range overrides {
+		override.Address = NormalizeAddress(override.Address)
+		i, ok := index[override.Address]
+		if !ok {
+			index[override.Address] = len(merged)
+			merged = append(merged, override)
+			continue
+		}
+		for _, field := range []struct {
+			value    *string
+			override string
+		}{
+			{&merged[i].ValconsAddress, override.ValconsAddress},
+			{&merged[i].OperatorAddress, override.OperatorAddress},
+			{&merged[i].Moniker, override.Moniker},
+			{&merged[i].Website, override.Website},
+		} {
+			if field.override != "" {
+				*field.value = field.override
+			}
+		}
+	}
+	for i := range merged {
+		if merged[i].ValconsAddress != "" || merged[i].OperatorAddress == "" {
+			continue
+		}
+		if address, err := hex.DecodeString(merged[i].Address); err == nil {
+			merged[i].ValconsAddress, _ = ValconsAddress(merged[i].OperatorAddress, address)
+		}
+	}
+	return merged
+}
+
+// Returns a consensus address in the upper case hex form used by cometbft
+func NormalizeAddress(address string) string {
+	return strings.ToUpper(address)
+}
+
+func FromModel(model db.ValidatorIdentity) Identity {
+	return Identity{
+		Address:         model.Address,
+		ValconsAddress:  model.ValconsAddress,
+		OperatorAddress: model.OperatorAddress,
+		Moniker:         model.Moniker,
+		Website:         model.Website,
+	}
+}
+
+func (i Identity) Model() db.ValidatorIdentity {
+	return db.ValidatorIdentity{
+		Address:         i.Address,
+		ValconsAddress:  i.ValconsAddress,
+		OperatorAddress: i.OperatorAddress,
+		Moniker:         i.Moniker,
+		Website:         i.Website,
+	}
+}
@@ -0,0 +1,127 @@
+package identity_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct {
+	identity.Store
+	err error
+}
+
+func (s *failingStore) GetValidatorIdentities(ctx context.Context, network string) ([]db.ValidatorIdentity, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.GetValidatorIdentities(ctx, network)
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+	require.NoError(t, database.StoreValidatorIdentities(ctx, "osmosis", []db.ValidatorIdentity{
+		{Address: "AA", Moniker: "alice"},
+		{Address: "BB", OperatorAddress: "osmovaloper1qqqq"},
+	}))
+
+	store := &failingStore{Store: database}
+	resolver := identity.NewResolver(store, time.Hour)
+	require.Equal(t, "alice", resolver.Moniker(ctx, "osmosis", "aa"))
+	require.Equal(t, "", resolver.Moniker(ctx, "osmosis", "BB"))
+	require.Equal(t, "", resolver.Moniker(ctx, "cosmoshub", "AA"))
+	require.Equal(t, map[string]string{"AA": "alice"}, resolver.Monikers(ctx, "osmosis"))
+	bob, ok := resolver.Resolve(ctx, "osmosis", "BB")
+	require.True(t, ok)
+	require.Equal(t, "osmovaloper1qqqq", bob.OperatorAddress)
+
+	// cached until the ttl expires
+	reloading := identity.NewResolver(store, 0)
+	require.Equal(t, "alice", reloading.Moniker(ctx, "osmosis", "AA"))
+	require.NoError(t, database.StoreValidatorIdentities(ctx, "osmosis", nil))
+	require.Equal(t, "alice", resolver.Moniker(ctx, "osmosis", "AA"))
+
+	// identities loaded last are kept if reloading fails
+	store.err = errors.New("unavailable")
+	require.Equal(t, "alice", reloading.Moniker(ctx, "osmosis", "AA"))
+	store.err = nil
+	require.Equal(t, "", reloading.Moniker(ctx, "osmosis", "AA"))
+}
+
+// blocks loading the identities of a network until release is closed
+type blockingStore struct {
+	identity.Store
+	network string
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) GetValidatorIdentities(ctx context.Context, network string) ([]db.ValidatorIdentity, error) {
+	if network == s.network {
+		close(s.loading)
+		<-s.release
+	}
+	return s.Store.GetValidatorIdentities(ctx, network)
+}
+
+func TestResolverSlowStore(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+	require.NoError(t, database.StoreValidatorIdentities(ctx, "osmosis", []db.ValidatorIdentity{{Address: "AA", Moniker: "alice"}}))
+	require.NoError(t, database.StoreValidatorIdentities(ctx, "cosmoshub", []db.ValidatorIdentity{{Address: "BB", Moniker: "bob"}}))
+
+	store := &blockingStore{Store: database, network: "cosmoshub", loading: make(chan struct{}), release: make(chan struct{})}
+	resolver := identity.NewResolver(store, time.Hour)
+	done := make(chan string)
+	go func() { done <- resolver.Moniker(ctx, "cosmoshub", "BB") }()
+	<-store.loading
+
+	// a slow query of one network doesn't block resolving the identities of another
+	resolved := make(chan string)
+	go func() { resolved <- resolver.Moniker(ctx, "osmosis", "AA") }()
+	select {
+	case moniker := <-resolved:
+		require.Equal(t, "alice", moniker)
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolving was blocked by a slow query")
+	}
+	close(store.release)
+	require.Equal(t, "bob", <-done)
+}
+
+func TestMerge(t *testing.T) {
+	merged := identity.Merge([]identity.Identity{
+		{Address: "00E8E7FC77015A06D4D01E564A0BCFCD8627524D", Moniker: "on chain", Website: "https://example.com"},
+		{Address: "BB", Moniker: "bob"},
+	}, []identity.Identity{
+		{
+			Address:         "00e8e7fc77015a06d4d01e564a0bcfcd8627524d",
+			Moniker:         "override",
+			OperatorAddress: "osmovaloper1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqwx5tc0",
+		},
+		{Address: "cc", Moniker: "carol"},
+	})
+	require.Equal(t, []identity.Identity{
+		{
+			Address:         "00E8E7FC77015A06D4D01E564A0BCFCD8627524D",
+			ValconsAddress:  "osmovalcons1qr5w0lrhq9dqd4xsrety5z70ekrzw5jdlusfzs",
+			OperatorAddress: "osmovaloper1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqwx5tc0",
+			Moniker:         "override",
+			Website:         "https://example.com",
+		},
+		{Address: "BB", Moniker: "bob"},
+		{Address: "CC", Moniker: "carol"},
+	}, merged)
+}
@@ -0,0 +1,203 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/secp256k1"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// abci query path of the validators query of the staking module
+	ValidatorsQueryPath = "/cosmos.staking.v1beta1.Query/Validators"
+	// number of validators requested per page
+	validatorsPageLimit = 200
+	// maximum number of pages requested, bounding queries to misbehaving nodes
+	maxValidatorsPages = 50
+
+	ed25519PubKeyType   = "/cosmos.crypto.ed25519.PubKey"
+	secp256k1PubKeyType = "/cosmos.crypto.secp256k1.PubKey"
+)
+
+// Querier performs abci queries against a node, returning the value of the response
+type Querier interface {
+	ABCIQuery(ctx context.Context, path string, data []byte) ([]byte, error)
+}
+
+// Identity of a validator, keyed by its hex consensus address
+type Identity struct {
+	Address         string `json:"address"`
+	ValconsAddress  string `json:"valcons_address,omitempty"`
+	OperatorAddress string `json:"operator_address,omitempty"`
+	Moniker         string `json:"moniker,omitempty"`
+	Website         string `json:"website,omitempty"`
+}
+
+// Fetches the identities of all validators registered with the staking module, including validators which aren't
+// bonded. Validators with consensus keys of unsupported types are skipped
+func FetchValidators(ctx context.Context, querier Querier) ([]Identity, error) {
+	var (
+		identities []Identity
+		key        []byte
+	)
+	for page := 0; page < maxValidatorsPages; page++ {
+		res, err := querier.ABCIQuery(ctx, ValidatorsQueryPath, encodeValidatorsRequest(key, validatorsPageLimit))
+		if err != nil {
+			return nil, err
+		}
+		validators, nextKey, err := decodeValidatorsResponse(res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode validators %+v", err)
+		}
+		for _, validator := range validators {
+			if identity, ok := validator.identity(); ok {
+				identities = append(identities, identity)
+			}
+		}
+		if len(nextKey) == 0 {
+			return identities, nil
+		}
+		key = nextKey
+	}
+	return nil, fmt.Errorf("validators exceed %d pages", maxValidatorsPages)
+}
+
+// Encodes a QueryValidatorsRequest for all validators, starting at the pagination key
+func encodeValidatorsRequest(key []byte, limit uint64) []byte {
+	var pagination []byte
+	if len(key) > 0 {
+		pagination = protowire.AppendTag(pagination, 1, protowire.BytesType)
+		pagination = protowire.AppendBytes(pagination, key)
+	}
+	pagination = protowire.AppendTag(pagination, 3, protowire.VarintType)
+	pagination = protowire.AppendVarint(pagination, limit)
+
+	request := protowire.AppendTag(nil, 2, protowire.BytesType)
+	return protowire.AppendBytes(request, pagination)
+}
+
+// the fields of a staking module validator used to build its identity
+type stakingValidator struct {
+	operatorAddress string
+	pubKeyType      string
+	pubKey          []byte
+	moniker         string
+	website         string
+}
+
+func (v stakingValidator) identity() (Identity, bool) {
+	var address []byte
+	switch v.pubKeyType {
+	case ed25519PubKeyType:
+		if len(v.pubKey) != ed25519.PubKeySize {
+			return Identity{}, false
+		}
+		address = ed25519.PubKey(v.pubKey).Address()
+	case secp256k1PubKeyType:
+		if len(v.pubKey) != secp256k1.PubKeySize {
+			return Identity{}, false
+		}
+		address = secp256k1.PubKey(v.pubKey).Address()
+	default:
+		return Identity{}, false
+	}
+	// the identity remains useful without a valcons address
+	valcons, _ := ValconsAddress(v.operatorAddress, address)
+	return Identity{
+		Address:         fmt.Sprintf("%X", address),
+		ValconsAddress:  valcons,
+		OperatorAddress: v.operatorAddress,
+		Moniker:         v.moniker,
+		Website:         v.website,
+	}, true
+}
+
+// decodes a QueryValidatorsResponse, returning the validators and the key of the next page
+func decodeValidatorsResponse(data []byte) (validators []stakingValidator, nextKey []byte, err error) {
+	err = decodeMessage(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			validator, err := decodeValidator(value)
+			if err != nil {
+				return err
+			}
+			validators = append(validators, validator)
+		case 2:
+			return decodeMessage(value, func(num protowire.Number, value []byte) error {
+				if num == 1 {
+					nextKey = value
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+func decodeValidator(data []byte) (validator stakingValidator, err error) {
+	err = decodeMessage(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			validator.operatorAddress = string(value)
+		case 2:
+			// google.protobuf.Any wrapping the public key
+			return decodeMessage(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					validator.pubKeyType = string(value)
+				case 2:
+					return decodeMessage(value, func(num protowire.Number, value []byte) error {
+						if num == 1 {
+							validator.pubKey = value
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		case 7:
+			return decodeMessage(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					validator.moniker = string(value)
+				case 3:
+					validator.website = string(value)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// calls field for every length delimited field of a message, skipping fields of other wire types
+func decodeMessage(data []byte, field func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := field(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
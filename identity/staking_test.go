@@ -0,0 +1,66 @@
+package identity_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/secp256k1"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/rangesecurity/ctop/testutil"
+	"github.com/rangesecurity/ctop/wsclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchValidators(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node, err := testutil.NewNode(ctx, "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	defer node.Close()
+
+	// spans multiple pages of 200 validators
+	var validators []testutil.StakingValidator
+	for i := 0; i < 250; i++ {
+		validators = append(validators, testutil.StakingValidator{
+			OperatorAddress: "osmovaloper1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqwx5tc0",
+			PubKey:          ed25519.GenPrivKey().PubKey(),
+			Moniker:         fmt.Sprintf("validator-%d", i),
+			Website:         "https://example.com",
+		})
+	}
+	secp := secp256k1.GenPrivKey().PubKey()
+	validators = append(validators,
+		testutil.StakingValidator{OperatorAddress: "osmovaloper1qqqq", PubKey: secp, Moniker: "secp"},
+		// skipped without a consensus key
+		testutil.StakingValidator{OperatorAddress: "osmovaloper1qqqq", Moniker: "keyless"},
+	)
+	node.SetStakingValidators(validators)
+
+	client, err := wsclient.NewClient(node.URL())
+	require.NoError(t, err)
+	defer client.Close()
+	identities, err := identity.FetchValidators(ctx, client)
+	require.NoError(t, err)
+	require.Len(t, identities, 251)
+	for i, validator := range validators[:250] {
+		require.Equal(t, validator.PubKey.Address().String(), identities[i].Address)
+		require.Equal(t, validator.Moniker, identities[i].Moniker)
+		require.Equal(t, validator.Website, identities[i].Website)
+		require.Equal(t, validator.OperatorAddress, identities[i].OperatorAddress)
+		expected, err := identity.ValconsAddress(validator.OperatorAddress, validator.PubKey.Address())
+		require.NoError(t, err)
+		require.Equal(t, expected, identities[i].ValconsAddress)
+	}
+	require.Equal(t, identity.Identity{
+		Address:         secp.Address().String(),
+		ValconsAddress:  identities[250].ValconsAddress,
+		OperatorAddress: "osmovaloper1qqqq",
+		Moniker:         "secp",
+	}, identities[250])
+
+	_, err = client.ABCIQuery(ctx, "/cosmos.bank.v1beta1.Query/Balance", nil)
+	require.ErrorContains(t, err, "unknown query path")
+}
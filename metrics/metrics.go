@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	cstypes "github.com/cometbft/cometbft/consensus/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "ctop"
+
+// Registry contains all ctop metrics, along with go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+// consensus metrics
+var (
+	ConsensusHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consensus",
+		Name:      "height",
+		Help:      "Height of the latest consensus step",
+	}, []string{"network"})
+	ConsensusRound = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consensus",
+		Name:      "round",
+		Help:      "Round of the latest consensus step",
+	}, []string{"network"})
+	ConsensusStep = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consensus",
+		Name:      "step",
+		Help:      "Latest consensus step, numbered from 1 (NewHeight) to 8 (Commit)",
+	}, []string{"network"})
+	ValidatorLastVotedHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "last_voted_height",
+		Help:      "Height of the latest vote received from a validator",
+	}, []string{"network", "validator"})
+	ValidatorMissedVotes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "missed_votes_total",
+		Help:      "Number of heights at which a validator was found not to have voted",
+	}, []string{"network", "validator"})
+	ValidatorVotingPower = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "voting_power",
+		Help:      "Voting power of a validator in the active set",
+	}, []string{"network", "validator"})
+)
+
+// pipeline metrics
+var (
+	EventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "events_received_total",
+		Help:      "Number of events received from rpc endpoints, after de-duplication",
+	}, []string{"network", "stream"})
+	EventsPersisted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "events_persisted_total",
+		Help:      "Number of events written to the database",
+	}, []string{"network", "stream"})
+	EventsPerSecond = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "events_per_second",
+		Help:      "Number of events written to the database per second, averaged over the reporting interval",
+	}, []string{"network", "stream"})
+	StreamLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "redis_stream_length",
+		Help:      "Number of entries in a redis stream",
+	}, []string{"network", "stream"})
+	StreamLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "redis_consumer_lag",
+		Help:      "Number of entries in a redis stream which have not been delivered to the consumer group",
+	}, []string{"network", "stream"})
+	StreamPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "redis_consumer_pending",
+		Help:      "Number of entries delivered to the consumer group which have not been acknowledged",
+	}, []string{"network", "stream"})
+	DBInsertDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "db_insert_duration_seconds",
+		Help:      "Duration of batch inserts into the database",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"network", "stream"})
+	SubscriptionFill = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "subscription_channel_fill_ratio",
+		Help:      "Fraction of the capacity of a subscription channel which is in use",
+	}, []string{"network", "url", "stream"})
+	ConnectionState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "connection_state",
+		Help:      "Websocket connection state of an rpc endpoint, 0 connecting, 1 connected, 2 reconnecting, 3 closed",
+	}, []string{"network", "url"})
+)
+
+// tracks when each network entered its current step, exposing the time spent in it
+var steps = &stepCollector{
+	desc: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "time_in_step_seconds"),
+		"Time elapsed since the latest consensus step was entered",
+		[]string{"network"},
+		nil,
+	),
+	started: make(map[string]time.Time),
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ConsensusHeight,
+		ConsensusRound,
+		ConsensusStep,
+		ValidatorLastVotedHeight,
+		ValidatorMissedVotes,
+		ValidatorVotingPower,
+		EventsReceived,
+		EventsPersisted,
+		EventsPerSecond,
+		StreamLength,
+		StreamLag,
+		StreamPending,
+		DBInsertDuration,
+		SubscriptionFill,
+		ConnectionState,
+		steps,
+	)
+}
+
+// Records the consensus step a network entered
+func ObserveStep(network string, height int64, round int32, step string, now time.Time) {
+	ConsensusHeight.WithLabelValues(network).Set(float64(height))
+	ConsensusRound.WithLabelValues(network).Set(float64(round))
+	ConsensusStep.WithLabelValues(network).Set(float64(stepNumber(step)))
+	steps.enter(network, now)
+}
+
+// Replaces the voting power of all validators of a network, validators which left the active set are removed
+func SetVotingPower(network string, power map[string]int64) {
+	ValidatorVotingPower.DeletePartialMatch(prometheus.Labels{"network": network})
+	for validator, votingPower := range power {
+		ValidatorVotingPower.WithLabelValues(network, validator).Set(float64(votingPower))
+	}
+}
+
+// returns the numeric value of a step such as RoundStepPropose, or 0 if it is unknown
+func stepNumber(step string) int {
+	for rs := cstypes.RoundStepNewHeight; rs <= cstypes.RoundStepCommit; rs++ {
+		if rs.String() == step {
+			return int(rs)
+		}
+	}
+	return 0
+}
+
+type stepCollector struct {
+	desc    *prometheus.Desc
+	mu      sync.Mutex
+	started map[string]time.Time
+}
+
+func (sc *stepCollector) enter(network string, now time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.started[network] = now
+}
+
+func (sc *stepCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.desc
+}
+
+func (sc *stepCollector) Collect(ch chan<- prometheus.Metric) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for network, started := range sc.started {
+		ch <- prometheus.MustNewConstMetric(sc.desc, prometheus.GaugeValue, time.Since(started).Seconds(), network)
+	}
+}
+
+// Serves metrics at /metrics on addr until ctx is cancelled. Nothing is served if addr is empty
+func Serve(ctx context.Context, addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		log.Info().Str("addr", addr).Msg("serving metrics")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Str("addr", addr).Msg("failed to serve metrics")
+		}
+	}()
+}
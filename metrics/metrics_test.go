@@ -0,0 +1,36 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rangesecurity/ctop/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveStep(t *testing.T) {
+	metrics.ObserveStep("osmosis", 100, 1, "RoundStepPropose", time.Now().Add(-time.Minute))
+	require.Equal(t, float64(100), testutil.ToFloat64(metrics.ConsensusHeight.WithLabelValues("osmosis")))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.ConsensusRound.WithLabelValues("osmosis")))
+	require.Equal(t, float64(3), testutil.ToFloat64(metrics.ConsensusStep.WithLabelValues("osmosis")))
+
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	var timeInStep float64
+	for _, family := range families {
+		if family.GetName() == "ctop_consensus_time_in_step_seconds" {
+			timeInStep = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	require.GreaterOrEqual(t, timeInStep, float64(60))
+}
+
+func TestSetVotingPower(t *testing.T) {
+	metrics.SetVotingPower("osmosis", map[string]int64{"A": 10, "B": 20})
+	require.Equal(t, 2, testutil.CollectAndCount(metrics.ValidatorVotingPower))
+	// validators which left the active set are removed
+	metrics.SetVotingPower("osmosis", map[string]int64{"A": 10})
+	require.Equal(t, 1, testutil.CollectAndCount(metrics.ValidatorVotingPower))
+	require.Equal(t, float64(10), testutil.ToFloat64(metrics.ValidatorVotingPower.WithLabelValues("osmosis", "A")))
+}
@@ -0,0 +1,2 @@
+// Package recording reads and writes recordings of the raw events received from networks, stored as gzip compressed jsonl
+package recording
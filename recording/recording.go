@@ -0,0 +1,160 @@
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	cmtjson "github.com/cometbft/cometbft/libs/json"
+	"github.com/cometbft/cometbft/types"
+)
+
+// maximum size of a single line of a recording
+const maxLineSize = 4 * 1024 * 1024
+
+// Event is an event received from a network, recordings hold one event per line
+type Event struct {
+	// time at which the event was received
+	Time    time.Time `json:"time"`
+	Network string    `json:"network"`
+	// url of the endpoint the event was received from
+	URL string `json:"url"`
+	// event type as published by cometbft, such as types.EventPolka, which tells apart the events sharing
+	// types.EventDataRoundState. Recordings made before it was recorded only hold NewRoundStep round states
+	Type string `json:"type,omitempty"`
+	// one of the cometbft event data types, encoded with the type tags used by the cometbft rpc
+	Data types.TMEventData `json:"data"`
+}
+
+// Writer writes events to a gzip compressed jsonl file, it is safe for concurrent use
+type Writer struct {
+	mu     sync.Mutex
+	file   io.Closer
+	gz     *gzip.Writer
+	events int64
+}
+
+// Creates the recording at path, truncating it if it exists
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewWriter(file)
+	w.file = file
+	return w, nil
+}
+
+// Returns a writer writing a recording to w, closing the writer doesn't close w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{gz: gzip.NewWriter(w)}
+}
+
+func (w *Writer) Write(event Event) error {
+	line, err := cmtjson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	w.events++
+	return nil
+}
+
+// Returns the number of events written
+func (w *Writer) Events() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.events
+}
+
+// Flushes buffered events, events are only readable once they have been flushed
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.gz.Flush()
+}
+
+// Completes the recording, closing the underlying file if it was created by Create
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.gz.Close()
+	if w.file != nil {
+		err = errors.Join(err, w.file.Close())
+	}
+	return err
+}
+
+// Reader reads the events of a recording in order
+type Reader struct {
+	file    io.Closer
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Opens the recording at path
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file = file
+	return r, nil
+}
+
+// Returns a reader reading a recording from r, closing the reader doesn't close r
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &Reader{gz: gz, scanner: scanner}, nil
+}
+
+// Returns the next event, io.EOF is returned once all events have been read
+func (r *Reader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := cmtjson.Unmarshal(r.scanner.Bytes(), &event); err != nil {
+			return Event{}, fmt.Errorf("invalid event on line %d %+v", r.line, err)
+		}
+		return event, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		// recordings which were not closed properly end with a truncated gzip stream
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Event{}, io.EOF
+		}
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+func (r *Reader) Close() error {
+	err := r.gz.Close()
+	if r.file != nil {
+		err = errors.Join(err, r.file.Close())
+	}
+	return err
+}
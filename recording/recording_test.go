@@ -0,0 +1,66 @@
+package recording_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rangesecurity/ctop/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecording(t *testing.T) {
+	set, privVals := testutil.NewValidatorSet(4, 10)
+	vote, err := testutil.SignedVote(privVals, 1, 100, 0, cmtproto.PrevoteType, testutil.BlockID(100), time.Now().UTC().Round(0))
+	require.NoError(t, err)
+	received := time.Now().UTC().Round(0)
+	events := []recording.Event{
+		{Time: received, Network: "osmosis", URL: "tcp://a:26657", Data: types.EventDataRoundState{Height: 100, Step: "RoundStepPrevote"}},
+		{Time: received.Add(time.Millisecond), Network: "osmosis", URL: "tcp://a:26657", Data: types.EventDataVote{Vote: vote}},
+		{Time: received.Add(time.Second), Network: "cosmoshub", URL: "tcp://b:26657", Data: types.EventDataNewRound{
+			Height:   100,
+			Round:    1,
+			Step:     "RoundStepNewRound",
+			Proposer: types.ValidatorInfo{Address: set.Validators[0].Address, Index: 0},
+		}},
+	}
+
+	var buf bytes.Buffer
+	writer := recording.NewWriter(&buf)
+	for _, event := range events {
+		require.NoError(t, writer.Write(event))
+	}
+	require.Equal(t, int64(3), writer.Events())
+	require.NoError(t, writer.Close())
+
+	reader, err := recording.NewReader(&buf)
+	require.NoError(t, err)
+	defer reader.Close()
+	for _, expected := range events {
+		event, err := reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected, event)
+	}
+	_, err = reader.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestRecordingTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	writer := recording.NewWriter(&buf)
+	require.NoError(t, writer.Write(recording.Event{Network: "osmosis", Data: types.EventDataRoundState{Height: 1}}))
+	// the events written before a crash are readable once flushed
+	require.NoError(t, writer.Flush())
+
+	reader, err := recording.NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	event, err := reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, types.EventDataRoundState{Height: 1}, event.Data)
+	_, err = reader.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
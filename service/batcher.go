@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// duration the batches pending once Batch is stopped have to be flushed
+const shutdownFlushTimeout = 5 * time.Second
+
+// Batch reads items from in, calling flush with batches of at most size items. A batch is flushed once it is
+// full, or once interval has elapsed since its first item was received. Returns once ctx is cancelled, after
+// flushing the incomplete batch and the items already buffered by in with a context which is only valid for
+// a short while
+func Batch[T any](
+	ctx context.Context,
+	in <-chan T,
+	size int,
+	interval time.Duration,
+	flush func(context.Context, []T),
+) {
+	if size < 1 {
+		size = 1
+	}
+	var (
+		batch = make([]T, 0, size)
+		timer = time.NewTimer(interval)
+	)
+	// a timer which fired without being received must be drained, otherwise the next batch would be flushed
+	// as soon as the timer is reset
+	stopTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	stopTimer()
+	defer timer.Stop()
+	send := func() {
+		stopTimer()
+		flush(ctx, batch)
+		batch = make([]T, 0, size)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownFlushTimeout)
+			defer cancel()
+		drain:
+			for {
+				select {
+				case item := <-in:
+					if batch = append(batch, item); len(batch) >= size {
+						flush(flushCtx, batch)
+						batch = make([]T, 0, size)
+					}
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				flush(flushCtx, batch)
+			}
+			return
+		case item := <-in:
+			if len(batch) == 0 {
+				timer.Reset(interval)
+			}
+			batch = append(batch, item)
+			if len(batch) >= size {
+				send()
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				send()
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan int)
+	batches := make(chan []int, 10)
+	go service.Batch(ctx, in, 3, 100*time.Millisecond, func(ctx context.Context, batch []int) {
+		batches <- batch
+	})
+
+	// full batches are flushed immediately
+	for i := 0; i < 4; i++ {
+		in <- i
+	}
+	select {
+	case batch := <-batches:
+		require.Equal(t, []int{0, 1, 2}, batch)
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("full batch was not flushed")
+	}
+
+	// incomplete batches are flushed once the interval elapses
+	select {
+	case batch := <-batches:
+		require.Equal(t, []int{3}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("incomplete batch was not flushed")
+	}
+}
+
+func TestBatchFlushOnStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int, 10)
+	batches := make(chan []int, 10)
+	errs := make(chan error, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.Batch(ctx, in, 3, time.Hour, func(ctx context.Context, batch []int) {
+			errs <- ctx.Err()
+			batches <- batch
+		})
+	}()
+	in <- 0
+	// give the batcher time to receive the first item before buffering the remaining ones
+	time.Sleep(50 * time.Millisecond)
+	for i := 1; i < 5; i++ {
+		in <- i
+	}
+	// the first full batch is flushed while the batcher runs
+	require.Equal(t, []int{0, 1, 2}, <-batches)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("batcher was not stopped")
+	}
+	close(errs)
+	close(batches)
+	// the context of batches flushed on stop remains valid
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	var flushed []int
+	for batch := range batches {
+		flushed = append(flushed, batch...)
+	}
+	require.Equal(t, []int{3, 4}, flushed)
+}
@@ -2,91 +2,198 @@ package service
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
 	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/metrics"
 	"github.com/rangesecurity/ctop/wsclient"
+	"github.com/rs/zerolog/log"
 )
 
+// cometbft limits the number of subscriptions of a websocket client, rpc.max_subscriptions_per_client
+// defaults to 5, so the subscriptions of a connector are spread over several clients
+const maxSubscriptionsPerClient = 5
+
+// ConnectorOptions configures the events a connector subscribes to
+type ConnectorOptions struct {
+	// subscribe to NewBlock instead of NewBlockHeader events, adding the tx count and last commit signers to
+	// stored blocks. NewBlock events carry every tx of the block along with their results, so they are much
+	// larger than headers
+	FullBlocks bool
+	// network -> chain id, endpoints of a network serving another chain are rejected
+	ChainIDs map[string]string
+}
+
+// an event subscription, and how its events are forwarded to the channels of the connector
+type connectorSubscription struct {
+	subscribe func(*wsclient.WsClient, context.Context) (<-chan coretypes.ResultEvent, error)
+	forward   func(c *Connector, data types.TMEventData, receivedAt time.Time)
+}
+
+// the events every connector subscribes to
+var connectorSubscriptions = []connectorSubscription{
+	{(*wsclient.WsClient).SubscribeVotes, func(c *Connector, data types.TMEventData, _ time.Time) {
+		if voteInfo, ok := data.(types.EventDataVote); ok {
+			c.voteCh <- voteInfo
+		}
+	}},
+	{(*wsclient.WsClient).SubscribeNewRound, func(c *Connector, data types.TMEventData, _ time.Time) {
+		if roundInfo, ok := data.(types.EventDataNewRound); ok {
+			c.newRoundCh <- roundInfo
+		}
+	}},
+	{(*wsclient.WsClient).SubscribeNewRoundStep, func(c *Connector, data types.TMEventData, receivedAt time.Time) {
+		if roundInfo, ok := data.(types.EventDataRoundState); ok {
+			c.newRoundStepCh <- ReceivedEvent[types.EventDataRoundState]{roundInfo, receivedAt}
+		}
+	}},
+	{(*wsclient.WsClient).SubscribeCompleteProposal, func(c *Connector, data types.TMEventData, receivedAt time.Time) {
+		if proposalInfo, ok := data.(types.EventDataCompleteProposal); ok {
+			c.completeProposalCh <- ReceivedEvent[types.EventDataCompleteProposal]{proposalInfo, receivedAt}
+		}
+	}},
+	{(*wsclient.WsClient).SubscribePolka, forwardRoundEvent(types.EventPolka)},
+	{(*wsclient.WsClient).SubscribeLock, forwardRoundEvent(types.EventLock)},
+	{(*wsclient.WsClient).SubscribeRelock, forwardRoundEvent(types.EventRelock)},
+	{(*wsclient.WsClient).SubscribeUnlock, forwardRoundEvent(types.EventUnlock)},
+	{(*wsclient.WsClient).SubscribeTimeoutPropose, forwardRoundEvent(types.EventTimeoutPropose)},
+	{(*wsclient.WsClient).SubscribeTimeoutWait, forwardRoundEvent(types.EventTimeoutWait)},
+	{(*wsclient.WsClient).SubscribeValidBlock, forwardRoundEvent(types.EventValidBlock)},
+}
+
+var (
+	newBlockHeaderSubscription = connectorSubscription{(*wsclient.WsClient).SubscribeNewBlockHeader, func(c *Connector, data types.TMEventData, _ time.Time) {
+		if headerInfo, ok := data.(types.EventDataNewBlockHeader); ok {
+			c.newBlockHeaderCh <- headerInfo
+		}
+	}}
+	newBlockSubscription = connectorSubscription{(*wsclient.WsClient).SubscribeNewBlock, func(c *Connector, data types.TMEventData, _ time.Time) {
+		if blockInfo, ok := data.(types.EventDataNewBlock); ok {
+			c.newBlockCh <- blockInfo
+		}
+	}}
+)
+
+func forwardRoundEvent(eventType string) func(*Connector, types.TMEventData, time.Time) {
+	return func(c *Connector, data types.TMEventData, receivedAt time.Time) {
+		if roundInfo, ok := data.(types.EventDataRoundState); ok {
+			c.roundEventChs[eventType] <- ReceivedEvent[types.EventDataRoundState]{roundInfo, receivedAt}
+		}
+	}
+}
+
+// ReceivedEvent is an event along with the time the connector received it
+type ReceivedEvent[T any] struct {
+	Data       T
+	ReceivedAt time.Time
+}
+
 // connects to a single chain
 type Connector struct {
-	voteCh         chan types.EventDataVote
-	newRoundCh     chan types.EventDataNewRound
-	newRoundStepCh chan types.EventDataRoundState
-	wsClient       *wsclient.WsClient
-	network        string
-	cancel         context.CancelFunc
-	ctx            context.Context
+	voteCh             chan types.EventDataVote
+	newRoundCh         chan types.EventDataNewRound
+	newRoundStepCh     chan ReceivedEvent[types.EventDataRoundState]
+	completeProposalCh chan ReceivedEvent[types.EventDataCompleteProposal]
+	// event type -> channel of the common.RoundEventTypes
+	roundEventChs map[string]chan ReceivedEvent[types.EventDataRoundState]
+	// only one of the block channels receives events, depending on ConnectorOptions.FullBlocks
+	newBlockHeaderCh chan types.EventDataNewBlockHeader
+	newBlockCh       chan types.EventDataNewBlock
+	opts             ConnectorOptions
+	subscriptions    []connectorSubscription
+	// holding up to maxSubscriptionsPerClient subscriptions each, the first client also serves validators
+	wsClients []*wsclient.WsClient
+	network   string
+	url       string
+	cancel    context.CancelFunc
+	ctx       context.Context
 }
 
-func NewConnector(ctx context.Context, network string, url string) (*Connector, error) {
+func NewConnector(ctx context.Context, network string, url string, opts ConnectorOptions) (*Connector, error) {
 	ctx, cancel := context.WithCancel(ctx)
-	client, err := wsclient.NewClient(url)
-	if err != nil {
-		cancel()
-		return nil, err
+	subscriptions := append([]connectorSubscription{}, connectorSubscriptions...)
+	if opts.FullBlocks {
+		subscriptions = append(subscriptions, newBlockSubscription)
+	} else {
+		subscriptions = append(subscriptions, newBlockHeaderSubscription)
+	}
+	var (
+		clients = make([]*wsclient.WsClient, (len(subscriptions)+maxSubscriptionsPerClient-1)/maxSubscriptionsPerClient)
+		states  = make([]atomic.Int32, len(clients))
+	)
+	chainID := opts.ChainIDs[network]
+	for i := range clients {
+		opts := wsclient.DefaultOptions()
+		// endpoints which can't be reached yet are connected once they come up
+		opts.ConnectInBackground = true
+		opts.ChainID = chainID
+		opts.OnStateChange = func(state wsclient.ConnectionState) {
+			states[i].Store(int32(state))
+			log.Info().Str("network", network).Str("url", url).Int("client", i).Str("state", state.String()).Msg("connection state changed")
+			combined := make([]wsclient.ConnectionState, len(states))
+			for j := range states {
+				combined[j] = wsclient.ConnectionState(states[j].Load())
+			}
+			metrics.ConnectionState.WithLabelValues(network, url).Set(float64(combinedState(combined)))
+		}
+		client, err := wsclient.NewClientWithOptions(url, opts)
+		if err != nil {
+			for _, client := range clients[:i] {
+				client.Close()
+			}
+			cancel()
+			return nil, err
+		}
+		clients[i] = client
+	}
+	roundEventChs := make(map[string]chan ReceivedEvent[types.EventDataRoundState], len(common.RoundEventTypes))
+	for _, eventType := range common.RoundEventTypes {
+		roundEventChs[eventType] = make(chan ReceivedEvent[types.EventDataRoundState], 256)
 	}
 	return &Connector{
-		wsClient:       client,
-		network:        network,
-		newRoundCh:     make(chan types.EventDataNewRound, 256),
-		voteCh:         make(chan types.EventDataVote, 1024),
-		newRoundStepCh: make(chan types.EventDataRoundState, 256),
-		ctx:            ctx,
-		cancel:         cancel,
+		wsClients:          clients,
+		network:            network,
+		url:                url,
+		newRoundCh:         make(chan types.EventDataNewRound, 256),
+		voteCh:             make(chan types.EventDataVote, 1024),
+		newRoundStepCh:     make(chan ReceivedEvent[types.EventDataRoundState], 256),
+		completeProposalCh: make(chan ReceivedEvent[types.EventDataCompleteProposal], 256),
+		roundEventChs:      roundEventChs,
+		newBlockHeaderCh:   make(chan types.EventDataNewBlockHeader, 64),
+		newBlockCh:         make(chan types.EventDataNewBlock, 64),
+		opts:               opts,
+		subscriptions:      subscriptions,
+		ctx:                ctx,
+		cancel:             cancel,
 	}, nil
 }
 
-// Starts the connector event loop, which subscribes to Vote, NewRound, and NewRoundStep events
+// Starts the connector event loop, which subscribes to Vote, NewRound, NewRoundStep, CompleteProposal, the
+// round state events of common.RoundEventTypes, and NewBlockHeader or NewBlock
 func (c *Connector) Start() error {
-	votes, err := c.wsClient.SubscribeVotes(c.ctx)
-	if err != nil {
-		return err
-	}
-	go func() {
-		for {
-			select {
-			case msg := <-votes:
-				if voteInfo, ok := msg.Data.(types.EventDataVote); ok {
-					c.voteCh <- voteInfo
-				}
-			case <-c.ctx.Done():
-				return
-			}
+	for i, subscription := range c.subscriptions {
+		events, err := subscription.subscribe(c.wsClients[i/maxSubscriptionsPerClient], c.ctx)
+		if err != nil {
+			return err
 		}
-	}()
-	newRounds, err := c.wsClient.SubscribeNewRound(c.ctx)
-	if err != nil {
-		return err
-	}
-	go func() {
-		for {
-			select {
-			case msg := <-newRounds:
-				if roundInfo, ok := msg.Data.(types.EventDataNewRound); ok {
-					c.newRoundCh <- roundInfo
+		go func(forward func(*Connector, types.TMEventData, time.Time)) {
+			for {
+				select {
+				case msg, ok := <-events:
+					// the channel is only closed once the client is closed
+					if !ok {
+						return
+					}
+					forward(c, msg.Data, time.Now())
+				case <-c.ctx.Done():
+					return
 				}
-			case <-c.ctx.Done():
-				return
 			}
-		}
-	}()
-	newRoundSteps, err := c.wsClient.SubscribeNewRoundStep(c.ctx)
-	if err != nil {
-		return err
+		}(subscription.forward)
 	}
-
-	go func() {
-		for {
-			select {
-			case msg := <-newRoundSteps:
-				if roundInfo, ok := msg.Data.(types.EventDataRoundState); ok {
-					c.newRoundStepCh <- roundInfo
-				}
-			case <-c.ctx.Done():
-				return
-			}
-		}
-	}()
 	return nil
 }
 
@@ -100,21 +207,88 @@ func (c *Connector) GetNewRounds() <-chan types.EventDataNewRound {
 	return c.newRoundCh
 }
 
-// Returns a channel that can be used to retrieve NewRoundStep events
-func (c *Connector) GetNewRoundSteps() <-chan types.EventDataRoundState {
+// Returns a channel that can be used to retrieve NewRoundStep events, along with the time they were received
+func (c *Connector) GetNewRoundSteps() <-chan ReceivedEvent[types.EventDataRoundState] {
 	return c.newRoundStepCh
 }
 
+// Returns a channel that can be used to retrieve CompleteProposal events, along with the time they were received
+func (c *Connector) GetCompleteProposals() <-chan ReceivedEvent[types.EventDataCompleteProposal] {
+	return c.completeProposalCh
+}
+
+// Returns a channel that can be used to retrieve the round state events of eventType, one of
+// common.RoundEventTypes, along with the time they were received
+func (c *Connector) GetRoundEvents(eventType string) <-chan ReceivedEvent[types.EventDataRoundState] {
+	return c.roundEventChs[eventType]
+}
+
+// Returns a channel that can be used to retrieve NewBlockHeader events, unless subscribed to full blocks
+func (c *Connector) GetNewBlockHeaders() <-chan types.EventDataNewBlockHeader {
+	return c.newBlockHeaderCh
+}
+
+// Returns a channel that can be used to retrieve NewBlock events, if subscribed to full blocks
+func (c *Connector) GetNewBlocks() <-chan types.EventDataNewBlock {
+	return c.newBlockCh
+}
+
 // Returns the network this connector is for
 func (c *Connector) Network() string {
 	return c.network
 }
 
+// Returns the fraction of the capacity of each event channel which is in use, keyed by stream
+func (c *Connector) ChannelFill() map[string]float64 {
+	fill := map[string]float64{
+		common.StreamVotes:            float64(len(c.voteCh)) / float64(cap(c.voteCh)),
+		common.StreamNewRound:         float64(len(c.newRoundCh)) / float64(cap(c.newRoundCh)),
+		common.StreamNewRoundStep:     float64(len(c.newRoundStepCh)) / float64(cap(c.newRoundStepCh)),
+		common.StreamCompleteProposal: float64(len(c.completeProposalCh)) / float64(cap(c.completeProposalCh)),
+	}
+	if c.opts.FullBlocks {
+		fill[common.StreamBlocks] = float64(len(c.newBlockCh)) / float64(cap(c.newBlockCh))
+	} else {
+		fill[common.StreamBlocks] = float64(len(c.newBlockHeaderCh)) / float64(cap(c.newBlockHeaderCh))
+	}
+	for eventType, ch := range c.roundEventChs {
+		fill[common.RoundEventStreams[eventType]] = float64(len(ch)) / float64(cap(ch))
+	}
+	return fill
+}
+
+// Returns the rpc url this connector is connected to
+func (c *Connector) URL() string {
+	return c.url
+}
+
 // Returns all currently active validators for this network
 func (c *Connector) Validators() ([]*types.Validator, error) {
-	return c.wsClient.Validators(c.ctx)
+	return c.wsClients[0].Validators(c.ctx)
+}
+
+// Returns the state of the websocket connections, which is connected only if all of them are connected
+func (c *Connector) State() wsclient.ConnectionState {
+	states := make([]wsclient.ConnectionState, 0, len(c.wsClients))
+	for _, client := range c.wsClients {
+		states = append(states, client.State())
+	}
+	return combinedState(states)
 }
 
 func (c *Connector) Close() {
 	c.cancel()
+	for _, client := range c.wsClients {
+		client.Close()
+	}
+}
+
+// returns the first state which isn't connected, or connected if all states are connected
+func combinedState(states []wsclient.ConnectionState) wsclient.ConnectionState {
+	for _, state := range states {
+		if state != wsclient.StateConnected {
+			return state
+		}
+	}
+	return wsclient.StateConnected
 }
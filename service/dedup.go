@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/cometbft/cometbft/types"
+)
+
+// Deduplicator filters out events of a network which have already been received from another endpoint.
+// Events are tracked by height, and heights which fall more than window heights behind the latest height are pruned
+type Deduplicator struct {
+	mu sync.Mutex
+	// height -> event keys
+	seen         map[int64]map[string]struct{}
+	latestHeight int64
+	window       int64
+}
+
+func NewDeduplicator(window int64) *Deduplicator {
+	return &Deduplicator{
+		seen:   make(map[int64]map[string]struct{}),
+		window: window,
+	}
+}
+
+// Returns true if the vote has not been seen before. Votes are identified by their signature, so that conflicting
+// votes of a validator are never mistaken for duplicates
+func (d *Deduplicator) Vote(vote types.EventDataVote) bool {
+	return d.firstSeen(vote.Vote.Height, fmt.Sprintf(
+		"vote/%d/%s/%s/%s",
+		vote.Vote.Round, vote.Vote.Type.String(), vote.Vote.ValidatorAddress.String(), hex.EncodeToString(vote.Vote.Signature),
+	))
+}
+
+// Returns true if the new round event has not been seen before
+func (d *Deduplicator) NewRound(round types.EventDataNewRound) bool {
+	return d.firstSeen(round.Height, fmt.Sprintf("round/%d", round.Round))
+}
+
+// Returns true if the new round step event has not been seen before
+func (d *Deduplicator) NewRoundStep(step types.EventDataRoundState) bool {
+	return d.firstSeen(step.Height, fmt.Sprintf("step/%d/%s", step.Round, step.Step))
+}
+
+// Returns true if the complete proposal event has not been seen before
+func (d *Deduplicator) CompleteProposal(proposal types.EventDataCompleteProposal) bool {
+	return d.firstSeen(proposal.Height, fmt.Sprintf("proposal/%d/%s", proposal.Round, proposal.BlockID.String()))
+}
+
+// Returns true if the round state event has not been seen before. TimeoutWait is published for both the
+// prevote and precommit wait of a round, so events are identified by their step as well
+func (d *Deduplicator) RoundEvent(eventType string, roundInfo types.EventDataRoundState) bool {
+	return d.firstSeen(roundInfo.Height, fmt.Sprintf("%s/%d/%s", eventType, roundInfo.Round, roundInfo.Step))
+}
+
+// Returns true if the block, or block header, of the height has not been seen before
+func (d *Deduplicator) Block(height int64) bool {
+	return d.firstSeen(height, "block")
+}
+
+func (d *Deduplicator) firstSeen(height int64, key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if height <= d.latestHeight-d.window {
+		// events this old have been pruned, so they can no longer be deduplicated
+		return false
+	}
+	keys, ok := d.seen[height]
+	if !ok {
+		keys = make(map[string]struct{})
+		d.seen[height] = keys
+	}
+	if _, ok := keys[key]; ok {
+		return false
+	}
+	keys[key] = struct{}{}
+	if height > d.latestHeight {
+		d.latestHeight = height
+		d.prune()
+	}
+	return true
+}
+
+func (d *Deduplicator) prune() {
+	for height := range d.seen {
+		if height <= d.latestHeight-d.window {
+			delete(d.seen, height)
+		}
+	}
+}
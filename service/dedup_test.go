@@ -0,0 +1,54 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/cometbft/cometbft/crypto"
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	dedup := service.NewDeduplicator(10)
+	vote := func(height int64, signature string) types.EventDataVote {
+		return types.EventDataVote{Vote: &types.Vote{
+			Type:             cmtproto.PrevoteType,
+			Height:           height,
+			ValidatorAddress: crypto.AddressHash([]byte("validator_address")),
+			Signature:        []byte(signature),
+		}}
+	}
+
+	require.True(t, dedup.Vote(vote(1, "a")))
+	// the same vote received from another endpoint
+	require.False(t, dedup.Vote(vote(1, "a")))
+	// conflicting votes are not duplicates
+	require.True(t, dedup.Vote(vote(1, "b")))
+
+	require.True(t, dedup.NewRound(types.EventDataNewRound{Height: 1, Round: 0}))
+	require.False(t, dedup.NewRound(types.EventDataNewRound{Height: 1, Round: 0}))
+	require.True(t, dedup.NewRound(types.EventDataNewRound{Height: 1, Round: 1}))
+
+	require.True(t, dedup.NewRoundStep(types.EventDataRoundState{Height: 1, Round: 0, Step: "RoundStepPropose"}))
+	require.False(t, dedup.NewRoundStep(types.EventDataRoundState{Height: 1, Round: 0, Step: "RoundStepPropose"}))
+	require.True(t, dedup.NewRoundStep(types.EventDataRoundState{Height: 1, Round: 0, Step: "RoundStepPrevote"}))
+
+	proposal := types.EventDataCompleteProposal{Height: 1, Round: 0, Step: "RoundStepPropose"}
+	require.True(t, dedup.CompleteProposal(proposal))
+	require.False(t, dedup.CompleteProposal(proposal))
+
+	// the prevote and precommit wait of a round both publish TimeoutWait
+	timeoutWait := types.EventDataRoundState{Height: 1, Step: "RoundStepPrevoteWait"}
+	require.True(t, dedup.RoundEvent(types.EventTimeoutWait, timeoutWait))
+	require.False(t, dedup.RoundEvent(types.EventTimeoutWait, timeoutWait))
+	timeoutWait.Step = "RoundStepPrecommitWait"
+	require.True(t, dedup.RoundEvent(types.EventTimeoutWait, timeoutWait))
+	require.True(t, dedup.RoundEvent(types.EventPolka, types.EventDataRoundState{Height: 1, Step: "RoundStepPrevote"}))
+
+	// heights outside of the window are pruned and events for them are dropped
+	require.True(t, dedup.Vote(vote(11, "a")))
+	require.False(t, dedup.Vote(vote(1, "c")))
+	require.True(t, dedup.Vote(vote(2, "a")))
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rs/zerolog/log"
+)
+
+// EventTail follows the event streams of one or more networks without consuming them,
+// allowing it to run alongside the redis event stream service
+type EventTail struct {
+	Streams cred.Streams
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewEventTail(
+	ctx context.Context,
+	redisUrl string,
+) (*EventTail, error) {
+	cc, err := cred.New(ctx, redisUrl, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventTailWithStreams(ctx, cc), nil
+}
+
+// Creates a tail following existing streams
+func NewEventTailWithStreams(ctx context.Context, streams cred.Streams) *EventTail {
+	ctx, cancel := context.WithCancel(ctx)
+	return &EventTail{
+		Streams: streams,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Starts following the vote, new round and new round step streams of the given networks, sending
+// every event written after Tail is called to outCh. Events are read from the live streams, which
+// unlike the streams persisted by the redis event stream service are never acknowledged and deleted.
+// Returns once the tail has been stopped
+func (et *EventTail) Tail(
+	networks []string,
+	outCh chan<- common.StreamEvent,
+) error {
+	var (
+		streams = common.LiveStreams
+		keys    = make([]string, 0, len(networks)*len(streams))
+		ids     = make([]string, 0, len(networks)*len(streams))
+		origin  = make(map[string]common.StreamEvent, len(networks)*len(streams))
+	)
+	for _, network := range networks {
+		for _, stream := range streams {
+			key := common.LiveStreamKey(network, stream)
+			lastID, err := et.Streams.LastID(et.ctx, key)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			ids = append(ids, lastID)
+			origin[key] = common.StreamEvent{Network: network, Stream: stream}
+		}
+	}
+	for {
+		messages, err := et.Streams.Read(et.ctx, keys, ids, time.Second)
+		select {
+		case <-et.ctx.Done():
+			return nil
+		default:
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("failed to tail redis streams")
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, message := range messages {
+			event := origin[message.Stream]
+			for i, key := range keys {
+				if key == message.Stream {
+					ids[i] = message.ID
+				}
+			}
+			data, err := parseRedisMessage(event.Stream, message)
+			if err != nil {
+				log.Error().Err(err).Str("event.type", event.Stream).Str("id", message.ID).Msg("failed to parse redis message")
+				continue
+			}
+			event.ID = message.ID
+			event.Data = data
+			select {
+			case outCh <- event:
+			case <-et.ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (et *EventTail) Close() {
+	et.cancel()
+}
@@ -0,0 +1,69 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTailPersistedEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	validator := types.NewMockPV()
+	storeVote := func(height int64) {
+		require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: &types.Vote{
+			Type:             cmtproto.PrevoteType,
+			Height:           height,
+			Timestamp:        time.Now().UTC().Round(0),
+			ValidatorAddress: validator.PrivKey.PubKey().Address(),
+			Signature:        []byte("signature"),
+		}}))
+	}
+
+	tail := service.NewEventTailWithStreams(ctx, streams)
+	defer tail.Close()
+	events := make(chan common.StreamEvent)
+	go func() { _ = tail.Tail([]string{"osmosis"}, events) }()
+
+	// the tail reads the first vote and blocks sending it while the remaining votes are persisted,
+	// acknowledged and deleted from the stream
+	time.Sleep(100 * time.Millisecond)
+	storeVote(1)
+	time.Sleep(100 * time.Millisecond)
+	storeVote(2)
+	storeVote(3)
+
+	batch := service.DefaultBatchOptions()
+	batch.Interval = 10 * time.Millisecond
+	eventStream := service.NewRedisEventStreamWithStreams(ctx, streams, database, "ctop", "test", time.Minute, batch)
+	defer eventStream.Close()
+	go func() { _ = eventStream.PersistVoteEvents("osmosis") }()
+	require.Eventually(t, func() bool {
+		info, err := streams.Info(ctx, common.StreamKey("osmosis", common.StreamVotes), "ctop")
+		require.NoError(t, err)
+		return info.Length == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for height := int64(1); height <= 3; height++ {
+		select {
+		case event := <-events:
+			require.Equal(t, height, event.Data.(*common.ParsedVote).Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("vote at height %d was not tailed", height)
+		}
+	}
+}
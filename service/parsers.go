@@ -3,11 +3,43 @@ package service
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/cred"
 )
 
+// parses a message read from one of the network event streams, the block height is encoded in the message id
+func parseRedisMessage(stream string, message cred.Message) (interface{}, error) {
+	parts := strings.Split(message.ID, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("improperly formatted id %s", message.ID)
+	}
+	blockHeight, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("block height ParseInt failed %s", err)
+	}
+	switch stream {
+	case common.StreamVotes:
+		return parseRedisValueToVote(blockHeight, message.Values)
+	case common.StreamNewRound:
+		return parseRedisValueToNewRound(blockHeight, message.Values)
+	case common.StreamNewRoundStep:
+		return parseRedisValueToRoundState(blockHeight, message.Values)
+	case common.StreamCompleteProposal:
+		return parseRedisValueToCompleteProposal(blockHeight, message.Values)
+	case common.StreamBlocks:
+		return parseRedisValueToBlock(blockHeight, message.Values)
+	}
+	for eventType, roundEventStream := range common.RoundEventStreams {
+		if stream == roundEventStream {
+			return parseRedisValueToRoundEvent(eventType, blockHeight, message.Values)
+		}
+	}
+	return nil, fmt.Errorf("unsupported stream %s", stream)
+}
+
 func parseRedisValueToNewRound(blockHeight int64, values map[string]interface{}) (*common.ParsedNewRound, error) {
 	var (
 		err           error
@@ -85,13 +117,163 @@ func parseRedisValueToRoundState(blockHeight int64, values map[string]interface{
 		return nil, fmt.Errorf("failed to parse step")
 	}
 
+	receivedAt, err := parseReceivedAt(values)
+	if err != nil {
+		return nil, err
+	}
 	return &common.ParsedNewRoundStep{
-		Height: blockHeight,
-		Round:  round,
-		Step:   step,
+		Height:     blockHeight,
+		Round:      round,
+		Step:       step,
+		ReceivedAt: receivedAt,
+	}, nil
+}
+
+// parses the time an event was received, messages written before it was recorded return a zero time
+func parseReceivedAt(values map[string]interface{}) (time.Time, error) {
+	receivedAt_, ok := values["received_at"].(string)
+	if !ok || receivedAt_ == "" {
+		return time.Time{}, nil
+	}
+	receivedAt, err := time.Parse(time.RFC3339Nano, receivedAt_)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse received_at %v", err)
+	}
+	return receivedAt, nil
+}
+
+func parseRedisValueToCompleteProposal(blockHeight int64, values map[string]interface{}) (*common.ParsedCompleteProposal, error) {
+	var (
+		err     error
+		ok      bool
+		round   int64
+		step    string
+		blockID string
+	)
+
+	if values["round"] == nil {
+		return nil, fmt.Errorf("round is nil")
+	} else if round_, ok := values["round"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse round")
+	} else {
+		round, err = strconv.ParseInt(round_, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("round ParseInt failed %s", err)
+		}
+	}
+
+	if values["step"] == nil {
+		return nil, fmt.Errorf("step is nil")
+	} else if step, ok = values["step"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse step")
+	}
+
+	if values["block_id"] == nil {
+		return nil, fmt.Errorf("block_id is nil")
+	} else if blockID, ok = values["block_id"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse block_id")
+	}
+
+	receivedAt, err := parseReceivedAt(values)
+	if err != nil {
+		return nil, err
+	}
+	return &common.ParsedCompleteProposal{
+		Height:     blockHeight,
+		Round:      round,
+		Step:       step,
+		BlockID:    blockID,
+		ReceivedAt: receivedAt,
+	}, nil
+}
+
+func parseRedisValueToRoundEvent(eventType string, blockHeight int64, values map[string]interface{}) (*common.ParsedRoundEvent, error) {
+	var (
+		err   error
+		ok    bool
+		round int64
+		step  string
+	)
+
+	if values["round"] == nil {
+		return nil, fmt.Errorf("round is nil")
+	} else if round_, ok := values["round"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse round")
+	} else {
+		round, err = strconv.ParseInt(round_, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("round ParseInt failed %s", err)
+		}
+	}
+
+	if values["step"] == nil {
+		return nil, fmt.Errorf("step is nil")
+	} else if step, ok = values["step"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse step")
+	}
+
+	receivedAt, err := parseReceivedAt(values)
+	if err != nil {
+		return nil, err
+	}
+	return &common.ParsedRoundEvent{
+		Type:       eventType,
+		Height:     blockHeight,
+		Round:      round,
+		Step:       step,
+		ReceivedAt: receivedAt,
 	}, nil
 }
 
+func parseRedisValueToBlock(blockHeight int64, values map[string]interface{}) (*common.ParsedBlock, error) {
+	var (
+		err      error
+		ok       bool
+		time_    time.Time
+		proposer string
+		block    = &common.ParsedBlock{Height: blockHeight}
+	)
+
+	if values["time"] == nil {
+		return nil, fmt.Errorf("time is nil")
+	} else if timestamp_, ok := values["time"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse time")
+	} else {
+		time_, err = time.Parse(time.RFC3339Nano, timestamp_)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time %v", err)
+		}
+	}
+	block.Time = time_
+
+	if values["proposer"] == nil {
+		return nil, fmt.Errorf("proposer is nil")
+	} else if proposer, ok = values["proposer"].(string); !ok {
+		return nil, fmt.Errorf("failed to parse proposer")
+	}
+	block.ProposerAddress = proposer
+
+	// the tx count and last commit are empty for block headers
+	if numTxs_, ok := values["num_txs"].(string); ok && numTxs_ != "" {
+		numTxs, err := strconv.ParseInt(numTxs_, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("num_txs ParseInt failed %s", err)
+		}
+		block.NumTxs = &numTxs
+	}
+	if round_, ok := values["last_commit_round"].(string); ok && round_ != "" {
+		round, err := strconv.ParseInt(round_, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("last_commit_round ParseInt failed %s", err)
+		}
+		block.LastCommitRound = &round
+	}
+	if signers, ok := values["last_commit_signers"].(string); ok {
+		block.LastCommitSigners = signers
+	}
+	return block, nil
+}
+
 func parseRedisValueToVote(blockHeight int64, values map[string]interface{}) (*common.ParsedVote, error) {
 	var (
 		err              error
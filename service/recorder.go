@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rs/zerolog/log"
+)
+
+// interval at which recorded events are flushed, so that a recording is readable if the recorder is killed
+const recordFlushInterval = time.Second
+
+// Recorder writes every event received by the connectors of the networks to a recording, along with the time
+// it was received. Events are recorded before they are deduplicated
+type Recorder struct {
+	writer     *recording.Writer
+	connectors []*Connector
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func NewRecorder(
+	ctx context.Context,
+	writer *recording.Writer,
+	// network_name -> rpc_urls
+	endpoints map[string][]string,
+	opts ConnectorOptions,
+) (*Recorder, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	connectors, err := connectAll(ctx, endpoints, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Recorder{writer: writer, connectors: connectors, ctx: ctx, cancel: cancel}, nil
+}
+
+// Subscribes to the events of every connector and starts recording them
+func (r *Recorder) Start() error {
+	for _, connector := range r.connectors {
+		if err := connector.Start(); err != nil {
+			return err
+		}
+		r.wg.Add(1)
+		go func(connector *Connector) {
+			defer r.wg.Done()
+			for {
+				var (
+					eventType  string
+					data       types.TMEventData
+					receivedAt time.Time
+				)
+				select {
+				case <-r.ctx.Done():
+					return
+				case voteInfo := <-connector.GetVotes():
+					eventType, data, receivedAt = types.EventVote, voteInfo, time.Now()
+				case roundInfo := <-connector.GetNewRounds():
+					eventType, data, receivedAt = types.EventNewRound, roundInfo, time.Now()
+				case received := <-connector.GetNewRoundSteps():
+					eventType, data, receivedAt = types.EventNewRoundStep, received.Data, received.ReceivedAt
+				case received := <-connector.GetCompleteProposals():
+					eventType, data, receivedAt = types.EventCompleteProposal, received.Data, received.ReceivedAt
+				case headerInfo := <-connector.GetNewBlockHeaders():
+					eventType, data, receivedAt = types.EventNewBlockHeader, headerInfo, time.Now()
+				case blockInfo := <-connector.GetNewBlocks():
+					eventType, data, receivedAt = types.EventNewBlock, blockInfo, time.Now()
+				}
+				r.record(connector, eventType, data, receivedAt)
+			}
+		}(connector)
+		for _, eventType := range common.RoundEventTypes {
+			r.wg.Add(1)
+			go func(connector *Connector, eventType string) {
+				defer r.wg.Done()
+				for {
+					select {
+					case <-r.ctx.Done():
+						return
+					case received := <-connector.GetRoundEvents(eventType):
+						r.record(connector, eventType, received.Data, received.ReceivedAt)
+					}
+				}
+			}(connector, eventType)
+		}
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(recordFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.writer.Flush(); err != nil {
+					log.Error().Err(err).Msg("failed to flush recording")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Recorder) record(connector *Connector, eventType string, data types.TMEventData, receivedAt time.Time) {
+	if err := r.writer.Write(recording.Event{
+		Time:    receivedAt.UTC(),
+		Network: connector.Network(),
+		URL:     connector.URL(),
+		Type:    eventType,
+		Data:    data,
+	}); err != nil {
+		log.Error().Err(err).Str("network", connector.Network()).Msg("failed to record event")
+	}
+}
+
+// Stops recording and closes the connectors, the writer is left open
+func (r *Recorder) Close() {
+	r.cancel()
+	r.wg.Wait()
+	for _, connector := range r.connectors {
+		connector.Close()
+	}
+}
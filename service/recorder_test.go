@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	cmtpubsub "github.com/cometbft/cometbft/libs/pubsub"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rangesecurity/ctop/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	set, privVals := testutil.NewValidatorSet(4, 10)
+	node, err := testutil.NewNode(ctx, "127.0.0.1:0", set.Validators)
+	require.NoError(t, err)
+	defer node.Close()
+
+	// both endpoints receive every event, which is recorded twice
+	var buf bytes.Buffer
+	writer := recording.NewWriter(&buf)
+	recorder, err := service.NewRecorder(
+		ctx,
+		writer,
+		map[string][]string{"osmosis": {node.URL(), node.URL()}},
+		service.ConnectorOptions{FullBlocks: true},
+	)
+	require.NoError(t, err)
+	require.NoError(t, recorder.Start())
+	for _, query := range []cmtpubsub.Query{
+		types.EventQueryVote,
+		types.EventQueryNewRound,
+		types.EventQueryNewRoundStep,
+		types.EventQueryCompleteProposal,
+		types.EventQueryValidBlock,
+		types.EventQueryNewBlock,
+	} {
+		require.NoError(t, node.WaitForSubscriptions(ctx, query.String(), 2))
+	}
+
+	var published int64
+	for height := int64(100); height < 102; height++ {
+		events, err := testutil.CommitHeight(set, privVals, height, time.Now().UTC().Round(0))
+		require.NoError(t, err)
+		blockEvents, err := testutil.BlockEvents(set, privVals, height, time.Now().UTC().Round(0), 1)
+		require.NoError(t, err)
+		// only NewBlock events are subscribed to
+		events = append(events, blockEvents[0])
+		require.NoError(t, node.Play(ctx, events))
+		published += int64(len(events))
+	}
+	require.Eventually(t, func() bool {
+		return writer.Events() == 2*published
+	}, 10*time.Second, 10*time.Millisecond)
+	recorder.Close()
+	require.NoError(t, writer.Close())
+
+	reader, err := recording.NewReader(&buf)
+	require.NoError(t, err)
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	stored, err := service.NewReplayer(ctx, streams, 0, "").Replay(reader)
+	require.NoError(t, err)
+	require.Equal(t, int(published), stored)
+
+	// 8 votes, 1 round, 6 steps, 1 proposal, valid block, polka, lock and block at every height
+	for stream, length := range map[string]int64{
+		"votes":             16,
+		"new_round":         2,
+		"new_round_step":    12,
+		"complete_proposal": 2,
+		"valid_block":       2,
+		"polka":             2,
+		"lock":              2,
+		"blocks":            2,
+	} {
+		require.NoError(t, streams.CreateGroup(ctx, "osmosis:"+stream, "ctop"))
+		info, err := streams.Info(ctx, "osmosis:"+stream, "ctop")
+		require.NoError(t, err)
+		require.Equal(t, length, info.Length, stream)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var buf bytes.Buffer
+	writer := recording.NewWriter(&buf)
+	received := time.Now().UTC()
+	for i := int64(0); i < 3; i++ {
+		require.NoError(t, writer.Write(recording.Event{
+			Time:    received.Add(time.Duration(i) * 200 * time.Millisecond),
+			Network: "osmosis",
+			Data:    types.EventDataRoundState{Height: 100 + i, Step: "RoundStepNewHeight"},
+		}))
+	}
+	require.NoError(t, writer.Close())
+
+	reader, err := recording.NewReader(&buf)
+	require.NoError(t, err)
+	start := time.Now()
+	// 400ms of events replayed at twice the speed
+	stored, err := service.NewReplayer(ctx, cred.NewMemoryStreams(cred.DefaultMemoryCapacity), 2, "").Replay(reader)
+	require.NoError(t, err)
+	require.Equal(t, 3, stored)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestReplayNetworkPrefix(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	recorded := func() *recording.Reader {
+		var buf bytes.Buffer
+		writer := recording.NewWriter(&buf)
+		for height := int64(100); height < 103; height++ {
+			require.NoError(t, writer.Write(recording.Event{
+				Time:    time.Now().UTC(),
+				Network: "osmosis",
+				Data:    types.EventDataRoundState{Height: height, Step: "RoundStepNewHeight"},
+			}))
+		}
+		require.NoError(t, writer.Close())
+		reader, err := recording.NewReader(&buf)
+		require.NoError(t, err)
+		return reader
+	}
+
+	// the live network is past the heights of the recording, and its acknowledged messages were deleted
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	require.NoError(t, streams.StoreNewRound(ctx, "osmosis", types.EventDataNewRound{Height: 200}))
+	require.NoError(t, streams.CreateGroup(ctx, "osmosis:new_round", "ctop"))
+	messages, err := streams.ReadGroup(ctx, "osmosis:new_round", "ctop", "test", ">", 10, 0)
+	require.NoError(t, err)
+	require.NoError(t, streams.Ack(ctx, "osmosis:new_round", "ctop", messages[0].ID))
+
+	stored, err := service.NewReplayer(ctx, streams, 0, "").Replay(recorded())
+	require.ErrorContains(t, err, "osmosis:new_round already holds height 200")
+	require.Zero(t, stored)
+
+	stored, err = service.NewReplayer(ctx, streams, 0, "replay-").Replay(recorded())
+	require.NoError(t, err)
+	require.Equal(t, 3, stored)
+	lastID, err := streams.LastID(ctx, "replay-osmosis:new_round_step")
+	require.NoError(t, err)
+	require.Equal(t, "102-1", lastID)
+}
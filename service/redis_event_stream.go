@@ -2,231 +2,555 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	cmtpubsub "github.com/cometbft/cometbft/libs/pubsub"
 	"github.com/cometbft/cometbft/types"
 	"github.com/rangesecurity/ctop/common"
 	"github.com/rangesecurity/ctop/cred"
 	"github.com/rangesecurity/ctop/db"
-	"github.com/redis/go-redis/v9"
+	"github.com/rangesecurity/ctop/metrics"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// duration a message may remain unacknowledged before it is reclaimed by another consumer
+	DefaultClaimIdle = time.Minute
+	// duration to block waiting for new messages
+	readBlock = time.Second
+	// maximum number of messages read at once
+	readCount = 1000
+	// interval at which throughput and lag are logged
+	statsInterval = 30 * time.Second
+	// interval at which throughput and lag metrics are updated
+	metricsInterval = 5 * time.Second
+	// number of times a batch is stored before its messages are left to be reclaimed
+	storeAttempts = 5
+	// delay before a failed batch is stored again, doubled after every attempt
+	storeRetryDelay = time.Second
+)
+
+// BatchOptions configures how many events are written to the database at once
+type BatchOptions struct {
+	// maximum number of events written at once
+	Size int
+	// network -> maximum number of events written at once, overriding Size
+	NetworkSizes map[string]int
+	// maximum duration an event waits for its batch to fill up
+	Interval time.Duration
+}
+
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{
+		Size:     500,
+		Interval: time.Second,
+	}
+}
+
+// Returns the batch size of a network
+func (bo BatchOptions) SizeFor(network string) int {
+	if size, ok := bo.NetworkSizes[network]; ok {
+		return size
+	}
+	return bo.Size
+}
+
+// a message read from a redis stream, which must be acknowledged once it has been persisted
+type StreamMessage struct {
+	ID    string
+	Event interface{}
+}
+
+// RedisEventStream persists events from redis streams using consumer groups. Messages are only acknowledged, and
+// removed from the stream, once they have been stored in the database. Batches which fail to be stored are retried
+// with a backoff, messages which remain unacknowledged for longer than the claim idle duration, such as after a
+// crash or batches which kept failing, are reclaimed and retried, allowing multiple consumers of a group to share
+// the load
 type RedisEventStream struct {
-	CredClient *cred.CredClient
-	Database   *db.Database
-	ctx        context.Context
-	cancel     context.CancelFunc
+	Streams  cred.Streams
+	Database db.Store
+	// optional, called with the network once a batch of votes has been stored
+	VotesStored func(network string)
+	group       string
+	consumer    string
+	claimIdle   time.Duration
+	batch       BatchOptions
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 func NewRedisEventStream(
 	ctx context.Context,
 	redisUrl string,
 	unsafe bool,
-	database *db.Database,
+	database db.Store,
+	group string,
+	consumer string,
+	claimIdle time.Duration,
+	batch BatchOptions,
 ) (*RedisEventStream, error) {
-	ctx, cancel := context.WithCancel(ctx)
 	cc, err := cred.New(ctx, redisUrl, unsafe)
 	if err != nil {
-		cancel()
 		return nil, err
 	}
+	return NewRedisEventStreamWithStreams(ctx, cc, database, group, consumer, claimIdle, batch), nil
+}
+
+// Creates an event stream reading from existing streams, allowing the redis connection pool, or in memory
+// streams, to be shared
+func NewRedisEventStreamWithStreams(
+	ctx context.Context,
+	streams cred.Streams,
+	database db.Store,
+	group string,
+	consumer string,
+	claimIdle time.Duration,
+	batch BatchOptions,
+) *RedisEventStream {
+	ctx, cancel := context.WithCancel(ctx)
 	return &RedisEventStream{
-		CredClient: cc,
-		Database:   database,
-		ctx:        ctx,
-		cancel:     cancel,
-	}, nil
+		Streams:   streams,
+		Database:  database,
+		group:     group,
+		consumer:  consumer,
+		claimIdle: claimIdle,
+		batch:     batch,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
 }
 
 func (rds *RedisEventStream) PersistVoteEvents(
 	network string,
 ) error {
-	outCh := make(chan interface{}, 1024)
-	if err := rds.StreamRedisEvents(
-		network,
-		types.EventQueryVote,
-		outCh,
-	); err != nil {
-		return fmt.Errorf("failed to stream redis events %+v", err)
-	}
-	for {
-		select {
-		case msg := <-outCh:
-			voteInfo, ok := msg.(*common.ParsedVote)
+	return rds.persist(network, types.EventQueryVote, func(ctx context.Context, events []interface{}) error {
+		votes := make([]common.ParsedVote, 0, len(events))
+		for _, event := range events {
+			voteInfo, ok := event.(*common.ParsedVote)
 			if !ok {
-				log.Error().Msg("unexpected msg type")
-				continue
-			}
-			if err := rds.Database.StoreVote(
-				rds.ctx,
-				network,
-				*voteInfo,
-			); err != nil {
-				log.Error().Err(err).Msg("failed to store vote")
+				return errUnexpectedEvent
 			}
-		case <-rds.ctx.Done():
-			return nil
+			votes = append(votes, *voteInfo)
 		}
-	}
+		if err := rds.Database.StoreVotes(ctx, network, votes); err != nil {
+			return err
+		}
+		if rds.VotesStored != nil {
+			rds.VotesStored(network)
+		}
+		return nil
+	})
 }
 
 func (rds *RedisEventStream) PersistNewRoundEvents(
 	network string,
 ) error {
-	outCh := make(chan interface{}, 256)
-	if err := rds.StreamRedisEvents(
-		network,
-		types.EventQueryNewRound,
-		outCh,
-	); err != nil {
-		return fmt.Errorf("failed to stream redis events %+v", err)
-	}
-	for {
-		select {
-		case msg := <-outCh:
-			roundInfo, ok := msg.(*common.ParsedNewRound)
+	return rds.persist(network, types.EventQueryNewRound, func(ctx context.Context, events []interface{}) error {
+		rounds := make([]common.ParsedNewRound, 0, len(events))
+		for _, event := range events {
+			roundInfo, ok := event.(*common.ParsedNewRound)
 			if !ok {
-				log.Error().Msg("unexpected msg type")
-				continue
-			}
-			if err := rds.Database.StoreNewRound(
-				rds.ctx,
-				network,
-				*roundInfo,
-			); err != nil {
-				log.Error().Err(err).Msg("failed to store round")
+				return errUnexpectedEvent
 			}
-		case <-rds.ctx.Done():
-			return nil
+			rounds = append(rounds, *roundInfo)
 		}
-	}
+		return rds.Database.StoreNewRounds(ctx, network, rounds)
+	})
 }
 
 func (rds *RedisEventStream) PersistNewRoundStepEvents(
 	network string,
 ) error {
-	outCh := make(chan interface{}, 256)
-	if err := rds.StreamRedisEvents(
+	return rds.persist(network, types.EventQueryNewRoundStep, func(ctx context.Context, events []interface{}) error {
+		steps := make([]common.ParsedNewRoundStep, 0, len(events))
+		for _, event := range events {
+			roundState, ok := event.(*common.ParsedNewRoundStep)
+			if !ok {
+				return errUnexpectedEvent
+			}
+			steps = append(steps, *roundState)
+		}
+		return rds.Database.StoreNewRoundSteps(ctx, network, steps)
+	})
+}
+
+func (rds *RedisEventStream) PersistCompleteProposalEvents(
+	network string,
+) error {
+	return rds.persist(network, types.EventQueryCompleteProposal, func(ctx context.Context, events []interface{}) error {
+		proposals := make([]common.ParsedCompleteProposal, 0, len(events))
+		for _, event := range events {
+			proposalInfo, ok := event.(*common.ParsedCompleteProposal)
+			if !ok {
+				return errUnexpectedEvent
+			}
+			proposals = append(proposals, *proposalInfo)
+		}
+		return rds.Database.StoreCompleteProposals(ctx, network, proposals)
+	})
+}
+
+func (rds *RedisEventStream) PersistBlockEvents(
+	network string,
+) error {
+	return rds.persist(network, types.EventQueryNewBlockHeader, func(ctx context.Context, events []interface{}) error {
+		blocks := make([]common.ParsedBlock, 0, len(events))
+		for _, event := range events {
+			block, ok := event.(*common.ParsedBlock)
+			if !ok {
+				return errUnexpectedEvent
+			}
+			blocks = append(blocks, *block)
+		}
+		return rds.Database.StoreBlocks(ctx, network, blocks)
+	})
+}
+
+// Persists the round state events of eventType, one of common.RoundEventTypes
+func (rds *RedisEventStream) PersistRoundEvents(
+	network string,
+	eventType string,
+) error {
+	return rds.persist(network, types.QueryForEvent(eventType), func(ctx context.Context, events []interface{}) error {
+		roundEvents := make([]common.ParsedRoundEvent, 0, len(events))
+		for _, event := range events {
+			roundEvent, ok := event.(*common.ParsedRoundEvent)
+			if !ok {
+				return errUnexpectedEvent
+			}
+			roundEvents = append(roundEvents, *roundEvent)
+		}
+		return rds.Database.StoreRoundEvents(ctx, network, roundEvents)
+	})
+}
+
+// Stops streaming and persisting events
+func (rds *RedisEventStream) Close() {
+	rds.cancel()
+}
+
+var errUnexpectedEvent = errors.New("unexpected msg type")
+
+// streams events of eventType, storing them in batches and acknowledging a batch once store succeeds
+func (rds *RedisEventStream) persist(
+	network string,
+	eventType cmtpubsub.Query,
+	store func(ctx context.Context, events []interface{}) error,
+) error {
+	stream, err := streamForQuery(eventType)
+	if err != nil {
+		return err
+	}
+	batchSize := rds.batch.SizeFor(network)
+	outCh := make(chan StreamMessage, 2*batchSize)
+	inFlight := newInFlight()
+	if err := rds.streamRedisEvents(
 		network,
-		types.EventQueryNewRoundStep,
+		eventType,
 		outCh,
+		inFlight,
 	); err != nil {
 		return fmt.Errorf("failed to stream redis events %+v", err)
 	}
+	streamKey := common.StreamKey(network, stream)
+	var stored, batches atomic.Int64
+	go rds.reportStats(network, stream, &stored, &batches)
+	Batch(rds.ctx, outCh, batchSize, rds.batch.Interval, func(ctx context.Context, msgs []StreamMessage) {
+		var (
+			ids    = make([]string, 0, len(msgs))
+			events = make([]interface{}, 0, len(msgs))
+		)
+		for _, msg := range msgs {
+			ids = append(ids, msg.ID)
+			events = append(events, msg.Event)
+		}
+		delay := storeRetryDelay
+		for attempt := 1; ; attempt++ {
+			start := time.Now()
+			err := store(ctx, events)
+			metrics.DBInsertDuration.WithLabelValues(network, stream).Observe(time.Since(start).Seconds())
+			if err == nil {
+				break
+			}
+			log.Error().Err(err).Str("network", network).Str("event.type", stream).Int("events", len(msgs)).Int("attempt", attempt).Msg("failed to store events")
+			if attempt == storeAttempts {
+				// the messages stay pending, and are retried once they are reclaimed
+				inFlight.remove(ids...)
+				return
+			}
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-ctx.Done():
+				inFlight.remove(ids...)
+				return
+			}
+		}
+		rds.ack(ctx, streamKey, ids...)
+		inFlight.acked(ids...)
+		stored.Add(int64(len(msgs)))
+		metrics.EventsPersisted.WithLabelValues(network, stream).Add(float64(len(msgs)))
+		batches.Add(1)
+	})
+	return nil
+}
+
+// periodically records the number of events stored per second, and the number of events waiting to be stored
+func (rds *RedisEventStream) reportStats(
+	network string,
+	stream string,
+	stored *atomic.Int64,
+	batches *atomic.Int64,
+) {
+	streamKey := common.StreamKey(network, stream)
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	var (
+		lastLog    = time.Now()
+		lastSample = time.Now()
+		logged     int64
+		batchCount int64
+	)
 	for {
 		select {
-		case msg := <-outCh:
-			roundState, ok := msg.(*common.ParsedNewRoundStep)
-			if !ok {
-				log.Error().Msg("unexpected msg type")
-				continue
+		case <-rds.ctx.Done():
+			return
+		case now := <-ticker.C:
+			events := stored.Swap(0)
+			logged += events
+			batchCount += batches.Swap(0)
+			metrics.EventsPerSecond.WithLabelValues(network, stream).Set(float64(events) / now.Sub(lastSample).Seconds())
+			lastSample = now
+
+			info, err := rds.Streams.Info(rds.ctx, streamKey, rds.group)
+			if err != nil {
+				log.Error().Err(err).Str("stream", streamKey).Msg("failed to query stream info")
 			}
-			if err := rds.Database.StoreNewRoundStep(
-				rds.ctx,
-				network,
-				*roundState,
-			); err != nil {
-				log.Error().Err(err).Msg("failed to store round state")
+			lag, pending := info.Lag, info.Pending
+			metrics.StreamLength.WithLabelValues(network, stream).Set(float64(info.Length))
+			metrics.StreamLag.WithLabelValues(network, stream).Set(float64(lag))
+			metrics.StreamPending.WithLabelValues(network, stream).Set(float64(pending))
+
+			if now.Sub(lastLog) < statsInterval {
+				continue
 			}
-		case <-rds.ctx.Done():
-			return nil
+			log.Info().
+				Str("network", network).
+				Str("event.type", stream).
+				Float64("events.per.second", float64(logged)/now.Sub(lastLog).Seconds()).
+				Int64("batches", batchCount).
+				Int64("lag", lag).
+				Int64("pending", pending).
+				Msg("persistence stats")
+			lastLog, logged, batchCount = now, 0, 0
+		}
+	}
+}
+
+func streamForQuery(eventType cmtpubsub.Query) (string, error) {
+	if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"Vote"}}); ok {
+		return common.StreamVotes, nil
+	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewRound"}}); ok {
+		return common.StreamNewRound, nil
+	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewRoundStep"}}); ok {
+		return common.StreamNewRoundStep, nil
+	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"CompleteProposal"}}); ok {
+		return common.StreamCompleteProposal, nil
+	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewBlockHeader"}}); ok {
+		// headers and blocks share a stream
+		return common.StreamBlocks, nil
+	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewBlock"}}); ok {
+		return common.StreamBlocks, nil
+	}
+	for roundEventType, stream := range common.RoundEventStreams {
+		if ok, _ := eventType.Matches(map[string][]string{"tm.event": {roundEventType}}); ok {
+			return stream, nil
 		}
 	}
+	return "", fmt.Errorf("unsupported event %s", eventType)
 }
 
-// streams events from redis, inserting into database
+// streams events from redis through the consumer group, events sent to outCh must be acknowledged
+// once they have been persisted. Pending messages of this consumer are delivered first, followed
+// by new messages and messages reclaimed from other consumers
 func (rds *RedisEventStream) StreamRedisEvents(
 	network string,
 	eventType cmtpubsub.Query,
-	outCh chan interface{},
+	outCh chan<- StreamMessage,
 ) error {
-	var (
-		streamKey      string
-		isVote         bool
-		isNewRound     bool
-		isNewRoundStep bool
-	)
-	if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"Vote"}}); ok {
-		streamKey = ":votes"
-		isVote = true
+	return rds.streamRedisEvents(network, eventType, outCh, nil)
+}
 
-	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewRound"}}); ok {
-		streamKey = ":new_round"
-		isNewRound = true
-	} else if ok, _ := eventType.Matches(map[string][]string{"tm.event": {"NewRoundStep"}}); ok {
-		streamKey = ":new_round_step"
-		isNewRoundStep = true
-	} else {
-		return fmt.Errorf("unsupported event %s", eventType)
+// streams events as StreamRedisEvents. If inFlight is not nil, messages are added to it before they are sent to
+// outCh, and claimed messages which are still in flight are skipped, as claims return the pending messages of
+// this consumer as well once they have been idle for long enough
+func (rds *RedisEventStream) streamRedisEvents(
+	network string,
+	eventType cmtpubsub.Query,
+	outCh chan<- StreamMessage,
+	inFlight *inFlight,
+) error {
+	stream, err := streamForQuery(eventType)
+	if err != nil {
+		return err
+	}
+	streamKey := common.StreamKey(network, stream)
+	if err := rds.Streams.CreateGroup(rds.ctx, streamKey, rds.group); err != nil {
+		return err
 	}
 
 	go func() {
+		// "0" reads messages previously delivered to this consumer which were never acknowledged
+		lastID := "0"
+		lastClaim := time.Now()
 		for {
-			entries, err := rds.CredClient.Redis().XRead(
-				rds.ctx,
-				&redis.XReadArgs{
-					Streams: []string{network + streamKey, "0"},
-					Block:   0,
-				},
-			).Result()
+			if rds.ctx.Err() != nil {
+				return
+			}
+			var messages []cred.Message
+			if time.Since(lastClaim) >= rds.claimIdle {
+				lastClaim = time.Now()
+				inFlight.claiming()
+				claimed, err := rds.Streams.Claim(rds.ctx, streamKey, rds.group, rds.consumer, rds.claimIdle)
+				if err != nil && rds.ctx.Err() == nil {
+					log.Error().Err(err).Str("stream", streamKey).Msg("failed to claim pending messages")
+				}
+				messages = inFlight.claimed(claimed)
+			}
+			read, err := rds.Streams.ReadGroup(rds.ctx, streamKey, rds.group, rds.consumer, lastID, readCount, readBlock)
 			if err != nil {
-				log.Err(err).Str("event.type", streamKey[1:]).Msg("failed to read redis stream")
+				if rds.ctx.Err() == nil {
+					log.Err(err).Str("event.type", stream).Msg("failed to read redis stream")
+					time.Sleep(readBlock)
+				}
 				continue
 			}
-			select {
-			case <-rds.ctx.Done():
-				return
-			default:
-				for _, stream := range entries {
-					for _, message := range stream.Messages {
-						parts := strings.Split(message.ID, "-")
-						if len(parts) != 2 {
-							// improperly formatted id
-							continue
-						}
-						blockHeight, err := strconv.ParseInt(parts[0], 10, 64)
-						if err != nil {
-							continue
-						}
-						if isVote {
-							voteInfo, err := parseRedisValueToVote(blockHeight, message.Values)
-							if err != nil {
-								log.Error().Err(err).Str("event.type", streamKey[1:]).Msg("failed to parse redis value to vote object")
-								continue
-							}
-							outCh <- voteInfo
-						} else if isNewRound {
-							newRound, err := parseRedisValueToNewRound(blockHeight, message.Values)
-							if err != nil {
-								log.Error().Err(err).Str("event.type", streamKey[1:]).Msg("failed to parse redis value to new round object")
-								continue
-							}
-							outCh <- newRound
-						} else if isNewRoundStep {
-							roundState, err := parseRedisValueToRoundState(blockHeight, message.Values)
-							if err != nil {
-								log.Error().Err(err).Str("event.type", streamKey[1:]).Msg("failed to parse redis value to round state object")
-								continue
-							}
-							outCh <- roundState
-						} else {
-							log.Error().Str("event.type", streamKey).Msg("event type is neither vote, new_round, or new_round_step. this is unexpected")
-							continue
-						}
-						// clear out messages which we pulled from redis
-						if err := rds.CredClient.Redis().XDel(rds.ctx, network+streamKey, message.ID).Err(); err != nil {
-							log.Error().Err(err).Str("event.type", streamKey[1:]).Str("id", message.ID).Msg("failed to clear message from stream")
-						}
-					}
+			for _, message := range read {
+				if inFlight.add(message.ID) {
+					messages = append(messages, message)
+				}
+			}
+			// pending messages are read following the last one delivered, once all of them have been
+			// delivered switch to new messages
+			if lastID != ">" {
+				if len(read) == 0 {
+					lastID = ">"
+				} else {
+					lastID = read[len(read)-1].ID
+				}
+			}
+			for _, message := range messages {
+				event, err := parseRedisMessage(stream, message)
+				if err != nil {
+					// messages which can't be parsed will never succeed, so they are dropped
+					log.Error().Err(err).Str("event.type", stream).Str("id", message.ID).Msg("failed to parse redis message")
+					rds.ack(rds.ctx, streamKey, message.ID)
+					inFlight.acked(message.ID)
+					continue
+				}
+				select {
+				case outCh <- StreamMessage{ID: message.ID, Event: event}:
+				case <-rds.ctx.Done():
+					return
 				}
 			}
-
 		}
-
 	}()
 	return nil
 }
+
+// acknowledges messages, removing them from the stream
+func (rds *RedisEventStream) ack(ctx context.Context, streamKey string, ids ...string) {
+	if err := rds.Streams.Ack(ctx, streamKey, rds.group, ids...); err != nil {
+		log.Error().Err(err).Str("stream", streamKey).Strs("ids", ids).Msg("failed to acknowledge messages")
+	}
+}
+
+// ids of the messages of a stream which have been delivered to the batcher and are neither acknowledged nor
+// given up on yet. A nil inFlight tracks nothing
+type inFlight struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+	// ids acknowledged while a claim is running, which may still be returned by it
+	claimAcked map[string]struct{}
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{ids: make(map[string]struct{})}
+}
+
+// adds a message, returning false if it is already in flight
+func (f *inFlight) add(id string) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.ids[id]; ok {
+		return false
+	}
+	f.ids[id] = struct{}{}
+	return true
+}
+
+// removes messages which have been given up on, allowing them to be reclaimed
+func (f *inFlight) remove(ids ...string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.ids, id)
+	}
+}
+
+// removes messages which have been acknowledged
+func (f *inFlight) acked(ids ...string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.ids, id)
+		if f.claimAcked != nil {
+			f.claimAcked[id] = struct{}{}
+		}
+	}
+}
+
+// must be called before claiming messages, so that messages acknowledged while the claim runs are not delivered
+// again by claimed
+func (f *inFlight) claiming() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.claimAcked = make(map[string]struct{})
+}
+
+// adds the claimed messages which are neither in flight nor acknowledged since claiming was called, returning them
+func (f *inFlight) claimed(messages []cred.Message) []cred.Message {
+	if f == nil {
+		return messages
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	added := messages[:0]
+	for _, message := range messages {
+		_, inFlight := f.ids[message.ID]
+		_, acked := f.claimAcked[message.ID]
+		if !inFlight && !acked {
+			f.ids[message.ID] = struct{}{}
+			added = append(added, message)
+		}
+	}
+	f.claimAcked = nil
+	return added
+}
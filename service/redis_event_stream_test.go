@@ -0,0 +1,194 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisEventStreamEmbedded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	proposer := types.NewMockPV()
+	for height := int64(1); height <= 3; height++ {
+		require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: &types.Vote{
+			Type:             cmtproto.PrevoteType,
+			Height:           height,
+			Timestamp:        time.Now().UTC().Round(0),
+			ValidatorAddress: proposer.PrivKey.PubKey().Address(),
+			Signature:        []byte("signature"),
+		}}))
+		require.NoError(t, streams.StoreNewRound(ctx, "osmosis", types.EventDataNewRound{
+			Height:   height,
+			Step:     "RoundStepNewRound",
+			Proposer: types.ValidatorInfo{Address: proposer.PrivKey.PubKey().Address()},
+		}))
+		require.NoError(t, streams.StoreNewRoundStep(ctx, "osmosis", types.EventDataRoundState{
+			Height: height,
+			Step:   "RoundStepPropose",
+		}, time.Now()))
+	}
+
+	batch := service.DefaultBatchOptions()
+	batch.Interval = 10 * time.Millisecond
+	eventStream := service.NewRedisEventStreamWithStreams(ctx, streams, database, "ctop", "test", time.Minute, batch)
+	defer eventStream.Close()
+	go func() { _ = eventStream.PersistVoteEvents("osmosis") }()
+	go func() { _ = eventStream.PersistNewRoundEvents("osmosis") }()
+	go func() { _ = eventStream.PersistNewRoundStepEvents("osmosis") }()
+
+	require.Eventually(t, func() bool {
+		votes, err := database.GetVotes(ctx, "osmosis")
+		require.NoError(t, err)
+		rounds, err := database.GetNewRounds(ctx, "osmosis")
+		require.NoError(t, err)
+		steps, err := database.GetNewRoundSteps(ctx, "osmosis")
+		require.NoError(t, err)
+		return len(votes) == 3 && len(rounds) == 3 && len(steps) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	latest, err := database.GetLatestVotesForNetwork(ctx, "osmosis")
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	require.Equal(t, 3, latest[0].Height)
+
+	// persisted events are acknowledged and removed from the streams
+	require.Eventually(t, func() bool {
+		info, err := streams.Info(ctx, "osmosis:votes", "ctop")
+		require.NoError(t, err)
+		return info == cred.StreamInfo{}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisEventStreamPendingRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	defer database.Close()
+	require.NoError(t, database.CreateSchema(ctx))
+
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	require.NoError(t, streams.CreateGroup(ctx, "osmosis:votes", "ctop"))
+	validator := types.NewMockPV()
+	storeVote := func(height int64) {
+		require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: &types.Vote{
+			Type:             cmtproto.PrevoteType,
+			Height:           height,
+			Timestamp:        time.Now().UTC().Round(0),
+			ValidatorAddress: validator.PrivKey.PubKey().Address(),
+			Signature:        []byte("signature"),
+		}}))
+	}
+	for height := int64(1); height <= 3; height++ {
+		storeVote(height)
+	}
+	// messages delivered to the consumer before a restart, which were never acknowledged
+	pending, err := streams.ReadGroup(ctx, "osmosis:votes", "ctop", "test", ">", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	for height := int64(4); height <= 5; height++ {
+		storeVote(height)
+	}
+
+	batch := service.DefaultBatchOptions()
+	// pending messages must not be delivered again while their batch is waiting to be stored
+	batch.Interval = 200 * time.Millisecond
+	eventStream := service.NewRedisEventStreamWithStreams(ctx, streams, database, "ctop", "test", time.Minute, batch)
+	defer eventStream.Close()
+	go func() { _ = eventStream.PersistVoteEvents("osmosis") }()
+
+	require.Eventually(t, func() bool {
+		info, err := streams.Info(ctx, "osmosis:votes", "ctop")
+		require.NoError(t, err)
+		return info == cred.StreamInfo{}
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * batch.Interval)
+	votes, err := database.GetVotes(ctx, "osmosis")
+	require.NoError(t, err)
+	require.Len(t, votes, 5)
+}
+
+// fails to store the first failures batches of votes
+type failingStore struct {
+	*db.Database
+	failures atomic.Int32
+}
+
+func (fs *failingStore) StoreVotes(ctx context.Context, network string, votes []common.ParsedVote) error {
+	if fs.failures.Add(-1) >= 0 {
+		return errors.New("connection reset")
+	}
+	return fs.Database.StoreVotes(ctx, network, votes)
+}
+
+func TestRedisEventStreamRetry(t *testing.T) {
+	for name, test := range map[string]struct {
+		claimIdle     time.Duration
+		batchInterval time.Duration
+		failures      int32
+	}{
+		// failed batches are retried without waiting for their messages to be reclaimed
+		"retry before claim": {time.Minute, 10 * time.Millisecond, 1},
+		// messages waiting for their batch are not delivered again by claims
+		"claims while batched": {10 * time.Millisecond, 1500 * time.Millisecond, 0},
+		// nor are messages of a batch being retried
+		"claims while retried": {10 * time.Millisecond, 10 * time.Millisecond, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			database, err := db.NewSQLite(":memory:")
+			require.NoError(t, err)
+			defer database.Close()
+			require.NoError(t, database.CreateSchema(ctx))
+
+			streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+			validator := types.NewMockPV()
+			for height := int64(1); height <= 3; height++ {
+				require.NoError(t, streams.StoreVote(ctx, "osmosis", types.EventDataVote{Vote: &types.Vote{
+					Type:             cmtproto.PrevoteType,
+					Height:           height,
+					Timestamp:        time.Now().UTC().Round(0),
+					ValidatorAddress: validator.PrivKey.PubKey().Address(),
+					Signature:        []byte("signature"),
+				}}))
+			}
+
+			batch := service.DefaultBatchOptions()
+			batch.Interval = test.batchInterval
+			store := &failingStore{Database: database}
+			store.failures.Store(test.failures)
+			eventStream := service.NewRedisEventStreamWithStreams(ctx, streams, store, "ctop", "test", test.claimIdle, batch)
+			defer eventStream.Close()
+			go func() { _ = eventStream.PersistVoteEvents("osmosis") }()
+
+			require.Eventually(t, func() bool {
+				info, err := streams.Info(ctx, "osmosis:votes", "ctop")
+				require.NoError(t, err)
+				return info == cred.StreamInfo{}
+			}, 10*time.Second, 10*time.Millisecond)
+			require.Negative(t, store.failures.Load())
+			time.Sleep(2 * test.batchInterval)
+			votes, err := database.GetVotes(ctx, "osmosis")
+			require.NoError(t, err)
+			require.Len(t, votes, 3)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/recording"
+	"github.com/rs/zerolog/log"
+)
+
+// Replayer stores the events of a recording in streams as the event subscription service would have, deduplicating
+// events received from several endpoints of a network. Events are stored in the streams of their network prefixed
+// by prefix, which allows replaying a recording of a network which is also followed live
+type Replayer struct {
+	Streams cred.Streams
+	// factor by which the recording is sped up, 0 replays events as fast as possible
+	speed float64
+	// prepended to the networks of the recording
+	prefix string
+	// network -> deduplicator of the network
+	dedups map[string]*Deduplicator
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewReplayer(
+	ctx context.Context,
+	streams cred.Streams,
+	speed float64,
+	prefix string,
+) *Replayer {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Replayer{
+		Streams: streams,
+		speed:   speed,
+		prefix:  prefix,
+		dedups:  make(map[string]*Deduplicator),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Replays the events of the recording, waiting between events for the time that passed between receiving them
+// divided by the speed. Returns the number of events stored
+func (r *Replayer) Replay(reader *recording.Reader) (int, error) {
+	var (
+		stored    int
+		firstTime time.Time
+		start     = time.Now()
+	)
+	for {
+		event, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return stored, nil
+		}
+		if err != nil {
+			return stored, err
+		}
+		event.Network = r.prefix + event.Network
+		if _, ok := r.dedups[event.Network]; !ok {
+			if err := r.checkStreams(event); err != nil {
+				return stored, err
+			}
+		}
+		if firstTime.IsZero() {
+			firstTime = event.Time
+		}
+		if r.speed > 0 {
+			offset := time.Duration(float64(event.Time.Sub(firstTime)) / r.speed)
+			select {
+			case <-r.ctx.Done():
+				return stored, r.ctx.Err()
+			case <-time.After(time.Until(start.Add(offset))):
+			}
+		} else if r.ctx.Err() != nil {
+			return stored, r.ctx.Err()
+		}
+		ok, err := r.store(event)
+		if err != nil {
+			// streams reject events older than the newest event, which happens when endpoints of a network lag
+			// behind each other
+			log.Error().Err(err).Str("network", event.Network).Str("url", event.URL).Msg("failed to store event")
+			continue
+		}
+		if ok {
+			stored++
+		}
+	}
+}
+
+// returns an error if a stream of the network of the first event of the network already holds later heights,
+// in which case the streams would reject every event of the recording
+func (r *Replayer) checkStreams(event recording.Event) error {
+	height, ok := eventHeight(event.Data)
+	if !ok {
+		return nil
+	}
+	streams := []string{
+		common.StreamVotes,
+		common.StreamNewRound,
+		common.StreamNewRoundStep,
+		common.StreamCompleteProposal,
+		common.StreamBlocks,
+	}
+	for _, stream := range common.RoundEventStreams {
+		streams = append(streams, stream)
+	}
+	for _, stream := range streams {
+		key := common.StreamKey(event.Network, stream)
+		lastID, err := r.Streams.LastID(r.ctx, key)
+		if err != nil {
+			return err
+		}
+		lastHeight, _, _ := strings.Cut(lastID, "-")
+		if last, err := strconv.ParseInt(lastHeight, 10, 64); err == nil && last > height {
+			return fmt.Errorf(
+				"stream %s already holds height %d, past height %d of the recording, replay into another network with a prefix",
+				key, last, height,
+			)
+		}
+	}
+	return nil
+}
+
+// returns the height of an event of a recording
+func eventHeight(data interface{}) (int64, bool) {
+	switch data := data.(type) {
+	case types.EventDataVote:
+		if data.Vote == nil {
+			return 0, false
+		}
+		return data.Vote.Height, true
+	case types.EventDataNewRound:
+		return data.Height, true
+	case types.EventDataRoundState:
+		return data.Height, true
+	case types.EventDataCompleteProposal:
+		return data.Height, true
+	case types.EventDataNewBlockHeader:
+		return data.Header.Height, true
+	case types.EventDataNewBlock:
+		if data.Block == nil {
+			return 0, false
+		}
+		return data.Block.Height, true
+	default:
+		return 0, false
+	}
+}
+
+// Stops replaying
+func (r *Replayer) Close() {
+	r.cancel()
+}
+
+// stores an event, returning false if it is a duplicate
+func (r *Replayer) store(event recording.Event) (bool, error) {
+	dedup, ok := r.dedups[event.Network]
+	if !ok {
+		dedup = NewDeduplicator(dedupWindow)
+		r.dedups[event.Network] = dedup
+	}
+	switch data := event.Data.(type) {
+	case types.EventDataVote:
+		if !dedup.Vote(data) {
+			return false, nil
+		}
+		return true, r.Streams.StoreVote(r.ctx, event.Network, data)
+	case types.EventDataNewRound:
+		if !dedup.NewRound(data) {
+			return false, nil
+		}
+		return true, r.Streams.StoreNewRound(r.ctx, event.Network, data)
+	case types.EventDataRoundState:
+		if event.Type != "" && event.Type != types.EventNewRoundStep {
+			if _, ok := common.RoundEventStreams[event.Type]; !ok {
+				return false, fmt.Errorf("unsupported round state event %s", event.Type)
+			}
+			if !dedup.RoundEvent(event.Type, data) {
+				return false, nil
+			}
+			return true, r.Streams.StoreRoundEvent(r.ctx, event.Network, event.Type, data, event.Time)
+		}
+		if !dedup.NewRoundStep(data) {
+			return false, nil
+		}
+		return true, r.Streams.StoreNewRoundStep(r.ctx, event.Network, data, event.Time)
+	case types.EventDataCompleteProposal:
+		if !dedup.CompleteProposal(data) {
+			return false, nil
+		}
+		return true, r.Streams.StoreCompleteProposal(r.ctx, event.Network, data, event.Time)
+	case types.EventDataNewBlockHeader:
+		if !dedup.Block(data.Header.Height) {
+			return false, nil
+		}
+		return true, r.Streams.StoreNewBlockHeader(r.ctx, event.Network, data)
+	case types.EventDataNewBlock:
+		if data.Block == nil {
+			return false, fmt.Errorf("block is nil")
+		}
+		if !dedup.Block(data.Block.Height) {
+			return false, nil
+		}
+		return true, r.Streams.StoreNewBlock(r.ctx, event.Network, data)
+	default:
+		return false, fmt.Errorf("unsupported event %T", event.Data)
+	}
+}
@@ -4,16 +4,28 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/rangesecurity/ctop/common"
 	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/metrics"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// number of heights events are deduplicated across
+	dedupWindow = 100
+	// interval at which the fill level of subscription channels is sampled
+	channelFillInterval = 5 * time.Second
+)
+
 type Service struct {
-	CredClient *cred.CredClient
+	Streams    cred.Streams
 	connectors []*Connector
-	ctx        context.Context
-	cancel     context.CancelFunc
+	// network -> deduplicator shared by all connectors of the network
+	dedups map[string]*Deduplicator
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	wg sync.WaitGroup
 
@@ -24,27 +36,56 @@ func NewService(
 	ctx context.Context,
 	redisUrl string,
 	unsafe bool,
-	// network_name -> rpc_url
-	endpoints map[string]string,
+	// network_name -> rpc_urls
+	endpoints map[string][]string,
+	opts ConnectorOptions,
 ) (*Service, error) {
-	ctx, cancel := context.WithCancel(ctx)
 	cc, err := cred.New(ctx, redisUrl, unsafe)
+	if err != nil {
+		return nil, err
+	}
+	return NewServiceWithStreams(ctx, cc, endpoints, opts)
+}
+
+// Creates a service storing events in existing streams, allowing the redis connection pool, or in memory
+// streams, to be shared
+func NewServiceWithStreams(
+	ctx context.Context,
+	streams cred.Streams,
+	// network_name -> rpc_urls
+	endpoints map[string][]string,
+	opts ConnectorOptions,
+) (*Service, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	connectors, err := connectAll(ctx, endpoints, opts)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
-	connectors := make([]*Connector, 0, len(endpoints))
+	dedups := make(map[string]*Deduplicator, len(endpoints))
+	for network := range endpoints {
+		dedups[network] = NewDeduplicator(dedupWindow)
+	}
+	return &Service{Streams: streams, connectors: connectors, dedups: dedups, ctx: ctx, cancel: cancel, wg: sync.WaitGroup{}}, nil
+}
 
-	for network, url := range endpoints {
-		connector, err := NewConnector(ctx, network, url)
-		if err != nil {
-			cancel()
-			return nil, err
+// creates a connector for every endpoint of every network. Endpoints which can't be reached are connected in the
+// background once they come up, only invalid urls are an error
+func connectAll(ctx context.Context, endpoints map[string][]string, opts ConnectorOptions) ([]*Connector, error) {
+	connectors := make([]*Connector, 0, len(endpoints))
+	for network, urls := range endpoints {
+		for _, url := range urls {
+			connector, err := NewConnector(ctx, network, url, opts)
+			if err != nil {
+				for _, connector := range connectors {
+					connector.Close()
+				}
+				return nil, fmt.Errorf("failed to create connector for %s endpoint %s %+v", network, url, err)
+			}
+			connectors = append(connectors, connector)
 		}
-		connectors = append(connectors, connector)
 	}
-
-	return &Service{CredClient: cc, connectors: connectors, ctx: ctx, cancel: cancel, wg: sync.WaitGroup{}}, nil
+	return connectors, nil
 }
 
 // starts all connectors and listens to incoming events
@@ -59,12 +100,20 @@ func (s *Service) StartEventSubscriptions() error {
 		go func(connector *Connector) {
 			defer s.wg.Done()
 			network := connector.Network()
+			dedup := s.dedups[network]
 			for {
 				select {
 				case <-s.ctx.Done():
 					return
 				case voteInfo := <-connector.GetVotes():
-					if err := s.CredClient.StoreVote(
+					if !dedup.Vote(voteInfo) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamVotes).Inc()
+					metrics.ValidatorLastVotedHeight.WithLabelValues(
+						network, voteInfo.Vote.ValidatorAddress.String(),
+					).Set(float64(voteInfo.Vote.Height))
+					if err := s.Streams.StoreVote(
 						s.ctx,
 						network,
 						voteInfo,
@@ -78,12 +127,17 @@ func (s *Service) StartEventSubscriptions() error {
 		go func(connector *Connector) {
 			defer s.wg.Done()
 			network := connector.Network()
+			dedup := s.dedups[network]
 			for {
 				select {
 				case <-s.ctx.Done():
 					return
 				case roundInfo := <-connector.GetNewRounds():
-					if err := s.CredClient.StoreNewRound(
+					if !dedup.NewRound(roundInfo) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamNewRound).Inc()
+					if err := s.Streams.StoreNewRound(
 						s.ctx,
 						network,
 						roundInfo,
@@ -97,28 +151,155 @@ func (s *Service) StartEventSubscriptions() error {
 		go func(connector *Connector) {
 			defer s.wg.Done()
 			network := connector.Network()
+			dedup := s.dedups[network]
 			for {
 				select {
 				case <-s.ctx.Done():
 					return
 
-				case roundStep := <-connector.GetNewRoundSteps():
-					if err := s.CredClient.StoreNewRoundStep(
+				case received := <-connector.GetNewRoundSteps():
+					roundStep := received.Data
+					if !dedup.NewRoundStep(roundStep) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamNewRoundStep).Inc()
+					metrics.ObserveStep(network, roundStep.Height, roundStep.Round, roundStep.Step, received.ReceivedAt)
+					if err := s.Streams.StoreNewRoundStep(
 						s.ctx,
 						network,
 						roundStep,
+						received.ReceivedAt,
 					); err != nil {
 						log.Error().Err(err).Msg("failed to store round step")
 					}
 				}
 			}
 		}(connector)
+		s.wg.Add(1)
+		go func(connector *Connector) {
+			defer s.wg.Done()
+			network := connector.Network()
+			dedup := s.dedups[network]
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case received := <-connector.GetCompleteProposals():
+					if !dedup.CompleteProposal(received.Data) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamCompleteProposal).Inc()
+					if err := s.Streams.StoreCompleteProposal(
+						s.ctx,
+						network,
+						received.Data,
+						received.ReceivedAt,
+					); err != nil {
+						log.Error().Err(err).Msg("failed to store complete proposal")
+					}
+				}
+			}
+		}(connector)
+		s.wg.Add(1)
+		go func(connector *Connector) {
+			defer s.wg.Done()
+			network := connector.Network()
+			dedup := s.dedups[network]
+			for {
+				var err error
+				select {
+				case <-s.ctx.Done():
+					return
+				case headerInfo := <-connector.GetNewBlockHeaders():
+					if !dedup.Block(headerInfo.Header.Height) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamBlocks).Inc()
+					err = s.Streams.StoreNewBlockHeader(s.ctx, network, headerInfo)
+				case blockInfo := <-connector.GetNewBlocks():
+					if blockInfo.Block == nil || !dedup.Block(blockInfo.Block.Height) {
+						continue
+					}
+					metrics.EventsReceived.WithLabelValues(network, common.StreamBlocks).Inc()
+					err = s.Streams.StoreNewBlock(s.ctx, network, blockInfo)
+				}
+				if err != nil {
+					log.Error().Err(err).Msg("failed to store block")
+				}
+			}
+		}(connector)
+		for _, eventType := range common.RoundEventTypes {
+			s.wg.Add(1)
+			go func(connector *Connector, eventType string) {
+				defer s.wg.Done()
+				network := connector.Network()
+				dedup := s.dedups[network]
+				for {
+					select {
+					case <-s.ctx.Done():
+						return
+					case received := <-connector.GetRoundEvents(eventType):
+						if !dedup.RoundEvent(eventType, received.Data) {
+							continue
+						}
+						metrics.EventsReceived.WithLabelValues(network, common.RoundEventStreams[eventType]).Inc()
+						if err := s.Streams.StoreRoundEvent(
+							s.ctx,
+							network,
+							eventType,
+							received.Data,
+							received.ReceivedAt,
+						); err != nil {
+							log.Error().Err(err).Str("event.type", eventType).Msg("failed to store round event")
+						}
+					}
+				}
+			}(connector, eventType)
+		}
+		s.wg.Add(1)
+		go func(connector *Connector) {
+			defer s.wg.Done()
+			s.sampleChannelFill(connector)
+		}(connector)
 	}
 	return nil
 }
 
+// periodically records how full the event channels of a connector are
+func (s *Service) sampleChannelFill(connector *Connector) {
+	ticker := time.NewTicker(channelFillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			for stream, fill := range connector.ChannelFill() {
+				metrics.SubscriptionFill.WithLabelValues(connector.Network(), connector.URL(), stream).Set(fill)
+			}
+		}
+	}
+}
+
+// Returns the websocket connection state of each endpoint, keyed by network and url
+func (s *Service) ConnectionStates() map[string]map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+	states := make(map[string]map[string]string, len(s.dedups))
+	for _, connector := range s.connectors {
+		if states[connector.Network()] == nil {
+			states[connector.Network()] = make(map[string]string)
+		}
+		states[connector.Network()][connector.URL()] = connector.State().String()
+	}
+	return states
+}
+
 func (s *Service) Close() {
 	s.cancel()
 	// wait for shutdown to complete
 	s.wg.Wait()
+	for _, connector := range s.connectors {
+		connector.Close()
+	}
 }
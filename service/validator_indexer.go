@@ -2,68 +2,281 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/cometbft/cometbft/types"
 	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/identity"
+	"github.com/rangesecurity/ctop/metrics"
+	"github.com/rangesecurity/ctop/wsclient"
 	"github.com/rs/zerolog/log"
 )
 
-// Periodically indexes
+const (
+	// validator updates returned by the application for a block take effect this many blocks later
+	validatorUpdateDelay = 2
+	// interval at which the identities registered with the staking module are refreshed
+	identityRefreshInterval = 10 * time.Minute
+)
+
+// Indexes the validator set of each network, applying the validator updates of NewBlock events as they are published and
+// periodically reconciling the stored set with the set returned by the rpc endpoints
 type ValidatorIndexer struct {
-	connectors []*Connector
-	db         *db.Database
-	ctx        context.Context
-	cancel     context.CancelFunc
+	// network -> clients of the network, queried in order until one succeeds
+	clients map[string][]*wsclient.WsClient
+	// network -> configured identities, taking precedence over the registered identities
+	overrides map[string][]identity.Identity
+	db        db.Store
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
+// Connects to every endpoint of every network, endpoints which can't be reached, or which serve another chain than
+// the one given in chainIDs, are skipped as long as at least one endpoint of the network is reachable. Overrides
+// are merged into the validator identities fetched from the staking module, and are the only identities stored
+// for networks without one
 func NewValidatorIndexer(
 	ctx context.Context,
-	db *db.Database,
-	endpoints map[string]string,
+	db db.Store,
+	endpoints map[string][]string,
+	chainIDs map[string]string,
+	overrides map[string][]identity.Identity,
 ) (*ValidatorIndexer, error) {
 	ctx, cancel := context.WithCancel(ctx)
-	connectors := make([]*Connector, 0, len(endpoints))
-
-	for network, url := range endpoints {
-		connector, err := NewConnector(ctx, network, url)
-		if err != nil {
-			cancel()
-			return nil, err
-		}
-		connectors = append(connectors, connector)
-	}
-	return &ValidatorIndexer{
-		connectors,
+	vi := &ValidatorIndexer{
+		make(map[string][]*wsclient.WsClient, len(endpoints)),
+		overrides,
 		db,
 		ctx,
 		cancel,
-	}, nil
+	}
+	for network, urls := range endpoints {
+		for _, url := range urls {
+			opts := wsclient.DefaultOptions()
+			opts.ChainID = chainIDs[network]
+			client, err := wsclient.NewClientWithOptions(url, opts)
+			if err != nil {
+				log.Error().Err(err).Str("network", network).Str("url", url).Msg("failed to connect to endpoint")
+				continue
+			}
+			vi.clients[network] = append(vi.clients[network], client)
+		}
+		if len(vi.clients[network]) == 0 {
+			vi.Close()
+			return nil, fmt.Errorf("failed to connect to any endpoint of %s", network)
+		}
+	}
+	return vi, nil
 }
 
+// Subscribes to new blocks of every endpoint, applying the validator updates they return, and reconciles the
+// validator set of each network every pollFrequencies[network], or every pollFrequency for networks without one.
+// Validator identities are refreshed on start and every identityRefreshInterval. Blocks until the indexer is
+// closed or its context is cancelled
 func (vi *ValidatorIndexer) Start(
 	pollFrequency time.Duration,
+	pollFrequencies map[string]time.Duration,
 ) {
-	ticker := time.NewTicker(pollFrequency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer vi.Close()
+	for network, clients := range vi.clients {
+		for _, client := range clients {
+			blocks, err := client.SubscribeNewBlock(vi.ctx)
+			if err != nil {
+				log.Error().Err(err).Str("network", network).Str("url", client.URL()).Msg("failed to subscribe to new blocks")
+				continue
+			}
+			wg.Add(1)
+			go func(network string, client *wsclient.WsClient) {
+				defer wg.Done()
+				for {
+					select {
+					case <-vi.ctx.Done():
+						return
+					case msg, ok := <-blocks:
+						if !ok {
+							return
+						}
+						if event, ok := msg.Data.(types.EventDataNewBlock); ok && event.Block != nil &&
+							len(event.ResultFinalizeBlock.ValidatorUpdates) > 0 {
+							vi.applyUpdates(network, event)
+						}
+					}
+				}
+			}(network, client)
+		}
+	}
+	for network, clients := range vi.clients {
+		vi.refreshIdentities(network, clients)
+	}
+	for network, clients := range vi.clients {
+		frequency, ok := pollFrequencies[network]
+		if !ok || frequency <= 0 {
+			frequency = pollFrequency
+		}
+		wg.Add(1)
+		go func(network string, clients []*wsclient.WsClient) {
+			defer wg.Done()
+			ticker := time.NewTicker(frequency)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-vi.ctx.Done():
+					return
+				case <-ticker.C:
+					vi.reconcile(network, clients)
+				}
+			}
+		}(network, clients)
+	}
+	identityTicker := time.NewTicker(identityRefreshInterval)
+	defer identityTicker.Stop()
 	for {
 		select {
 		case <-vi.ctx.Done():
 			return
-		case <-ticker.C:
-			for _, connector := range vi.connectors {
-				valis, err := connector.Validators()
-				if err != nil {
-					log.Error().Err(err).Str("network", connector.Network()).Msg("failed to fetch validators")
-				}
-				data := make(map[string]interface{})
-				for _, vali := range valis {
-					data[vali.Address.String()] = struct{}{}
-				}
-				if err := vi.db.StoreOrUpdateValidators(
-					vi.ctx, connector.Network(), data,
-				); err != nil {
-					log.Error().Err(err).Str("network", connector.Network()).Msg("failed to store validator")
-				}
+		case <-identityTicker.C:
+			for network, clients := range vi.clients {
+				vi.refreshIdentities(network, clients)
 			}
 		}
 	}
 }
+
+// Stops the indexer, closing the connections to all endpoints
+func (vi *ValidatorIndexer) Close() {
+	vi.cancel()
+	for _, clients := range vi.clients {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+}
+
+// applies the validator updates returned by the application for a block, which take effect validatorUpdateDelay
+// blocks later. Every endpoint of a network publishes the same updates, applying them again is a no-op
+func (vi *ValidatorIndexer) applyUpdates(network string, event types.EventDataNewBlock) {
+	valis, err := types.PB2TM.ValidatorUpdates(event.ResultFinalizeBlock.ValidatorUpdates)
+	if err != nil {
+		log.Error().Err(err).Str("network", network).Int64("height", event.Block.Height).Msg("failed to decode validator updates")
+		return
+	}
+	updates := make(map[string]db.ValidatorInfo, len(valis))
+	for _, vali := range valis {
+		updates[vali.Address.String()] = db.ValidatorInfo{
+			VotingPower: vali.VotingPower,
+			PubKey:      encodePubKey(vali),
+		}
+	}
+	if err := vi.db.ApplyValidatorUpdates(vi.ctx, network, event.Block.Height+validatorUpdateDelay, updates); err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to apply validator updates")
+		return
+	}
+	vi.setVotingPower(network)
+}
+
+// replaces the stored validator set with the set returned by the first endpoint which responds
+func (vi *ValidatorIndexer) reconcile(network string, clients []*wsclient.WsClient) {
+	height, valis, err := fetchValidators(vi.ctx, clients)
+	if err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to fetch validators")
+		return
+	}
+	data := make(map[string]interface{})
+	for _, vali := range valis {
+		data[vali.Address.String()] = db.ValidatorInfo{
+			VotingPower:      vali.VotingPower,
+			ProposerPriority: vali.ProposerPriority,
+			PubKey:           encodePubKey(vali),
+		}
+	}
+	if err := vi.db.StoreOrUpdateValidators(
+		vi.ctx, network, height, data,
+	); err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to store validator")
+		return
+	}
+	vi.setVotingPower(network)
+}
+
+// replaces the stored identities with the identities registered with the staking module, merged with the
+// configured overrides. If the staking module can't be queried the stored identities are kept, so networks
+// without a staking module only store the overrides
+func (vi *ValidatorIndexer) refreshIdentities(network string, clients []*wsclient.WsClient) {
+	identities, err := fetchIdentities(vi.ctx, clients)
+	if err != nil {
+		if vi.ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Str("network", network).Msg("failed to fetch validator identities")
+		stored, err := vi.db.GetValidatorIdentities(vi.ctx, network)
+		if err != nil {
+			log.Error().Err(err).Str("network", network).Msg("failed to get validator identities")
+			return
+		}
+		for _, model := range stored {
+			identities = append(identities, identity.FromModel(model))
+		}
+	}
+	merged := identity.Merge(identities, vi.overrides[network])
+	models := make([]db.ValidatorIdentity, 0, len(merged))
+	for _, validator := range merged {
+		models = append(models, validator.Model())
+	}
+	if err := vi.db.StoreValidatorIdentities(vi.ctx, network, models); err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to store validator identities")
+	}
+}
+
+// exports the voting power of the stored set, which may be newer than the set it was last updated with
+func (vi *ValidatorIndexer) setVotingPower(network string) {
+	validators, err := vi.db.GetValidators(vi.ctx, network)
+	if err != nil {
+		log.Error().Err(err).Str("network", network).Msg("failed to get validators")
+		return
+	}
+	power := make(map[string]int64, len(validators.Data))
+	for address, info := range validators.Info() {
+		power[address] = info.VotingPower
+	}
+	metrics.SetVotingPower(network, power)
+}
+
+// fetches validators from the first client which responds
+func fetchValidators(ctx context.Context, clients []*wsclient.WsClient) (int64, []*types.Validator, error) {
+	var errs []error
+	for _, client := range clients {
+		height, valis, err := client.ValidatorSet(ctx)
+		if err == nil {
+			return height, valis, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", client.URL(), err))
+	}
+	return 0, nil, errors.Join(errs...)
+}
+
+// fetches the identities registered with the staking module from the first client which responds
+func fetchIdentities(ctx context.Context, clients []*wsclient.WsClient) ([]identity.Identity, error) {
+	var errs []error
+	for _, client := range clients {
+		identities, err := identity.FetchValidators(ctx, client)
+		if err == nil {
+			return identities, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", client.URL(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// returns the base64 encoded public key of a validator, or an empty string if it is unknown
+func encodePubKey(vali *types.Validator) string {
+	if vali.PubKey == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(vali.PubKey.Bytes())
+}
@@ -0,0 +1,2 @@
+// Package simulator generates consensus events of a simulated network with injected faults, for testing analyzers
+package simulator
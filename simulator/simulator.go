@@ -0,0 +1,326 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+	"github.com/rangesecurity/ctop/testutil"
+	"github.com/rs/zerolog/log"
+)
+
+// Sink receives the simulated events, cred.Streams is a sink
+type Sink interface {
+	StoreVote(ctx context.Context, network string, voteInfo types.EventDataVote) error
+	StoreNewRound(ctx context.Context, network string, roundInfo types.EventDataNewRound) error
+	StoreNewRoundStep(ctx context.Context, network string, roundInfo types.EventDataRoundState, receivedAt time.Time) error
+}
+
+// Partition cuts validators off from the node the events are observed from, starting at a height
+type Partition struct {
+	// indexes of the validators which are cut off
+	Validators []int
+	// height at which the partition occurs
+	Height int64
+	// number of rounds the partition lasts before the network heals. If the partitioned validators hold
+	// at least 1/3 of the voting power the network halts for these rounds
+	Rounds int
+}
+
+// Faults injected into the simulated network, validators are identified by their index in the validator set
+type Faults struct {
+	// validators which never vote or propose
+	Offline []int
+	// validators whose proposals arrive after the propose timeout, failing the rounds they propose
+	SlowProposers []int
+	// validators which sign a conflicting prevote at every height
+	DoubleSigners []int
+	// partitions applied in order of their height
+	Partitions []Partition
+}
+
+type Config struct {
+	Network     string
+	Validators  int
+	VotingPower int64
+	// first height simulated
+	StartHeight int64
+	// duration of a height committed in its first round, zero publishes events as fast as possible
+	BlockTime time.Duration
+	// duration validators wait for a proposal before prevoting nil
+	TimeoutPropose time.Duration
+	Faults         Faults
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Network:        "simnet",
+		Validators:     10,
+		VotingPower:    10,
+		StartHeight:    1,
+		BlockTime:      time.Second,
+		TimeoutPropose: 3 * time.Second,
+	}
+}
+
+// Simulator generates the consensus events of a network observed from a single node, with votes signed by
+// types.MockPV validators. Proposers rotate as they do in cometbft, rounds fail and escalate when the proposal
+// is missing or less than 2/3 of the voting power is online
+type Simulator struct {
+	cfg      Config
+	sink     Sink
+	set      *types.ValidatorSet
+	privVals []types.PrivValidator
+	// next height to simulate
+	height int64
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewSimulator(
+	ctx context.Context,
+	sink Sink,
+	cfg Config,
+) (*Simulator, error) {
+	if cfg.Validators <= 0 {
+		return nil, fmt.Errorf("invalid number of validators %d", cfg.Validators)
+	}
+	if cfg.StartHeight <= 0 {
+		return nil, fmt.Errorf("invalid start height %d", cfg.StartHeight)
+	}
+	faulty := append(append(append([]int{}, cfg.Faults.Offline...), cfg.Faults.SlowProposers...), cfg.Faults.DoubleSigners...)
+	for _, partition := range cfg.Faults.Partitions {
+		faulty = append(faulty, partition.Validators...)
+	}
+	for _, index := range faulty {
+		if index < 0 || index >= cfg.Validators {
+			return nil, fmt.Errorf("invalid validator index %d, the set has %d validators", index, cfg.Validators)
+		}
+	}
+	set, privVals := testutil.NewValidatorSet(cfg.Validators, cfg.VotingPower)
+	ctx, cancel := context.WithCancel(ctx)
+	return &Simulator{
+		cfg:      cfg,
+		sink:     sink,
+		set:      set,
+		privVals: privVals,
+		height:   cfg.StartHeight,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Returns the validator set of the simulated network
+func (s *Simulator) Validators() []*types.Validator {
+	return s.set.Copy().Validators
+}
+
+// Simulates heights following the last simulated height, or until the context is cancelled if heights is 0.
+// A height which fails is simulated again by the next call
+func (s *Simulator) Run(heights int64) error {
+	for end := s.height + heights; heights == 0 || s.height < end; s.height++ {
+		if err := s.simulateHeight(s.height); err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the next height to simulate
+func (s *Simulator) Height() int64 {
+	return s.height
+}
+
+// Stops the simulation
+func (s *Simulator) Close() {
+	s.cancel()
+}
+
+// simulates rounds of a height until one of them commits
+func (s *Simulator) simulateHeight(height int64) error {
+	if err := s.step(height, 0, "RoundStepNewHeight"); err != nil {
+		return err
+	}
+	for round := int32(0); ; round++ {
+		committed, err := s.simulateRound(height, round)
+		if err != nil {
+			return err
+		}
+		if committed {
+			// the proposer priorities of the next height advance once from those of this height, regardless of
+			// the round the block was committed in
+			s.set.IncrementProposerPriority(1)
+			return nil
+		}
+		if round > 0 && round%10 == 0 {
+			log.Warn().Str("network", s.cfg.Network).Int64("height", height).Int32("round", round).Msg("simulated network is halted")
+		}
+	}
+}
+
+// simulates a round, returning true if the block was committed
+func (s *Simulator) simulateRound(height int64, round int32) (bool, error) {
+	proposerIndex, proposer := s.set.GetByAddress(s.proposer(round).Address)
+	if err := s.sink.StoreNewRound(s.ctx, s.cfg.Network, types.EventDataNewRound{
+		Height:   height,
+		Round:    round,
+		Step:     "RoundStepNewRound",
+		Proposer: types.ValidatorInfo{Address: proposer.Address, Index: proposerIndex},
+	}); err != nil {
+		return false, err
+	}
+	if err := s.step(height, round, "RoundStepNewRound"); err != nil {
+		return false, err
+	}
+	if err := s.step(height, round, "RoundStepPropose"); err != nil {
+		return false, err
+	}
+
+	// validators visible to the observed node
+	visible := make([]int, 0, len(s.privVals))
+	var visiblePower int64
+	for index := range s.privVals {
+		if s.isOffline(index) || s.isPartitioned(index, height, round) {
+			continue
+		}
+		visible = append(visible, index)
+		visiblePower += s.set.Validators[index].VotingPower
+	}
+	proposed := !s.isOffline(int(proposerIndex)) &&
+		!s.isPartitioned(int(proposerIndex), height, round) &&
+		!slices.Contains(s.cfg.Faults.SlowProposers, int(proposerIndex))
+	committed := proposed && visiblePower*3 > s.set.TotalVotingPower()*2
+
+	blockID := types.BlockID{}
+	if proposed {
+		blockID = simulatedBlockID(height, round, 0)
+		if err := s.wait(s.cfg.BlockTime / 4); err != nil {
+			return false, err
+		}
+	} else if err := s.wait(s.cfg.TimeoutPropose); err != nil {
+		return false, err
+	}
+
+	if err := s.step(height, round, "RoundStepPrevote"); err != nil {
+		return false, err
+	}
+	for _, index := range visible {
+		if err := s.vote(index, height, round, cmtproto.PrevoteType, blockID); err != nil {
+			return false, err
+		}
+		if slices.Contains(s.cfg.Faults.DoubleSigners, index) {
+			if err := s.vote(index, height, round, cmtproto.PrevoteType, simulatedBlockID(height, round, index+1)); err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := s.wait(s.cfg.BlockTime / 4); err != nil {
+		return false, err
+	}
+
+	if err := s.step(height, round, "RoundStepPrecommit"); err != nil {
+		return false, err
+	}
+	precommit := types.BlockID{}
+	if committed {
+		precommit = blockID
+	}
+	for _, index := range visible {
+		if err := s.vote(index, height, round, cmtproto.PrecommitType, precommit); err != nil {
+			return false, err
+		}
+	}
+	if err := s.wait(s.cfg.BlockTime / 4); err != nil {
+		return false, err
+	}
+	if !committed {
+		return false, nil
+	}
+
+	if err := s.step(height, round, "RoundStepCommit"); err != nil {
+		return false, err
+	}
+	return true, s.wait(s.cfg.BlockTime / 4)
+}
+
+// returns the proposer of a round of the current height, which as in cometbft is the proposer of the validator
+// set of the height with its priorities incremented once per round
+func (s *Simulator) proposer(round int32) *types.Validator {
+	if round == 0 {
+		return s.set.GetProposer()
+	}
+	return s.set.CopyIncrementProposerPriority(round).GetProposer()
+}
+
+func (s *Simulator) vote(index int, height int64, round int32, voteType cmtproto.SignedMsgType, blockID types.BlockID) error {
+	vote, err := types.MakeVote(
+		s.privVals[index],
+		s.cfg.Network,
+		int32(index),
+		height,
+		round,
+		voteType,
+		blockID,
+		time.Now().UTC().Round(0),
+	)
+	if err != nil {
+		return err
+	}
+	return s.sink.StoreVote(s.ctx, s.cfg.Network, types.EventDataVote{Vote: vote})
+}
+
+func (s *Simulator) step(height int64, round int32, step string) error {
+	return s.sink.StoreNewRoundStep(s.ctx, s.cfg.Network, types.EventDataRoundState{
+		Height: height,
+		Round:  round,
+		Step:   step,
+	}, time.Now())
+}
+
+// waits for d, returning an error if the simulation is stopped first
+func (s *Simulator) wait(d time.Duration) error {
+	if d <= 0 {
+		return s.ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *Simulator) isOffline(index int) bool {
+	return slices.Contains(s.cfg.Faults.Offline, index)
+}
+
+// returns true if the validator is cut off from the observed node during the round
+func (s *Simulator) isPartitioned(index int, height int64, round int32) bool {
+	for _, partition := range s.cfg.Faults.Partitions {
+		if partition.Height == height && int(round) < partition.Rounds && slices.Contains(partition.Validators, index) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the block id proposed in a round, variant 0 is the proposed block and any other variant a
+// conflicting block signed by a double signer
+func simulatedBlockID(height int64, round int32, variant int) types.BlockID {
+	return types.BlockID{
+		Hash: tmhash.Sum([]byte(fmt.Sprintf("block-%d-%d-%d", height, round, variant))),
+		PartSetHeader: types.PartSetHeader{
+			Total: 1,
+			Hash:  tmhash.Sum([]byte(fmt.Sprintf("parts-%d-%d-%d", height, round, variant))),
+		},
+	}
+}
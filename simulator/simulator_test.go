@@ -0,0 +1,185 @@
+package simulator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/analyzer"
+	"github.com/rangesecurity/ctop/cred"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rangesecurity/ctop/simulator"
+	"github.com/rangesecurity/ctop/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// runs the simulation to completion, persisting its events through the event stream into a sqlite database
+func simulate(t *testing.T, cfg simulator.Config, heights int64) (*db.Database, *simulator.Simulator) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	database, err := db.NewSQLite(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.CreateSchema(ctx))
+
+	streams := cred.NewMemoryStreams(cred.DefaultMemoryCapacity)
+	sim, err := simulator.NewSimulator(ctx, streams, cfg)
+	require.NoError(t, err)
+	require.NoError(t, sim.Run(heights))
+
+	batch := service.DefaultBatchOptions()
+	batch.Interval = 10 * time.Millisecond
+	eventStream := service.NewRedisEventStreamWithStreams(ctx, streams, database, "ctop", "test", time.Minute, batch)
+	t.Cleanup(eventStream.Close)
+	go func() { _ = eventStream.PersistVoteEvents(cfg.Network) }()
+	go func() { _ = eventStream.PersistNewRoundEvents(cfg.Network) }()
+	go func() { _ = eventStream.PersistNewRoundStepEvents(cfg.Network) }()
+
+	// every event has been persisted once the streams are empty
+	require.Eventually(t, func() bool {
+		for _, stream := range []string{"votes", "new_round", "new_round_step"} {
+			info, err := streams.Info(ctx, cfg.Network+":"+stream, "ctop")
+			require.NoError(t, err)
+			if info != (cred.StreamInfo{}) {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+	return database, sim
+}
+
+func testConfig(validators int) simulator.Config {
+	cfg := simulator.DefaultConfig()
+	cfg.Validators = validators
+	cfg.StartHeight = 100
+	cfg.BlockTime = 0
+	cfg.TimeoutPropose = 0
+	return cfg
+}
+
+func TestSimulatorHealthy(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(4)
+	database, sim := simulate(t, cfg, 3)
+
+	votes, err := database.GetVotes(ctx, cfg.Network)
+	require.NoError(t, err)
+	// a prevote and precommit of every validator at every height
+	require.Len(t, votes, 3*2*4)
+	rounds, err := database.GetNewRounds(ctx, cfg.Network)
+	require.NoError(t, err)
+	require.Len(t, rounds, 3)
+	for _, round := range rounds {
+		require.Equal(t, 0, round.Round)
+	}
+	latest, err := database.GetLatestVoteHeight(ctx, cfg.Network)
+	require.NoError(t, err)
+	require.Equal(t, int64(102), latest)
+
+	quorums := analyzer.ComputeRoundQuorums(votes, validatorInfo(sim))
+	require.Len(t, quorums, 3)
+	for _, quorum := range quorums {
+		require.True(t, quorum.Precommits.Quorum)
+		require.NotEmpty(t, quorum.Precommits.QuorumBlockID)
+	}
+}
+
+func TestSimulatorFaults(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(7)
+	cfg.Faults = simulator.Faults{
+		Offline:       []int{6},
+		SlowProposers: []int{0},
+		DoubleSigners: []int{5},
+	}
+	database, sim := simulate(t, cfg, 7)
+	validators := sim.Validators()
+
+	votes, err := database.GetVotes(ctx, cfg.Network)
+	require.NoError(t, err)
+	for _, vote := range votes {
+		require.NotEqual(t, validators[6].Address.String(), vote.ValidatorAddress)
+	}
+
+	// validator 0 proposes once every 7 rounds, failing the round it proposes
+	var escalated int
+	for height := int64(100); height < 107; height++ {
+		round, err := database.GetLatestNewRoundForHeight(ctx, cfg.Network, height)
+		require.NoError(t, err)
+		escalated += round.Round
+	}
+	require.Greater(t, escalated, 0)
+
+	evidence := analyzer.FindEquivocations(votes)
+	require.GreaterOrEqual(t, len(evidence), 7)
+	for _, ev := range evidence {
+		require.Equal(t, validators[5].Address.String(), ev.ValidatorAddress)
+	}
+}
+
+func TestSimulatorProposers(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(7)
+	cfg.Faults = simulator.Faults{SlowProposers: []int{0, 3}}
+	database, _ := simulate(t, cfg, 14)
+
+	rounds, err := database.GetNewRounds(ctx, cfg.Network)
+	require.NoError(t, err)
+	proposers := make(map[[2]int]string, len(rounds))
+	for _, round := range rounds {
+		proposers[[2]int{round.Height, round.Round}] = round.ValidatorAddress
+	}
+
+	// the proposer of round r is the proposer of the height's validator set incremented r times, and every
+	// height starts from the set of the previous height incremented once
+	set, _ := testutil.NewValidatorSet(cfg.Validators, cfg.VotingPower)
+	var escalated bool
+	for height := 100; height < 114; height++ {
+		for round := 0; ; round++ {
+			address, ok := proposers[[2]int{height, round}]
+			if !ok {
+				require.Greater(t, round, 0)
+				escalated = escalated || round > 1
+				break
+			}
+			expected := set.GetProposer()
+			if round > 0 {
+				expected = set.CopyIncrementProposerPriority(int32(round)).GetProposer()
+			}
+			require.Equal(t, expected.Address.String(), address, "height %d round %d", height, round)
+		}
+		set.IncrementProposerPriority(1)
+	}
+	require.True(t, escalated)
+}
+
+func TestSimulatorPartition(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(7)
+	// the partitioned validators hold more than 1/3 of the voting power, halting the network for 2 rounds
+	cfg.Faults.Partitions = []simulator.Partition{{Validators: []int{0, 1, 2}, Height: 101, Rounds: 2}}
+	database, _ := simulate(t, cfg, 3)
+
+	round, err := database.GetLatestNewRoundForHeight(ctx, cfg.Network, 101)
+	require.NoError(t, err)
+	require.Equal(t, 2, round.Round)
+	for _, height := range []int64{100, 102} {
+		round, err := database.GetLatestNewRoundForHeight(ctx, cfg.Network, height)
+		require.NoError(t, err)
+		require.Equal(t, 0, round.Round)
+	}
+	votes, err := database.GetVotesForHeight(ctx, cfg.Network, 101)
+	require.NoError(t, err)
+	// 4 visible validators in the halted rounds, and all 7 once the partition healed
+	require.Len(t, votes, 2*2*4+2*7)
+}
+
+func validatorInfo(sim *simulator.Simulator) map[string]db.ValidatorInfo {
+	info := make(map[string]db.ValidatorInfo)
+	for _, validator := range sim.Validators() {
+		info[validator.Address.String()] = db.ValidatorInfo{VotingPower: validator.VotingPower}
+	}
+	return info
+}
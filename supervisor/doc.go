@@ -0,0 +1,2 @@
+// Package supervisor runs multiple components within a single process, restarting components which fail
+package supervisor
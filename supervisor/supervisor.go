@@ -0,0 +1,107 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Component is a long running task. Run blocks until ctx is cancelled, returning nil, or until the component fails
+type Component struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Supervisor runs components until it is stopped. Components which fail, by returning an error or panicking, are
+// restarted with exponential backoff. Components which return nil before being stopped are not restarted
+type Supervisor struct {
+	components []Component
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func New(minBackoff time.Duration, maxBackoff time.Duration) *Supervisor {
+	return &Supervisor{
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// Adds a component, components are started and stopped in the order they are added. Components upstream of others
+// should be added first, so that they stop before the components consuming their output
+func (s *Supervisor) Add(name string, run func(ctx context.Context) error) {
+	s.components = append(s.components, Component{Name: name, Run: run})
+}
+
+// Runs all components until ctx is cancelled, then stops them one at a time, waiting for each component to return
+// before stopping the next one
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.components) == 0 {
+		return errors.New("no components to run")
+	}
+	var (
+		cancels = make([]context.CancelFunc, len(s.components))
+		dones   = make([]chan struct{}, len(s.components))
+	)
+	for i, component := range s.components {
+		// components are stopped explicitly, so their contexts are not derived from ctx
+		componentCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cancels[i] = cancel
+		dones[i] = make(chan struct{})
+		go func(component Component, done chan struct{}) {
+			defer close(done)
+			s.supervise(componentCtx, component)
+		}(component, dones[i])
+	}
+	<-ctx.Done()
+	for i, component := range s.components {
+		log.Info().Str("component", component.Name).Msg("stopping component")
+		cancels[i]()
+		<-dones[i]
+	}
+	return nil
+}
+
+// runs a component until ctx is cancelled, restarting it whenever it fails
+func (s *Supervisor) supervise(ctx context.Context, component Component) {
+	backoff := s.minBackoff
+	for {
+		log.Info().Str("component", component.Name).Msg("starting component")
+		started := time.Now()
+		err := runSafely(ctx, component)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			log.Info().Str("component", component.Name).Msg("component exited")
+			return
+		}
+		// components which ran for a while before failing are restarted quickly
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		log.Error().Err(err).Str("component", component.Name).Dur("backoff", backoff).Msg("component failed, restarting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// runs a component, converting panics into errors
+func runSafely(ctx context.Context, component Component) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return component.Run(ctx)
+}
@@ -0,0 +1,73 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rangesecurity/ctop/supervisor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sup := supervisor.New(time.Millisecond, 10*time.Millisecond)
+
+	var (
+		mu      sync.Mutex
+		stopped []string
+		failing atomic.Int64
+		panics  atomic.Int64
+	)
+	stop := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = append(stopped, name)
+	}
+	sup.Add("upstream", func(ctx context.Context) error {
+		<-ctx.Done()
+		// downstream components must keep running until upstream has stopped
+		time.Sleep(20 * time.Millisecond)
+		stop("upstream")
+		return nil
+	})
+	sup.Add("failing", func(ctx context.Context) error {
+		if failing.Add(1) < 3 {
+			return errors.New("failed")
+		}
+		<-ctx.Done()
+		stop("failing")
+		return nil
+	})
+	sup.Add("panicking", func(ctx context.Context) error {
+		if panics.Add(1) < 2 {
+			panic("panicked")
+		}
+		<-ctx.Done()
+		stop("panicking")
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- sup.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		return failing.Load() == 3 && panics.Load() == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	require.Equal(t, []string{"upstream", "failing", "panicking"}, stopped)
+}
+
+func TestSupervisorNoComponents(t *testing.T) {
+	require.Error(t, supervisor.New(time.Millisecond, time.Second).Run(context.Background()))
+}
@@ -0,0 +1,2 @@
+// Package testutil provides a fake CometBFT node emitting scripted consensus events, allowing tests to run offline
+package testutil
@@ -0,0 +1,175 @@
+package testutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cometbft/cometbft/types"
+)
+
+// ChainID is the chain id votes are signed for
+const ChainID = "ctop-test"
+
+// Returns a validator set of n validators with equal voting power, along with their private validators
+// ordered by validator index. Keys are derived from the index, so the set is identical across runs
+func NewValidatorSet(n int, power int64) (*types.ValidatorSet, []types.PrivValidator) {
+	validators := make([]*types.Validator, 0, n)
+	byAddress := make(map[string]types.PrivValidator, n)
+	for i := 0; i < n; i++ {
+		pv := types.NewMockPVWithParams(ed25519.GenPrivKeyFromSecret([]byte(fmt.Sprintf("validator-%d", i))), false, false)
+		validators = append(validators, types.NewValidator(pv.PrivKey.PubKey(), power))
+		byAddress[pv.PrivKey.PubKey().Address().String()] = pv
+	}
+	set := types.NewValidatorSet(validators)
+	privVals := make([]types.PrivValidator, 0, n)
+	for _, validator := range set.Validators {
+		privVals = append(privVals, byAddress[validator.Address.String()])
+	}
+	return set, privVals
+}
+
+// Returns the block id voted for at height, which is the same across runs
+func BlockID(height int64) types.BlockID {
+	return types.BlockID{
+		Hash: tmhash.Sum([]byte(fmt.Sprintf("block-%d", height))),
+		PartSetHeader: types.PartSetHeader{
+			Total: 1,
+			Hash:  tmhash.Sum([]byte(fmt.Sprintf("parts-%d", height))),
+		},
+	}
+}
+
+// Returns a vote signed by the validator at index
+func SignedVote(
+	privVals []types.PrivValidator,
+	index int32,
+	height int64,
+	round int32,
+	voteType cmtproto.SignedMsgType,
+	blockID types.BlockID,
+	timestamp time.Time,
+) (*types.Vote, error) {
+	return types.MakeVote(privVals[index], ChainID, index, height, round, voteType, blockID, timestamp)
+}
+
+// Returns the events of a height committed in a single round: the round steps, the new round with its
+// proposer, the completed proposal, a prevote and precommit of every validator, and the valid block, polka
+// and lock following the prevotes. Validators whose index is in absent don't vote
+func CommitHeight(
+	set *types.ValidatorSet,
+	privVals []types.PrivValidator,
+	height int64,
+	timestamp time.Time,
+	absent ...int32,
+) ([]Event, error) {
+	skip := make(map[int32]bool, len(absent))
+	for _, index := range absent {
+		skip[index] = true
+	}
+	proposerIndex, proposer := set.GetByAddress(set.GetProposer().Address)
+	events := []Event{
+		roundStep(height, 0, "RoundStepNewHeight"),
+		{
+			Type: types.EventNewRound,
+			Data: types.EventDataNewRound{
+				Height:   height,
+				Round:    0,
+				Step:     "RoundStepNewRound",
+				Proposer: types.ValidatorInfo{Address: proposer.Address, Index: proposerIndex},
+			},
+		},
+		roundStep(height, 0, "RoundStepNewRound"),
+		roundStep(height, 0, "RoundStepPropose"),
+		{
+			Type: types.EventCompleteProposal,
+			Data: types.EventDataCompleteProposal{Height: height, Round: 0, Step: "RoundStepPropose", BlockID: BlockID(height)},
+		},
+	}
+	for _, step := range []struct {
+		name     string
+		voteType cmtproto.SignedMsgType
+		// round state events published once the votes of the step have been received
+		after []string
+	}{
+		{"RoundStepPrevote", cmtproto.PrevoteType, []string{types.EventValidBlock, types.EventPolka, types.EventLock}},
+		{"RoundStepPrecommit", cmtproto.PrecommitType, nil},
+	} {
+		events = append(events, roundStep(height, 0, step.name))
+		for index := range privVals {
+			if skip[int32(index)] {
+				continue
+			}
+			vote, err := SignedVote(privVals, int32(index), height, 0, step.voteType, BlockID(height), timestamp)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, Event{Type: types.EventVote, Data: types.EventDataVote{Vote: vote}})
+		}
+		for _, eventType := range step.after {
+			events = append(events, Event{
+				Type: eventType,
+				Data: types.EventDataRoundState{Height: height, Round: 0, Step: step.name},
+			})
+		}
+	}
+	return append(events, roundStep(height, 0, "RoundStepCommit")), nil
+}
+
+// Returns the NewBlock and NewBlockHeader events of a block proposed by the current proposer of the set,
+// holding txs transactions. The last commit holds a precommit for the previous height of every validator
+// whose index isn't in absent
+func BlockEvents(
+	set *types.ValidatorSet,
+	privVals []types.PrivValidator,
+	height int64,
+	timestamp time.Time,
+	txs int,
+	absent ...int32,
+) ([]Event, error) {
+	skip := make(map[int32]bool, len(absent))
+	for _, index := range absent {
+		skip[index] = true
+	}
+	lastCommit := &types.Commit{}
+	if height > 1 {
+		lastCommit = &types.Commit{Height: height - 1, Round: 0, BlockID: BlockID(height - 1)}
+		for index := range privVals {
+			if skip[int32(index)] {
+				lastCommit.Signatures = append(lastCommit.Signatures, types.NewCommitSigAbsent())
+				continue
+			}
+			vote, err := SignedVote(privVals, int32(index), height-1, 0, cmtproto.PrecommitType, BlockID(height-1), timestamp)
+			if err != nil {
+				return nil, err
+			}
+			lastCommit.Signatures = append(lastCommit.Signatures, vote.CommitSig())
+		}
+	}
+	block := &types.Block{
+		Header: types.Header{
+			ChainID:         ChainID,
+			Height:          height,
+			Time:            timestamp,
+			LastBlockID:     BlockID(height - 1),
+			ProposerAddress: set.GetProposer().Address,
+		},
+		LastCommit: lastCommit,
+	}
+	for i := 0; i < txs; i++ {
+		block.Data.Txs = append(block.Data.Txs, types.Tx(fmt.Sprintf("tx-%d-%d", height, i)))
+	}
+	return []Event{
+		{Type: types.EventNewBlock, Data: types.EventDataNewBlock{Block: block, BlockID: BlockID(height)}},
+		{Type: types.EventNewBlockHeader, Data: types.EventDataNewBlockHeader{Header: block.Header}},
+	}, nil
+}
+
+func roundStep(height int64, round int32, step string) Event {
+	return Event{
+		Type: types.EventNewRoundStep,
+		Data: types.EventDataRoundState{Height: height, Round: round, Step: step},
+	}
+}
@@ -0,0 +1,360 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	cmtpubsub "github.com/cometbft/cometbft/libs/pubsub"
+	cmtquery "github.com/cometbft/cometbft/libs/pubsub/query"
+	"github.com/cometbft/cometbft/p2p"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	rpcserver "github.com/cometbft/cometbft/rpc/jsonrpc/server"
+	rpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	"github.com/cometbft/cometbft/types"
+)
+
+const (
+	// maximum number of validators returned per page, matching cometbft
+	maxPerPage = 100
+	// number of validators returned per page when per_page isn't given
+	defaultPerPage = 30
+	// number of events buffered per subscription before the subscription is cancelled
+	subscriptionBuffer = 1024
+	// maximum number of subscriptions of a websocket client, matching the cometbft default
+	maxSubscriptionsPerClient = 5
+)
+
+// Event is published by a Node after waiting for Delay
+type Event struct {
+	Delay time.Duration
+	// event type as published by cometbft, such as types.EventVote
+	Type string
+	Data types.TMEventData
+}
+
+// Node is a fake CometBFT node serving the json-rpc and websocket endpoints used by ctop. Events are only
+// published when requested, making tests deterministic
+type Node struct {
+	listener *connListener
+	server   *http.Server
+	eventBus *types.EventBus
+
+	mu         sync.Mutex
+	validators []*types.Validator
+	height     int64
+	// height of the latest NewBlockHeader or NewBlock event, served by /status
+	blockHeight int64
+	// validators served by the staking validators abci query
+	stakingValidators []StakingValidator
+	// query -> number of active subscriptions
+	subscriptions map[string]int
+	// closed and replaced whenever the number of subscriptions changes
+	changed chan struct{}
+}
+
+// Starts a node listening on addr, such as 127.0.0.1:0 to pick a free port
+func NewNode(ctx context.Context, addr string, validators []*types.Validator) (*Node, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	eventBus := types.NewEventBus()
+	if err := eventBus.Start(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	n := &Node{
+		listener:      &connListener{Listener: listener, conns: make(map[net.Conn]struct{})},
+		eventBus:      eventBus,
+		validators:    validators,
+		subscriptions: make(map[string]int),
+		changed:       make(chan struct{}),
+	}
+	routes := map[string]*rpcserver.RPCFunc{
+		"subscribe":       rpcserver.NewWSRPCFunc(n.subscribe, "query"),
+		"unsubscribe":     rpcserver.NewWSRPCFunc(n.unsubscribe, "query"),
+		"unsubscribe_all": rpcserver.NewWSRPCFunc(n.unsubscribeAll, ""),
+		"health":          rpcserver.NewRPCFunc(n.health, ""),
+		"validators":      rpcserver.NewRPCFunc(n.validatorsPage, "height,page,per_page"),
+		"status":          rpcserver.NewRPCFunc(n.status, ""),
+		"abci_query":      rpcserver.NewRPCFunc(n.abciQuery, "path,data,height,prove"),
+	}
+	mux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(mux, routes, log.NewNopLogger())
+	wm := rpcserver.NewWebsocketManager(routes, rpcserver.OnDisconnect(func(remoteAddr string) {
+		_ = eventBus.UnsubscribeAll(context.Background(), remoteAddr)
+	}))
+	mux.HandleFunc("/websocket", wm.WebsocketHandler)
+	n.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = n.server.Serve(n.listener)
+	}()
+	go func() {
+		<-ctx.Done()
+		n.Close()
+	}()
+	return n, nil
+}
+
+// Returns the rpc url of the node
+func (n *Node) URL() string {
+	return "tcp://" + n.listener.Addr().String()
+}
+
+// Replaces the validator set served by /validators
+func (n *Node) SetValidators(validators []*types.Validator) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.validators = validators
+}
+
+// Publishes an event to all matching subscriptions
+func (n *Node) Publish(eventType string, data types.TMEventData) error {
+	n.mu.Lock()
+	height := eventHeight(data)
+	if height > n.height {
+		n.height = height
+	}
+	switch data.(type) {
+	case types.EventDataNewBlockHeader, types.EventDataNewBlock:
+		n.blockHeight = max(n.blockHeight, height)
+	}
+	n.mu.Unlock()
+	return n.eventBus.Publish(eventType, data)
+}
+
+// Publishes events in order, waiting for the delay of each event before publishing it
+func (n *Node) Play(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		if event.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(event.Delay):
+			}
+		}
+		if err := n.Publish(event.Type, event.Data); err != nil {
+			return fmt.Errorf("failed to publish %s %+v", event.Type, err)
+		}
+	}
+	return nil
+}
+
+// Blocks until there are at least count subscriptions to query, events published before a client
+// subscribes are never delivered to it
+func (n *Node) WaitForSubscriptions(ctx context.Context, query string, count int) error {
+	for {
+		n.mu.Lock()
+		subscribed, changed := n.subscriptions[query], n.changed
+		n.mu.Unlock()
+		if subscribed >= count {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d subscriptions to %s %w", subscribed, count, query, ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// Returns the number of active subscriptions to query
+func (n *Node) Subscriptions(query string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.subscriptions[query]
+}
+
+// Advances the height served by /status without publishing any events, simulating a node which keeps committing
+// blocks while its events are no longer delivered
+func (n *Node) SetBlockHeight(height int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.blockHeight = height
+}
+
+// Closes all client connections without stopping the node, simulating a dropped connection
+func (n *Node) DropConnections() {
+	n.listener.closeConns()
+}
+
+// Stops the node and closes all client connections
+func (n *Node) Close() {
+	_ = n.server.Close()
+	n.listener.closeConns()
+	if n.eventBus.IsRunning() {
+		_ = n.eventBus.Stop()
+	}
+}
+
+func (n *Node) subscribe(ctx *rpctypes.Context, query string) (*ctypes.ResultSubscribe, error) {
+	q, err := cmtquery.New(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	if n.eventBus.NumClientSubscriptions(ctx.RemoteAddr()) >= maxSubscriptionsPerClient {
+		return nil, fmt.Errorf("max_subscriptions_per_client %d reached", maxSubscriptionsPerClient)
+	}
+	sub, err := n.eventBus.Subscribe(ctx.Context(), ctx.RemoteAddr(), q, subscriptionBuffer)
+	if err != nil {
+		return nil, err
+	}
+	n.updateSubscriptions(query, 1)
+	subscriptionID := ctx.JSONReq.ID
+	go func() {
+		defer n.updateSubscriptions(query, -1)
+		for {
+			select {
+			case msg := <-sub.Out():
+				resp := rpctypes.NewRPCSuccessResponse(
+					subscriptionID,
+					&ctypes.ResultEvent{Query: query, Data: msg.Data(), Events: msg.Events()},
+				)
+				if err := ctx.WSConn.WriteRPCResponse(context.Background(), resp); err != nil {
+					return
+				}
+			case <-sub.Canceled():
+				if !errors.Is(sub.Err(), cmtpubsub.ErrUnsubscribed) {
+					err := fmt.Errorf("subscription was canceled (reason: %v)", sub.Err())
+					ctx.WSConn.TryWriteRPCResponse(rpctypes.RPCServerError(subscriptionID, err))
+				}
+				return
+			}
+		}
+	}()
+	return &ctypes.ResultSubscribe{}, nil
+}
+
+func (n *Node) unsubscribe(ctx *rpctypes.Context, query string) (*ctypes.ResultUnsubscribe, error) {
+	q, err := cmtquery.New(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	if err := n.eventBus.Unsubscribe(context.Background(), ctx.RemoteAddr(), q); err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultUnsubscribe{}, nil
+}
+
+func (n *Node) unsubscribeAll(ctx *rpctypes.Context) (*ctypes.ResultUnsubscribe, error) {
+	if err := n.eventBus.UnsubscribeAll(context.Background(), ctx.RemoteAddr()); err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultUnsubscribe{}, nil
+}
+
+func (n *Node) health(*rpctypes.Context) (*ctypes.ResultHealth, error) {
+	return &ctypes.ResultHealth{}, nil
+}
+
+// serves the latest block height, the only part of the status used by ctop
+func (n *Node) status(*rpctypes.Context) (*ctypes.ResultStatus, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &ctypes.ResultStatus{
+		NodeInfo: p2p.DefaultNodeInfo{Network: ChainID},
+		SyncInfo: ctypes.SyncInfo{LatestBlockHeight: n.blockHeight},
+	}, nil
+}
+
+// serves a page of the validator set, failing with the same error as cometbft for pages out of range
+func (n *Node) validatorsPage(_ *rpctypes.Context, _ *int64, pagePtr, perPagePtr *int) (*ctypes.ResultValidators, error) {
+	n.mu.Lock()
+	validators, height := n.validators, n.height
+	n.mu.Unlock()
+
+	perPage := defaultPerPage
+	if perPagePtr != nil && *perPagePtr > 0 {
+		perPage = min(*perPagePtr, maxPerPage)
+	}
+	page := 1
+	if pagePtr != nil {
+		pages := max((len(validators)-1)/perPage+1, 1)
+		if page = *pagePtr; page <= 0 || page > pages {
+			return nil, fmt.Errorf("page should be within [1, %d] range, given %d", pages, page)
+		}
+	}
+	start := (page - 1) * perPage
+	end := min(start+perPage, len(validators))
+	return &ctypes.ResultValidators{
+		BlockHeight: height,
+		Validators:  validators[start:end],
+		Count:       end - start,
+		Total:       len(validators),
+	}, nil
+}
+
+func (n *Node) updateSubscriptions(query string, delta int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subscriptions[query] += delta
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// returns the height of an event, or 0 if the event has no height
+func eventHeight(data types.TMEventData) int64 {
+	switch event := data.(type) {
+	case types.EventDataVote:
+		return event.Vote.Height
+	case types.EventDataNewRound:
+		return event.Height
+	case types.EventDataRoundState:
+		return event.Height
+	case types.EventDataCompleteProposal:
+		return event.Height
+	case types.EventDataNewBlockHeader:
+		return event.Header.Height
+	case types.EventDataNewBlock:
+		if event.Block != nil {
+			return event.Block.Height
+		}
+	}
+	return 0
+}
+
+// a listener keeping track of accepted connections, as websocket connections are hijacked from the
+// http server and would otherwise outlive it
+type connListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.conns[conn] = struct{}{}
+	l.mu.Unlock()
+	return &trackedConn{Conn: conn, listener: l}, nil
+}
+
+func (l *connListener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		_ = conn.Close()
+		delete(l.conns, conn)
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	listener *connListener
+}
+
+func (c *trackedConn) Close() error {
+	c.listener.mu.Lock()
+	delete(c.listener.conns, c.Conn)
+	c.listener.mu.Unlock()
+	return c.Conn.Close()
+}
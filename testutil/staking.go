@@ -0,0 +1,162 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/secp256k1"
+	cmtbytes "github.com/cometbft/cometbft/libs/bytes"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	rpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// abci query path of the validators query of the cosmos staking module
+const stakingValidatorsPath = "/cosmos.staking.v1beta1.Query/Validators"
+
+// StakingValidator is a validator registered with the cosmos staking module, served by the abci_query endpoint
+type StakingValidator struct {
+	OperatorAddress string
+	PubKey          crypto.PubKey
+	Moniker         string
+	Website         string
+}
+
+// Replaces the validators served by the staking validators abci query
+func (n *Node) SetStakingValidators(validators []StakingValidator) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stakingValidators = validators
+}
+
+// serves the staking validators query, failing like the cosmos sdk for all other paths
+func (n *Node) abciQuery(
+	_ *rpctypes.Context, path string, data cmtbytes.HexBytes, _ int64, _ bool,
+) (*ctypes.ResultABCIQuery, error) {
+	if path != stakingValidatorsPath {
+		return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{
+			Code: 6,
+			Log:  fmt.Sprintf("unknown query path: %s", path),
+		}}, nil
+	}
+	n.mu.Lock()
+	validators := n.stakingValidators
+	n.mu.Unlock()
+
+	start, limit, err := decodeValidatorsRequest(data)
+	if err != nil {
+		return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Code: 2, Log: err.Error()}}, nil
+	}
+	start = min(start, len(validators))
+	end := len(validators)
+	if limit > 0 {
+		end = min(start+limit, end)
+	}
+	var res []byte
+	for _, validator := range validators[start:end] {
+		res = protowire.AppendTag(res, 1, protowire.BytesType)
+		res = protowire.AppendBytes(res, encodeStakingValidator(validator))
+	}
+	var pagination []byte
+	if end < len(validators) {
+		pagination = protowire.AppendTag(pagination, 1, protowire.BytesType)
+		pagination = protowire.AppendBytes(pagination, binary.BigEndian.AppendUint64(nil, uint64(end)))
+	}
+	pagination = protowire.AppendTag(pagination, 2, protowire.VarintType)
+	pagination = protowire.AppendVarint(pagination, uint64(len(validators)))
+	res = protowire.AppendTag(res, 2, protowire.BytesType)
+	res = protowire.AppendBytes(res, pagination)
+	return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Value: res}}, nil
+}
+
+// decodes the pagination of a QueryValidatorsRequest, keys being the big endian index of the first validator
+func decodeValidatorsRequest(data []byte) (start int, limit int, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		if num == 2 && typ == protowire.BytesType {
+			pagination, _ := protowire.ConsumeBytes(data)
+			if start, limit, err = decodePagination(pagination); err != nil {
+				return 0, 0, err
+			}
+		}
+		data = data[n:]
+	}
+	return start, limit, nil
+}
+
+func decodePagination(data []byte) (start int, limit int, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			key, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return 0, 0, protowire.ParseError(n)
+			}
+			if len(key) != 8 {
+				return 0, 0, fmt.Errorf("invalid pagination key %X", key)
+			}
+			start = int(binary.BigEndian.Uint64(key))
+		case num == 3 && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, 0, protowire.ParseError(n)
+			}
+			limit = int(value)
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return 0, 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return start, limit, nil
+}
+
+// encodes the fields of a cosmos.staking.v1beta1.Validator read by ctop
+func encodeStakingValidator(validator StakingValidator) []byte {
+	res := protowire.AppendTag(nil, 1, protowire.BytesType)
+	res = protowire.AppendString(res, validator.OperatorAddress)
+	if validator.PubKey != nil {
+		key := protowire.AppendTag(nil, 1, protowire.BytesType)
+		key = protowire.AppendBytes(key, validator.PubKey.Bytes())
+		wrapped := protowire.AppendTag(nil, 1, protowire.BytesType)
+		wrapped = protowire.AppendString(wrapped, pubKeyTypeURL(validator.PubKey))
+		wrapped = protowire.AppendTag(wrapped, 2, protowire.BytesType)
+		wrapped = protowire.AppendBytes(wrapped, key)
+		res = protowire.AppendTag(res, 2, protowire.BytesType)
+		res = protowire.AppendBytes(res, wrapped)
+	}
+	description := protowire.AppendTag(nil, 1, protowire.BytesType)
+	description = protowire.AppendString(description, validator.Moniker)
+	description = protowire.AppendTag(description, 3, protowire.BytesType)
+	description = protowire.AppendString(description, validator.Website)
+	res = protowire.AppendTag(res, 7, protowire.BytesType)
+	return protowire.AppendBytes(res, description)
+}
+
+func pubKeyTypeURL(key crypto.PubKey) string {
+	switch key.(type) {
+	case ed25519.PubKey:
+		return "/cosmos.crypto.ed25519.PubKey"
+	case secp256k1.PubKey:
+		return "/cosmos.crypto.secp256k1.PubKey"
+	default:
+		return "/" + key.Type()
+	}
+}
@@ -0,0 +1,319 @@
+package top
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/db"
+	"github.com/rangesecurity/ctop/service"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// width of a single validator cell in the grid, "1234 ■■ "
+	cellWidth = 8
+	// width of a validator cell once monikers are known, "1234 ■■ moniker     "
+	monikerCellWidth = 20
+	// interval at which monikers are reloaded from the identities
+	monikerRefreshInterval = 30 * time.Second
+	// interval at which the validator set is reloaded from the database
+	validatorRefreshInterval = 30 * time.Second
+)
+
+var (
+	styleDefault = tcell.StyleDefault
+	styleTitle   = tcell.StyleDefault.Bold(true)
+	styleDim     = tcell.StyleDefault.Foreground(tcell.ColorGray)
+	styleBlock   = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	styleNil     = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	styleMissing = tcell.StyleDefault.Foreground(tcell.ColorRed)
+)
+
+// Identities resolves the monikers of the validators of a network
+type Identities interface {
+	Monikers(ctx context.Context, network string) map[string]string
+}
+
+// ValidatorSets loads the stored validator set of a network
+type ValidatorSets interface {
+	GetValidators(ctx context.Context, network string) (db.Validators, error)
+}
+
+// Dashboard renders the consensus state of a network to the terminal, updating as events arrive. Validators are
+// labelled with their monikers if identities is not nil, and the grid displays the stored validator set if
+// validatorSets is not nil, otherwise only validators seen voting are displayed
+type Dashboard struct {
+	tail          *service.EventTail
+	state         *State
+	identities    Identities
+	validatorSets ValidatorSets
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+func NewDashboard(
+	ctx context.Context,
+	redisUrl string,
+	network string,
+	identities Identities,
+	validatorSets ValidatorSets,
+) (*Dashboard, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	tail, err := service.NewEventTail(ctx, redisUrl)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Dashboard{
+		tail:          tail,
+		state:         NewState(network),
+		identities:    identities,
+		validatorSets: validatorSets,
+		ctx:           ctx,
+		cancel:        cancel,
+	}, nil
+}
+
+// Takes over the terminal and renders the dashboard until the context is cancelled or the user quits
+func (d *Dashboard) Run() error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("failed to create screen %+v", err)
+	}
+	if err := screen.Init(); err != nil {
+		return fmt.Errorf("failed to initialize screen %+v", err)
+	}
+	defer screen.Fini()
+	defer d.cancel()
+
+	eventCh := make(chan common.StreamEvent, 1024)
+	go func() {
+		if err := d.tail.Tail([]string{d.state.Network}, eventCh); err != nil {
+			log.Error().Err(err).Str("network", d.state.Network).Msg("failed to tail event streams")
+			d.cancel()
+		}
+	}()
+	screenCh := make(chan tcell.Event, 16)
+	go func() {
+		for {
+			ev := screen.PollEvent()
+			if ev == nil {
+				// screen has been finalized
+				return
+			}
+			select {
+			case screenCh <- ev:
+			case <-d.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	monikerCh := make(chan map[string]string, 1)
+	if d.identities != nil {
+		go d.loadMonikers(monikerCh)
+	}
+	validatorCh := make(chan []string, 1)
+	if d.validatorSets != nil {
+		go d.loadValidators(validatorCh)
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	d.draw(screen)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return nil
+		case event := <-eventCh:
+			d.state.Apply(event, time.Now())
+		case <-ticker.C:
+			d.draw(screen)
+		case monikers := <-monikerCh:
+			d.state.SetMonikers(monikers)
+		case validators := <-validatorCh:
+			d.state.SetValidators(validators)
+		case ev := <-screenCh:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				screen.Sync()
+				d.draw(screen)
+			case *tcell.EventKey:
+				if ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlC || ev.Rune() == 'q' {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (d *Dashboard) Close() {
+	d.cancel()
+}
+
+// loads the monikers on start and every monikerRefreshInterval, sending them to monikerCh. Runs outside of the
+// render loop, so slow queries don't freeze the dashboard
+func (d *Dashboard) loadMonikers(monikerCh chan<- map[string]string) {
+	ticker := time.NewTicker(monikerRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case monikerCh <- d.identities.Monikers(d.ctx, d.state.Network):
+		case <-d.ctx.Done():
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// loads the validator set on start and every validatorRefreshInterval, sending the addresses of its members ordered
+// by validator index to validatorCh. Sets which fail to load are skipped, keeping the previous set displayed
+func (d *Dashboard) loadValidators(validatorCh chan<- []string) {
+	ticker := time.NewTicker(validatorRefreshInterval)
+	defer ticker.Stop()
+	for {
+		validators, err := d.validatorSets.GetValidators(d.ctx, d.state.Network)
+		if err == nil {
+			select {
+			case validatorCh <- validatorOrder(validators):
+			case <-d.ctx.Done():
+				return
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) && d.ctx.Err() == nil {
+			log.Warn().Err(err).Str("network", d.state.Network).Msg("failed to load validator set")
+		}
+		select {
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// returns the addresses of the members of a validator set ordered by validator index, which cometbft assigns by
+// descending voting power and ascending address
+func validatorOrder(validators db.Validators) []string {
+	info := validators.Info()
+	addresses := make([]string, 0, len(info))
+	for address := range info {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if info[addresses[i]].VotingPower == info[addresses[j]].VotingPower {
+			return addresses[i] < addresses[j]
+		}
+		return info[addresses[i]].VotingPower > info[addresses[j]].VotingPower
+	})
+	return addresses
+}
+
+func (d *Dashboard) draw(screen tcell.Screen) {
+	screen.Clear()
+	width, height := screen.Size()
+	state := d.state
+	now := time.Now()
+
+	drawText(screen, 0, 0, styleTitle, fmt.Sprintf("ctop - %s", state.Network))
+	drawText(screen, width-8, 0, styleDim, now.Format("15:04:05"))
+	if state.Height == 0 {
+		drawText(screen, 0, 2, styleDim, "waiting for events...")
+		screen.Show()
+		return
+	}
+	drawText(screen, 0, 2, styleDefault, fmt.Sprintf(
+		"height %d   round %d   step %s (%s)",
+		state.Height, state.Round, state.Step, now.Sub(state.StepStarted).Truncate(100*time.Millisecond),
+	))
+	proposer := "unknown"
+	if moniker := state.Moniker(state.Proposer); moniker != "" {
+		proposer = fmt.Sprintf("%s %s (index %d)", moniker, state.Proposer, state.ProposerIndex)
+	} else if state.Proposer != "" {
+		proposer = fmt.Sprintf("%s (index %d)", state.Proposer, state.ProposerIndex)
+	}
+	drawText(screen, 0, 3, styleDefault, "proposer "+proposer)
+
+	validators := state.Validators()
+	var prevotes, precommits int
+	for _, validator := range validators {
+		if validator.Prevote != VoteMissing {
+			prevotes++
+		}
+		if validator.Precommit != VoteMissing {
+			precommits++
+		}
+	}
+	drawText(screen, 0, 4, styleDefault, fmt.Sprintf(
+		"prevotes %d/%d   precommits %d/%d", prevotes, len(validators), precommits, len(validators),
+	))
+
+	cell := cellWidth
+	for _, validator := range validators {
+		if validator.Moniker != "" {
+			cell = monikerCellWidth
+			break
+		}
+	}
+	columns := width / cell
+	if columns == 0 {
+		columns = 1
+	}
+	for i, validator := range validators {
+		x, y := (i%columns)*cell, 6+i/columns
+		if y >= height-2 {
+			drawText(screen, 0, height-2, styleDim, fmt.Sprintf("%d validators not shown", len(validators)-i))
+			break
+		}
+		drawText(screen, x, y, styleDim, fmt.Sprintf("%4d", validator.Index))
+		screen.SetContent(x+5, y, '■', nil, voteStyle(validator.Prevote))
+		screen.SetContent(x+6, y, '■', nil, voteStyle(validator.Precommit))
+		if cell > cellWidth {
+			drawText(screen, x+cellWidth, y, styleDefault, truncate(validator.Moniker, cell-cellWidth-1))
+		}
+	}
+
+	x := drawText(screen, 0, height-1, styleDim, "prevote/precommit: ")
+	x = drawText(screen, x, height-1, styleBlock, "■ block ")
+	x = drawText(screen, x, height-1, styleNil, "■ nil ")
+	x = drawText(screen, x, height-1, styleMissing, "■ missing ")
+	drawText(screen, x, height-1, styleDim, "  q to quit")
+	screen.Show()
+}
+
+func voteStyle(status VoteStatus) tcell.Style {
+	switch status {
+	case VoteBlock:
+		return styleBlock
+	case VoteNil:
+		return styleNil
+	default:
+		return styleMissing
+	}
+}
+
+// truncates text to at most width characters, marking truncated text with a trailing ellipsis
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// draws text starting at the given position, returning the column following the text
+func drawText(screen tcell.Screen, x int, y int, style tcell.Style, text string) int {
+	for _, r := range text {
+		screen.SetContent(x, y, r, nil, style)
+		x++
+	}
+	return x
+}
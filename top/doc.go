@@ -0,0 +1,2 @@
+// Package top provides a full screen terminal dashboard displaying the live consensus state of a network
+package top
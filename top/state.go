@@ -0,0 +1,188 @@
+package top
+
+import (
+	"sort"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/rangesecurity/ctop/common"
+)
+
+// the vote cast by a validator in the current round
+type VoteStatus int
+
+const (
+	// no vote has been seen
+	VoteMissing VoteStatus = iota
+	// voted for nil
+	VoteNil
+	// voted for a block
+	VoteBlock
+)
+
+// a single validator cell of the dashboard grid
+type ValidatorStatus struct {
+	Address   string
+	Moniker   string
+	Index     int64
+	Prevote   VoteStatus
+	Precommit VoteStatus
+}
+
+// State tracks the consensus state of a single network as observed through its event streams
+type State struct {
+	Network       string
+	Height        int64
+	Round         int64
+	Step          string
+	StepStarted   time.Time
+	Proposer      string
+	ProposerIndex int64
+	LastEvent     time.Time
+
+	// validator addresses of the active set, ordered by validator index
+	set []string
+	// validator_address => validator_index of every validator seen voting, displayed until the set is known
+	validators map[string]int64
+	// validator_address => moniker of validators with a known identity
+	monikers map[string]string
+	// round => validator_address => block id, for the current height
+	prevotes   map[int64]map[string]string
+	precommits map[int64]map[string]string
+}
+
+func NewState(network string) *State {
+	return &State{
+		Network:    network,
+		validators: make(map[string]int64),
+		prevotes:   make(map[int64]map[string]string),
+		precommits: make(map[int64]map[string]string),
+	}
+}
+
+// Replaces the monikers displayed for validators, keyed by validator address
+func (s *State) SetMonikers(monikers map[string]string) {
+	s.monikers = monikers
+}
+
+// Replaces the validator set displayed in the grid with the given addresses, ordered by validator index.
+// Validators of the set which haven't voted are displayed as missing
+func (s *State) SetValidators(addresses []string) {
+	s.set = addresses
+}
+
+// Returns the moniker of a validator, or an empty string if it is unknown
+func (s *State) Moniker(address string) string {
+	return s.monikers[address]
+}
+
+// Applies an event to the state, events for heights lower than the current height are ignored
+func (s *State) Apply(event common.StreamEvent, now time.Time) {
+	if event.Network != s.Network {
+		return
+	}
+	s.LastEvent = now
+	switch data := event.Data.(type) {
+	case *common.ParsedNewRoundStep:
+		if !s.advance(data.Height, data.Round, now) {
+			return
+		}
+		if data.Step != s.Step {
+			s.Step = data.Step
+			s.StepStarted = now
+		}
+	case *common.ParsedNewRound:
+		if !s.advance(data.Height, data.Round, now) {
+			return
+		}
+		if data.Round == s.Round {
+			s.Proposer = data.ProposerAddress
+			s.ProposerIndex = data.ProposerIndex
+		}
+	case *common.ParsedVote:
+		// votes for a later round or height are seen before the corresponding new round event when it is late
+		if !s.advance(data.Height, data.Round, now) {
+			return
+		}
+		s.validators[data.ValidatorAddress] = data.ValidatorIndex
+		var votes map[int64]map[string]string
+		switch data.Type {
+		case cmtproto.PrevoteType.String():
+			votes = s.prevotes
+		case cmtproto.PrecommitType.String():
+			votes = s.precommits
+		default:
+			return
+		}
+		if votes[data.Round] == nil {
+			votes[data.Round] = make(map[string]string)
+		}
+		votes[data.Round][data.ValidatorAddress] = data.BlockID
+	}
+}
+
+// moves the state forward to the given height and round, returning false if they are in the past
+func (s *State) advance(height int64, round int64, now time.Time) bool {
+	switch {
+	case height > s.Height:
+		s.Height = height
+		s.Round = round
+		s.Step = ""
+		s.StepStarted = now
+		s.Proposer = ""
+		s.ProposerIndex = 0
+		s.prevotes = make(map[int64]map[string]string)
+		s.precommits = make(map[int64]map[string]string)
+	case height < s.Height:
+		return false
+	case round > s.Round:
+		s.Round = round
+		s.Proposer = ""
+		s.ProposerIndex = 0
+	}
+	return true
+}
+
+// Returns the vote status of every validator of the set for the current round, ordered by validator index. Until the
+// set is known the validators seen voting are returned instead
+func (s *State) Validators() []ValidatorStatus {
+	if len(s.set) > 0 {
+		statuses := make([]ValidatorStatus, len(s.set))
+		for index, address := range s.set {
+			statuses[index] = s.status(address, int64(index))
+		}
+		return statuses
+	}
+	statuses := make([]ValidatorStatus, 0, len(s.validators))
+	for address, index := range s.validators {
+		statuses = append(statuses, s.status(address, index))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Index == statuses[j].Index {
+			return statuses[i].Address < statuses[j].Address
+		}
+		return statuses[i].Index < statuses[j].Index
+	})
+	return statuses
+}
+
+func (s *State) status(address string, index int64) ValidatorStatus {
+	return ValidatorStatus{
+		Address:   address,
+		Moniker:   s.monikers[address],
+		Index:     index,
+		Prevote:   voteStatus(s.prevotes[s.Round], address),
+		Precommit: voteStatus(s.precommits[s.Round], address),
+	}
+}
+
+func voteStatus(votes map[string]string, address string) VoteStatus {
+	blockID, ok := votes[address]
+	if !ok {
+		return VoteMissing
+	}
+	if common.IsNilBlockID(blockID) {
+		return VoteNil
+	}
+	return VoteBlock
+}
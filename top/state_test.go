@@ -0,0 +1,99 @@
+package top_test
+
+import (
+	"testing"
+	"time"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/rangesecurity/ctop/common"
+	"github.com/rangesecurity/ctop/top"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	now := time.Unix(0, 0)
+	state := top.NewState("osmosis")
+
+	state.Apply(common.StreamEvent{
+		Network: "osmosis",
+		Data:    &common.ParsedNewRoundStep{Height: 100, Round: 0, Step: "RoundStepNewHeight"},
+	}, now)
+	state.Apply(common.StreamEvent{
+		Network: "osmosis",
+		Data:    &common.ParsedNewRound{Height: 100, Round: 0, Step: "RoundStepNewRound", ProposerAddress: "AAAA", ProposerIndex: 1},
+	}, now)
+	require.Equal(t, int64(100), state.Height)
+	require.Equal(t, "AAAA", state.Proposer)
+
+	// events from other networks are ignored
+	state.Apply(common.StreamEvent{
+		Network: "cosmoshub",
+		Data:    &common.ParsedNewRoundStep{Height: 200, Round: 0, Step: "RoundStepNewHeight"},
+	}, now)
+	require.Equal(t, int64(100), state.Height)
+
+	state.Apply(voteEvent(100, 0, cmtproto.PrevoteType, "AAAA", 1, "HASH:1:000000000000"), now)
+	state.Apply(voteEvent(100, 0, cmtproto.PrevoteType, "BBBB", 0, ":0:000000000000"), now)
+	state.Apply(voteEvent(100, 0, cmtproto.PrecommitType, "AAAA", 1, "HASH:1:000000000000"), now)
+	// stale votes are ignored
+	state.Apply(voteEvent(99, 0, cmtproto.PrecommitType, "CCCC", 2, "HASH:1:000000000000"), now)
+
+	state.SetMonikers(map[string]string{"AAAA": "alice"})
+	require.Equal(t, "alice", state.Moniker(state.Proposer))
+	validators := state.Validators()
+	require.Len(t, validators, 2)
+	require.Equal(t, top.ValidatorStatus{Address: "BBBB", Index: 0, Prevote: top.VoteNil, Precommit: top.VoteMissing}, validators[0])
+	require.Equal(t, top.ValidatorStatus{Address: "AAAA", Moniker: "alice", Index: 1, Prevote: top.VoteBlock, Precommit: top.VoteBlock}, validators[1])
+
+	// moving to the next round resets the proposer and displays votes for the new round
+	state.Apply(common.StreamEvent{
+		Network: "osmosis",
+		Data:    &common.ParsedNewRoundStep{Height: 100, Round: 1, Step: "RoundStepNewRound"},
+	}, now.Add(time.Second))
+	require.Equal(t, int64(1), state.Round)
+	require.Equal(t, "", state.Proposer)
+	require.Equal(t, now.Add(time.Second), state.StepStarted)
+	for _, validator := range state.Validators() {
+		require.Equal(t, top.VoteMissing, validator.Prevote)
+	}
+
+	// a vote for a later round of the current height advances the round
+	state.Apply(voteEvent(100, 2, cmtproto.PrevoteType, "AAAA", 1, "HASH:1:000000000000"), now)
+	require.Equal(t, int64(100), state.Height)
+	require.Equal(t, int64(2), state.Round)
+	validators = state.Validators()
+	require.Equal(t, top.VoteMissing, validators[0].Prevote)
+	require.Equal(t, top.VoteBlock, validators[1].Prevote)
+
+	// a vote for a new height advances the state
+	state.Apply(voteEvent(101, 0, cmtproto.PrevoteType, "BBBB", 0, "HASH:1:000000000000"), now)
+	require.Equal(t, int64(101), state.Height)
+	require.Equal(t, int64(0), state.Round)
+	validators = state.Validators()
+	require.Len(t, validators, 2)
+	require.Equal(t, top.VoteBlock, validators[0].Prevote)
+	require.Equal(t, top.VoteMissing, validators[1].Prevote)
+
+	// once the validator set is known it is displayed in place of the validators seen voting, validators which
+	// haven't voted being missing and validators which left the set no longer displayed
+	state.SetValidators([]string{"BBBB", "CCCC"})
+	validators = state.Validators()
+	require.Len(t, validators, 2)
+	require.Equal(t, top.ValidatorStatus{Address: "BBBB", Index: 0, Prevote: top.VoteBlock, Precommit: top.VoteMissing}, validators[0])
+	require.Equal(t, top.ValidatorStatus{Address: "CCCC", Index: 1, Prevote: top.VoteMissing, Precommit: top.VoteMissing}, validators[1])
+}
+
+func voteEvent(height int64, round int64, voteType cmtproto.SignedMsgType, validator string, index int64, blockID string) common.StreamEvent {
+	return common.StreamEvent{
+		Network: "osmosis",
+		Stream:  common.StreamVotes,
+		Data: &common.ParsedVote{
+			Type:             voteType.String(),
+			Height:           height,
+			Round:            round,
+			BlockID:          blockID,
+			ValidatorAddress: validator,
+			ValidatorIndex:   index,
+		},
+	}
+}
@@ -2,18 +2,160 @@ package wsclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	rpcclient "github.com/cometbft/cometbft/rpc/client/http"
 	coretypes "github.com/cometbft/cometbft/rpc/core/types"
 	"github.com/cometbft/cometbft/types"
+	"github.com/rs/zerolog/log"
 )
 
+type ConnectionState int32
+
+const (
+	StateConnecting ConnectionState = iota
+	StateConnected
+	StateReconnecting
+	StateClosed
+)
+
+func (cs ConnectionState) String() string {
+	switch cs {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(cs))
+	}
+}
+
+// Options configures how the client detects and recovers from disconnects
+type Options struct {
+	// interval at which the status of the rpc node is queried, a failed query triggers a reconnect
+	PingInterval time.Duration
+	// maximum duration of a single ping
+	PingTimeout time.Duration
+	// reconnect if no events have been received for this long while subscribed, although the node committed new
+	// blocks in the meantime. A halted chain publishes no events and doesn't cause reconnects, 0 disables the check
+	StaleTimeout time.Duration
+	// delay before the first reconnect attempt, doubled after every failed attempt up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// called whenever the connection state changes
+	OnStateChange func(ConnectionState)
+	// if the node can't be reached when the client is created, return a client reconnecting in the background
+	// instead of an error
+	ConnectInBackground bool
+	// if set, connections to nodes whose /status reports another network are rejected, so that an endpoint of the
+	// wrong chain is never mistaken for the configured one
+	ChainID string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		PingInterval: 10 * time.Second,
+		PingTimeout:  5 * time.Second,
+		StaleTimeout: time.Minute,
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+	}
+}
+
+// an event subscription which survives reconnects
+type subscription struct {
+	subscriber string
+	query      string
+	capacity   int
+	out        chan coretypes.ResultEvent
+	// closed when the subscription is removed
+	done chan struct{}
+}
+
+// WsClient wraps the tendermint rpc client, reconnecting and resubscribing whenever the connection is lost
 type WsClient struct {
-	client *rpcclient.HTTP
+	url  string
+	opts Options
+
+	mu            sync.RWMutex
+	client        *rpcclient.HTTP
+	subscriptions map[string]*subscription
+	// set while the connection is lost, subscriptions are then only resubscribed once reconnected
+	disconnected bool
+	// cancelled when the current connection is replaced, stopping its forwarding goroutines
+	connCtx    context.Context
+	connCancel context.CancelFunc
+	forwarders sync.WaitGroup
+
+	state     atomic.Int32
+	lastEvent atomic.Int64
+	// height of the node when events were last received within the stale timeout, -1 if unknown. Only
+	// accessed by the monitor
+	activeHeight int64
+	reconnect    chan struct{}
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
 func NewClient(url string) (*WsClient, error) {
+	return NewClientWithOptions(url, DefaultOptions())
+}
+
+func NewClientWithOptions(url string, opts Options) (*WsClient, error) {
+	client, err := rpcclient.New(url, "/websocket")
+	if err != nil {
+		return nil, err
+	}
+	startErr := client.Start()
+	if startErr == nil {
+		// a node of another chain is a configuration error, reported even when connecting in the background
+		if err := checkChainID(context.Background(), client, opts); err != nil {
+			_ = client.Stop()
+			return nil, err
+		}
+	} else if !opts.ConnectInBackground {
+		return nil, startErr
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	connCtx, connCancel := context.WithCancel(ctx)
+	ws := &WsClient{
+		url:           url,
+		opts:          opts,
+		client:        client,
+		subscriptions: make(map[string]*subscription),
+		disconnected:  startErr != nil,
+		connCtx:       connCtx,
+		connCancel:    connCancel,
+		activeHeight:  -1,
+		reconnect:     make(chan struct{}, 1),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	ws.lastEvent.Store(time.Now().UnixNano())
+	if startErr != nil {
+		ws.setState(StateReconnecting)
+	} else {
+		ws.setState(StateConnected)
+	}
+	go func() {
+		if startErr != nil {
+			ws.reconnectWithBackoff(startErr)
+		}
+		ws.monitor()
+	}()
+	return ws, nil
+}
+
+func dial(url string) (*rpcclient.HTTP, error) {
 	client, err := rpcclient.New(url, "/websocket")
 	if err != nil {
 		return nil, err
@@ -21,53 +163,445 @@ func NewClient(url string) (*WsClient, error) {
 	if err := client.Start(); err != nil {
 		return nil, err
 	}
-	return &WsClient{client}, nil
+	return client, nil
+}
+
+// Returns the current state of the connection
+func (ws *WsClient) State() ConnectionState {
+	return ConnectionState(ws.state.Load())
+}
+
+func (ws *WsClient) setState(state ConnectionState) {
+	if ConnectionState(ws.state.Swap(int32(state))) != state && ws.opts.OnStateChange != nil {
+		ws.opts.OnStateChange(state)
+	}
+}
+
+// Subscribes to events matching query. The returned channel remains valid across reconnects, and is closed once the
+// client is closed. While reconnecting the subscription is made once the connection is restored
+func (ws *WsClient) Subscribe(
+	ctx context.Context,
+	subscriber string,
+	query string,
+	capacity int,
+) (<-chan coretypes.ResultEvent, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if sub, ok := ws.subscriptions[query]; ok {
+		return sub.out, nil
+	}
+	sub := &subscription{
+		subscriber: subscriber,
+		query:      query,
+		capacity:   capacity,
+		out:        make(chan coretypes.ResultEvent, capacity),
+		done:       make(chan struct{}),
+	}
+	if ws.disconnected {
+		ws.subscriptions[query] = sub
+		return sub.out, nil
+	}
+	in, err := ws.client.Subscribe(ctx, subscriber, query, capacity)
+	if err != nil {
+		return nil, err
+	}
+	ws.subscriptions[query] = sub
+	ws.startForwarding(ws.connCtx, sub, in)
+	return sub.out, nil
+}
+
+// Removes a subscription, its channel is not closed
+func (ws *WsClient) Unsubscribe(ctx context.Context, query string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if sub, ok := ws.subscriptions[query]; ok {
+		close(sub.done)
+		delete(ws.subscriptions, query)
+	}
+	if ws.disconnected {
+		return nil
+	}
+	return ws.client.Unsubscribe(ctx, "", query)
 }
 
 func (ws *WsClient) SubscribeVotes(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
-	return ws.client.Subscribe(ctx, "votesub", types.EventQueryVote.String(), 1024)
+	return ws.Subscribe(ctx, "votesub", types.EventQueryVote.String(), 1024)
 
 }
 
 func (ws *WsClient) UnsubscribeVotes(ctx context.Context) error {
-	return ws.client.Unsubscribe(ctx, "", types.EventQueryVote.String())
+	return ws.Unsubscribe(ctx, types.EventQueryVote.String())
 }
 
 func (ws *WsClient) SubscribeNewRound(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
-	return ws.client.Subscribe(ctx, "roundsub", types.EventQueryNewRound.String(), 256)
+	return ws.Subscribe(ctx, "roundsub", types.EventQueryNewRound.String(), 256)
 
 }
 
 func (ws *WsClient) UnsubscribeNewRound(ctx context.Context) error {
-	return ws.client.Unsubscribe(ctx, "", types.EventQueryNewRound.String())
+	return ws.Unsubscribe(ctx, types.EventQueryNewRound.String())
 }
 
 func (ws *WsClient) SubscribeNewRoundStep(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
-	return ws.client.Subscribe(ctx, "roundstepsub", types.EventQueryNewRoundStep.String(), 256)
+	return ws.Subscribe(ctx, "roundstepsub", types.EventQueryNewRoundStep.String(), 256)
 
 }
 
 func (ws *WsClient) UnsubscribeNewRoundStep(ctx context.Context) error {
-	return ws.client.Unsubscribe(ctx, "", types.EventQueryNewRoundStep.String())
+	return ws.Unsubscribe(ctx, types.EventQueryNewRoundStep.String())
+}
+
+func (ws *WsClient) SubscribeCompleteProposal(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "proposalsub", types.EventQueryCompleteProposal.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeCompleteProposal(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryCompleteProposal.String())
+}
+
+func (ws *WsClient) SubscribePolka(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "polkasub", types.EventQueryPolka.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribePolka(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryPolka.String())
+}
+
+func (ws *WsClient) SubscribeLock(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "locksub", types.EventQueryLock.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeLock(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryLock.String())
+}
+
+func (ws *WsClient) SubscribeRelock(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "relocksub", types.EventQueryRelock.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeRelock(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryRelock.String())
+}
+
+func (ws *WsClient) SubscribeUnlock(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "unlocksub", types.EventQueryUnlock.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeUnlock(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryUnlock.String())
+}
+
+func (ws *WsClient) SubscribeTimeoutPropose(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "timeoutproposesub", types.EventQueryTimeoutPropose.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeTimeoutPropose(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryTimeoutPropose.String())
+}
+
+func (ws *WsClient) SubscribeTimeoutWait(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "timeoutwaitsub", types.EventQueryTimeoutWait.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeTimeoutWait(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryTimeoutWait.String())
+}
+
+func (ws *WsClient) SubscribeValidBlock(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "validblocksub", types.EventQueryValidBlock.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeValidBlock(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryValidBlock.String())
+}
+
+func (ws *WsClient) SubscribeNewBlockHeader(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "blockheadersub", types.EventQueryNewBlockHeader.String(), 256)
+}
+
+func (ws *WsClient) UnsubscribeNewBlockHeader(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryNewBlockHeader.String())
+}
+
+// NewBlock events carry every tx of the block along with their results, so fewer of them are buffered
+func (ws *WsClient) SubscribeNewBlock(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "blocksub", types.EventQueryNewBlock.String(), 64)
+}
+
+func (ws *WsClient) UnsubscribeNewBlock(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryNewBlock.String())
+}
+
+// ValidatorSetUpdates events are only published for blocks changing the validator set
+func (ws *WsClient) SubscribeValidatorSetUpdates(ctx context.Context) (<-chan coretypes.ResultEvent, error) {
+	return ws.Subscribe(ctx, "validatorsetsub", types.EventQueryValidatorSetUpdates.String(), 64)
+}
+
+func (ws *WsClient) UnsubscribeValidatorSetUpdates(ctx context.Context) error {
+	return ws.Unsubscribe(ctx, types.EventQueryValidatorSetUpdates.String())
 }
 
 func (ws *WsClient) Validators(ctx context.Context) ([]*types.Validator, error) {
+	_, validators, err := ws.ValidatorSet(ctx)
+	return validators, err
+}
+
+// Returns the active validators along with the height they are active at. All pages are requested at the
+// height of the first page, so the set doesn't change while it is enumerated
+func (ws *WsClient) ValidatorSet(ctx context.Context) (int64, []*types.Validator, error) {
 	var (
 		page       int
 		perPage    int = 100
-		validators     = make([]*types.Validator, 0, 200)
+		height     *int64
+		validators = make([]*types.Validator, 0, 200)
 	)
+	client := ws.rpc()
 	// question: is it sufficient to cap pages to 4? not aware of a cosmos chain with more than 200 validators
 	for page = 1; page < 5; page++ {
-		validatorRes, err := ws.client.Validators(ctx, nil, &page, &perPage)
+		validatorRes, err := client.Validators(ctx, height, &page, &perPage)
 		if err != nil {
 			// if this error happens we have finished enumerating the validator set
 			if strings.Contains(err.Error(), "page should be within") {
 				break
 			}
-			return nil, err
+			return 0, nil, err
 		}
+		height = &validatorRes.BlockHeight
 		validators = append(validators, validatorRes.Validators...)
 	}
-	return validators, nil
+	if height == nil {
+		return 0, validators, nil
+	}
+	return *height, validators, nil
+}
+
+// returns an error if opts.ChainID is set and the node serves another network
+func checkChainID(ctx context.Context, client *rpcclient.HTTP, opts Options) error {
+	if opts.ChainID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.PingTimeout)
+	defer cancel()
+	status, err := client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query the chain id %+v", err)
+	}
+	if status.NodeInfo.Network != opts.ChainID {
+		return fmt.Errorf("node serves chain %s, expected %s", status.NodeInfo.Network, opts.ChainID)
+	}
+	return nil
+}
+
+// Returns the height of the latest block committed by the node
+func (ws *WsClient) LatestHeight(ctx context.Context) (int64, error) {
+	status, err := ws.rpc().Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return status.SyncInfo.LatestBlockHeight, nil
+}
+
+// Runs an abci query against the latest state of the application
+func (ws *WsClient) ABCIQuery(ctx context.Context, path string, data []byte) ([]byte, error) {
+	result, err := ws.rpc().ABCIQuery(ctx, path, data)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Response.IsOK() {
+		return nil, fmt.Errorf("abci query %s failed with code %d: %s", path, result.Response.Code, result.Response.Log)
+	}
+	return result.Response.Value, nil
+}
+
+// Returns the rpc url the client is connected to
+func (ws *WsClient) URL() string {
+	return ws.url
+}
+
+// Stops the client, closing all subscription channels
+func (ws *WsClient) Close() {
+	ws.cancel()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.connCancel()
+	_ = ws.client.Stop()
+	// channels can only be closed once nothing forwards to them
+	ws.forwarders.Wait()
+	for query, sub := range ws.subscriptions {
+		close(sub.done)
+		close(sub.out)
+		delete(ws.subscriptions, query)
+	}
+	ws.setState(StateClosed)
+}
+
+// returns the rpc client of the current connection
+func (ws *WsClient) rpc() *rpcclient.HTTP {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return ws.client
+}
+
+// forwards events of a subscription from a connection until the connection is replaced or the subscription removed,
+// requesting a reconnect if the connection closes the subscription
+func (ws *WsClient) startForwarding(
+	connCtx context.Context,
+	sub *subscription,
+	in <-chan coretypes.ResultEvent,
+) {
+	ws.forwarders.Add(1)
+	go func() {
+		defer ws.forwarders.Done()
+		for {
+			select {
+			case <-connCtx.Done():
+				return
+			case <-sub.done:
+				return
+			case msg, ok := <-in:
+				if !ok {
+					select {
+					case <-sub.done:
+						// closed because of an unsubscribe
+					default:
+						ws.requestReconnect()
+					}
+					return
+				}
+				ws.lastEvent.Store(time.Now().UnixNano())
+				select {
+				case sub.out <- msg:
+				case <-connCtx.Done():
+					return
+				case <-sub.done:
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (ws *WsClient) requestReconnect() {
+	select {
+	case ws.reconnect <- struct{}{}:
+	default:
+	}
+}
+
+// detects disconnects, reconnecting until the client is closed
+func (ws *WsClient) monitor() {
+	ticker := time.NewTicker(ws.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-ws.reconnect:
+			ws.reconnectWithBackoff(errors.New("subscription closed"))
+		case <-ticker.C:
+			if height, err := ws.ping(); err != nil {
+				ws.reconnectWithBackoff(err)
+			} else if ws.stale(height) {
+				ws.reconnectWithBackoff(errors.New("no events received while the node committed new blocks"))
+			}
+		}
+	}
+}
+
+// returns the latest block height of the node
+func (ws *WsClient) ping() (int64, error) {
+	ctx, cancel := context.WithTimeout(ws.ctx, ws.opts.PingTimeout)
+	defer cancel()
+	status, err := ws.rpc().Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return status.SyncInfo.LatestBlockHeight, nil
+}
+
+// returns true if there are subscriptions but no events have been received within the stale timeout, although
+// the node has committed blocks since events were last received
+func (ws *WsClient) stale(height int64) bool {
+	if ws.opts.StaleTimeout == 0 {
+		return false
+	}
+	ws.mu.RLock()
+	subscribed := len(ws.subscriptions) > 0
+	ws.mu.RUnlock()
+	if !subscribed || ws.activeHeight < 0 || time.Since(time.Unix(0, ws.lastEvent.Load())) <= ws.opts.StaleTimeout {
+		ws.activeHeight = height
+		return false
+	}
+	return height > ws.activeHeight
+}
+
+// replaces the current connection, retrying with exponential backoff until it succeeds or the client is closed
+func (ws *WsClient) reconnectWithBackoff(cause error) {
+	ws.mu.Lock()
+	ws.disconnected = true
+	ws.mu.Unlock()
+	ws.activeHeight = -1
+	ws.setState(StateReconnecting)
+	log.Warn().Err(cause).Str("url", ws.url).Msg("connection lost, reconnecting")
+	backoff := ws.opts.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := ws.redial()
+		if err == nil {
+			log.Info().Str("url", ws.url).Int("attempt", attempt).Msg("reconnected")
+			ws.setState(StateConnected)
+			return
+		}
+		log.Error().Err(err).Str("url", ws.url).Int("attempt", attempt).Dur("backoff", backoff).Msg("failed to reconnect")
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > ws.opts.MaxBackoff {
+			backoff = ws.opts.MaxBackoff
+		}
+	}
+}
+
+// dials a new connection and resubscribes all subscriptions on it. The old connection is only replaced once
+// the new one is subscribed, so a failed attempt leaves the client as it was
+func (ws *WsClient) redial() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.ctx.Err() != nil {
+		return ws.ctx.Err()
+	}
+	client, err := dial(ws.url)
+	if err != nil {
+		return err
+	}
+	if err := checkChainID(ws.ctx, client, ws.opts); err != nil {
+		_ = client.Stop()
+		return err
+	}
+	connCtx, connCancel := context.WithCancel(ws.ctx)
+	inputs := make(map[*subscription]<-chan coretypes.ResultEvent, len(ws.subscriptions))
+	for _, sub := range ws.subscriptions {
+		ctx, cancel := context.WithTimeout(ws.ctx, ws.opts.PingTimeout)
+		in, err := client.Subscribe(ctx, sub.subscriber, sub.query, sub.capacity)
+		cancel()
+		if err != nil {
+			connCancel()
+			_ = client.Stop()
+			return fmt.Errorf("failed to resubscribe to %s %+v", sub.query, err)
+		}
+		inputs[sub] = in
+	}
+	// stop forwarding from the old connection before replacing it
+	ws.connCancel()
+	_ = ws.client.Stop()
+	ws.client = client
+	ws.disconnected = false
+	ws.connCtx, ws.connCancel = connCtx, connCancel
+	for sub, in := range inputs {
+		ws.startForwarding(connCtx, sub, in)
+	}
+	ws.lastEvent.Store(time.Now().UnixNano())
+	return nil
 }
@@ -2,115 +2,312 @@ package wsclient_test
 
 import (
 	"context"
-	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
 	"github.com/cometbft/cometbft/types"
-	"github.com/joho/godotenv"
+	"github.com/rangesecurity/ctop/testutil"
 	"github.com/rangesecurity/ctop/wsclient"
 	"github.com/stretchr/testify/require"
 )
 
-func TestWsClientSubscribeVotes(t *testing.T) {
-	envs, err := godotenv.Read("../.env")
+func newNode(t *testing.T, ctx context.Context, validators int) (*testutil.Node, *types.ValidatorSet, []types.PrivValidator) {
+	set, privVals := testutil.NewValidatorSet(validators, 10)
+	node, err := testutil.NewNode(ctx, "127.0.0.1:0", set.Validators)
 	require.NoError(t, err)
-	rpcUrl := envs["OSMOSIS_RPC"]
+	t.Cleanup(node.Close)
+	return node, set, privVals
+}
+
+func TestWsClientSubscribeVotes(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	client, err := wsclient.NewClient(rpcUrl)
+	node, set, privVals := newNode(t, ctx, 4)
+	client, err := wsclient.NewClient(node.URL())
 	require.NoError(t, err)
+	defer client.Close()
 	outCh, err := client.SubscribeVotes(ctx)
 	require.NoError(t, err)
 	defer client.UnsubscribeVotes(ctx)
-	i := 0
-	fmt.Println("Listening for events")
-	for {
+	require.NoError(t, node.WaitForSubscriptions(ctx, types.EventQueryVote.String(), 1))
+
+	events, err := testutil.CommitHeight(set, privVals, 100, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, node.Play(ctx, events))
+	for i := 0; i < 2*len(privVals); i++ {
 		vote := <-outCh
 		voteInfo, ok := vote.Data.(types.EventDataVote)
-		if !ok {
-			continue
-		}
-		t.Logf(
-			"type %s, height %v, round %v, blockId %s, timestamp %s, validator %s, validatorIndex %v\n",
-			voteInfo.Vote.Type, voteInfo.Vote.Height, voteInfo.Vote.Round, voteInfo.Vote.BlockID, voteInfo.Vote.Timestamp, voteInfo.Vote.ValidatorAddress, voteInfo.Vote.ValidatorIndex,
-		)
-		i++
-		if i >= 3 {
-			break
-		}
+		require.True(t, ok)
+		require.Equal(t, int64(100), voteInfo.Vote.Height)
+		require.Equal(t, set.Validators[voteInfo.Vote.ValidatorIndex].Address, voteInfo.Vote.ValidatorAddress)
+		require.NoError(t, voteInfo.Vote.Verify(testutil.ChainID, set.Validators[voteInfo.Vote.ValidatorIndex].PubKey))
 	}
 }
 
 func TestWsClientSubscribeNewRound(t *testing.T) {
-	envs, err := godotenv.Read("../.env")
-	require.NoError(t, err)
-	rpcUrl := envs["OSMOSIS_RPC"]
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	client, err := wsclient.NewClient(rpcUrl)
+	node, set, privVals := newNode(t, ctx, 4)
+	client, err := wsclient.NewClient(node.URL())
 	require.NoError(t, err)
+	defer client.Close()
 	outCh, err := client.SubscribeNewRound(ctx)
 	require.NoError(t, err)
 	defer client.UnsubscribeNewRound(ctx)
-	i := 0
-	fmt.Println("Listening for events")
-	for {
-		vote := <-outCh
-		roundInfo, ok := vote.Data.(types.EventDataNewRound)
-		if !ok {
-			continue
-		}
-		t.Logf(
-			"height %v, round %v, step %s, blockId %s\n",
-			roundInfo.Height, roundInfo.Round, roundInfo.Step, roundInfo.Proposer.Address,
-		)
-		i++
-		if i >= 3 {
-			break
-		}
+	require.NoError(t, node.WaitForSubscriptions(ctx, types.EventQueryNewRound.String(), 1))
+
+	for height := int64(100); height < 103; height++ {
+		events, err := testutil.CommitHeight(set, privVals, height, time.Now())
+		require.NoError(t, err)
+		require.NoError(t, node.Play(ctx, events))
+	}
+	for height := int64(100); height < 103; height++ {
+		round := <-outCh
+		roundInfo, ok := round.Data.(types.EventDataNewRound)
+		require.True(t, ok)
+		require.Equal(t, height, roundInfo.Height)
+		require.Equal(t, set.GetProposer().Address, roundInfo.Proposer.Address)
 	}
 }
 
 func TestWsClientSubscribeNewRoundStep(t *testing.T) {
-	envs, err := godotenv.Read("../.env")
-	require.NoError(t, err)
-	rpcUrl := envs["OSMOSIS_RPC"]
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	client, err := wsclient.NewClient(rpcUrl)
+	node, set, privVals := newNode(t, ctx, 4)
+	client, err := wsclient.NewClient(node.URL())
 	require.NoError(t, err)
+	defer client.Close()
 	outCh, err := client.SubscribeNewRoundStep(ctx)
 	require.NoError(t, err)
 	defer client.UnsubscribeNewRoundStep(ctx)
-	i := 0
-	fmt.Println("Listening for events")
+	require.NoError(t, node.WaitForSubscriptions(ctx, types.EventQueryNewRoundStep.String(), 1))
+
+	events, err := testutil.CommitHeight(set, privVals, 100, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, node.Play(ctx, events))
+	for _, step := range []string{
+		"RoundStepNewHeight",
+		"RoundStepNewRound",
+		"RoundStepPropose",
+		"RoundStepPrevote",
+		"RoundStepPrecommit",
+		"RoundStepCommit",
+	} {
+		roundState := <-outCh
+		roundInfo, ok := roundState.Data.(types.EventDataRoundState)
+		require.True(t, ok)
+		require.Equal(t, int64(100), roundInfo.Height)
+		require.Equal(t, step, roundInfo.Step)
+	}
+}
+
+func TestWsClientSubscribeRoundEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node, set, privVals := newNode(t, ctx, 4)
+	client, err := wsclient.NewClient(node.URL())
+	require.NoError(t, err)
+	defer client.Close()
+	proposals, err := client.SubscribeCompleteProposal(ctx)
+	require.NoError(t, err)
+	defer client.UnsubscribeCompleteProposal(ctx)
+	polkas, err := client.SubscribePolka(ctx)
+	require.NoError(t, err)
+	defer client.UnsubscribePolka(ctx)
+	locks, err := client.SubscribeLock(ctx)
+	require.NoError(t, err)
+	defer client.UnsubscribeLock(ctx)
+	timeouts, err := client.SubscribeTimeoutPropose(ctx)
+	require.NoError(t, err)
+	defer client.UnsubscribeTimeoutPropose(ctx)
+	for _, query := range []string{
+		types.EventQueryCompleteProposal.String(),
+		types.EventQueryPolka.String(),
+		types.EventQueryLock.String(),
+		types.EventQueryTimeoutPropose.String(),
+	} {
+		require.NoError(t, node.WaitForSubscriptions(ctx, query, 1))
+	}
+
+	events, err := testutil.CommitHeight(set, privVals, 100, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, node.Play(ctx, events))
+	require.NoError(t, node.Publish(types.EventTimeoutPropose, types.EventDataRoundState{
+		Height: 101, Round: 0, Step: "RoundStepPropose",
+	}))
+
+	proposal := <-proposals
+	proposalInfo, ok := proposal.Data.(types.EventDataCompleteProposal)
+	require.True(t, ok)
+	require.Equal(t, int64(100), proposalInfo.Height)
+	require.Equal(t, testutil.BlockID(100), proposalInfo.BlockID)
+	for _, ch := range []<-chan coretypes.ResultEvent{polkas, locks} {
+		roundInfo, ok := (<-ch).Data.(types.EventDataRoundState)
+		require.True(t, ok)
+		require.Equal(t, int64(100), roundInfo.Height)
+		require.Equal(t, "RoundStepPrevote", roundInfo.Step)
+	}
+	timeout := <-timeouts
+	roundInfo, ok := timeout.Data.(types.EventDataRoundState)
+	require.True(t, ok)
+	require.Equal(t, int64(101), roundInfo.Height)
+}
+
+func TestWsClientValidator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// spans multiple pages of 100 validators
+	node, set, _ := newNode(t, ctx, 250)
+	client, err := wsclient.NewClient(node.URL())
+	require.NoError(t, err)
+	defer client.Close()
+	valis, err := client.Validators(ctx)
+	require.NoError(t, err)
+	require.Len(t, valis, 250)
+	for i, vali := range valis {
+		require.Equal(t, set.Validators[i].Address, vali.Address)
+	}
+
+	require.NoError(t, node.Publish(types.EventNewBlockHeader, types.EventDataNewBlockHeader{Header: types.Header{Height: 42}}))
+	height, valis, err := client.ValidatorSet(ctx)
+	require.NoError(t, err)
+	require.Len(t, valis, 250)
+	require.Equal(t, int64(42), height)
+	latest, err := client.LatestHeight(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), latest)
+}
+
+func TestWsClientDroppedConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node, set, _ := newNode(t, ctx, 4)
+	client, err := wsclient.NewClient(node.URL())
+	require.NoError(t, err)
+	defer client.Close()
+	outCh, err := client.SubscribeNewRound(ctx)
+	require.NoError(t, err)
+	require.NoError(t, node.WaitForSubscriptions(ctx, types.EventQueryNewRound.String(), 1))
+
+	node.DropConnections()
+	receiveNewRound(t, ctx, node, set, outCh)
+}
+
+// options detecting stale connections quickly, reporting state changes on the returned channel
+func TestWsClientChainID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node, _, _ := newNode(t, ctx, 4)
+
+	opts := wsclient.DefaultOptions()
+	opts.ChainID = testutil.ChainID
+	client, err := wsclient.NewClientWithOptions(node.URL(), opts)
+	require.NoError(t, err)
+	client.Close()
+
+	// nodes of another chain are rejected, even when connecting in the background
+	opts.ChainID = "osmosis-1"
+	opts.ConnectInBackground = true
+	_, err = wsclient.NewClientWithOptions(node.URL(), opts)
+	require.ErrorContains(t, err, "node serves chain ctop-test, expected osmosis-1")
+}
+
+func fastOptions() (wsclient.Options, <-chan wsclient.ConnectionState) {
+	states := make(chan wsclient.ConnectionState, 64)
+	opts := wsclient.DefaultOptions()
+	opts.PingInterval = 10 * time.Millisecond
+	opts.StaleTimeout = 50 * time.Millisecond
+	opts.MinBackoff = 10 * time.Millisecond
+	opts.MaxBackoff = 50 * time.Millisecond
+	opts.OnStateChange = func(state wsclient.ConnectionState) {
+		select {
+		case states <- state:
+		default:
+		}
+	}
+	return opts, states
+}
+
+func waitForState(t *testing.T, ctx context.Context, states <-chan wsclient.ConnectionState, want wsclient.ConnectionState) {
 	for {
-		vote := <-outCh
-		roundInfo, ok := vote.Data.(types.EventDataRoundState)
-		if !ok {
-			continue
+		select {
+		case state := <-states:
+			if state == want {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatalf("client did not become %s", want)
 		}
-		t.Logf(
-			"height %v, round %v, step %s\n",
-			roundInfo.Height, roundInfo.Round, roundInfo.Step,
-		)
-		i++
-		if i >= 3 {
-			break
+	}
+}
+
+// publishes new rounds until one is received, events published before a subscription is restored are lost
+func receiveNewRound(t *testing.T, ctx context.Context, node *testutil.Node, set *types.ValidatorSet, outCh <-chan coretypes.ResultEvent) {
+	proposer := types.ValidatorInfo{Address: set.GetProposer().Address}
+	for height := int64(100); ; height++ {
+		require.NoError(t, node.Publish(types.EventNewRound, types.EventDataNewRound{Height: height, Proposer: proposer}))
+		select {
+		case round := <-outCh:
+			_, ok := round.Data.(types.EventDataNewRound)
+			require.True(t, ok)
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no events received")
 		}
 	}
 }
 
-func TestWsClientValidator(t *testing.T) {
-	envs, err := godotenv.Read("../.env")
+func TestWsClientStaleConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node, set, _ := newNode(t, ctx, 4)
+	opts, states := fastOptions()
+	client, err := wsclient.NewClientWithOptions(node.URL(), opts)
 	require.NoError(t, err)
-	rpcUrl := envs["OSMOSIS_RPC"]
+	defer client.Close()
+	waitForState(t, ctx, states, wsclient.StateConnected)
+	outCh, err := client.SubscribeNewRound(ctx)
+	require.NoError(t, err)
+	require.NoError(t, node.WaitForSubscriptions(ctx, types.EventQueryNewRound.String(), 1))
+
+	// a halted chain publishes no events, which is no reason to reconnect
+	time.Sleep(20 * opts.StaleTimeout)
+	require.Empty(t, states)
+	require.Equal(t, wsclient.StateConnected, client.State())
+
+	// the node committing blocks without any events being received is
+	node.SetBlockHeight(10)
+	waitForState(t, ctx, states, wsclient.StateReconnecting)
+	waitForState(t, ctx, states, wsclient.StateConnected)
+	receiveNewRound(t, ctx, node, set, outCh)
+}
+
+func TestWsClientSubscribeWhileReconnecting(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	client, err := wsclient.NewClient(rpcUrl)
+	node, set, _ := newNode(t, ctx, 4)
+	addr := strings.TrimPrefix(node.URL(), "tcp://")
+	opts, states := fastOptions()
+	client, err := wsclient.NewClientWithOptions(node.URL(), opts)
 	require.NoError(t, err)
-	valis, err := client.Validators(ctx)
+	defer client.Close()
+	waitForState(t, ctx, states, wsclient.StateConnected)
+
+	node.Close()
+	waitForState(t, ctx, states, wsclient.StateReconnecting)
+	// failed reconnect attempts leave the client usable, subscriptions are made once the node is back
+	outCh, err := client.SubscribeNewRound(ctx)
+	require.NoError(t, err)
+	_, err = client.LatestHeight(ctx)
+	require.Error(t, err)
+
+	restarted, err := testutil.NewNode(ctx, addr, set.Validators)
 	require.NoError(t, err)
-	require.Greater(t, len(valis), 0)
+	defer restarted.Close()
+	waitForState(t, ctx, states, wsclient.StateConnected)
+	require.NoError(t, restarted.WaitForSubscriptions(ctx, types.EventQueryNewRound.String(), 1))
+	receiveNewRound(t, ctx, restarted, set, outCh)
 }